@@ -2,12 +2,14 @@ package main
 
 import (
 	"github.com/Reeceeboii/Pi-CLI/pkg/cli"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"log"
 	"os"
 )
 
 func main() {
 	if err := cli.App.Run(os.Args); err != nil {
-		log.Fatal(err)
+		// errors can include the API key, i.e. in the URLs of failed requests
+		log.Fatal(network.RedactError(err))
 	}
 }
@@ -9,6 +9,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/urfave/cli/v2 v2.25.7
 	github.com/zalando/go-keyring v0.2.3
+	golang.org/x/crypto v0.10.0
 	golang.org/x/text v0.10.0
 )
 
@@ -1,12 +1,12 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
 	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"github.com/buger/jsonparser"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 	"sync"
@@ -44,6 +44,8 @@ type AllQueries struct {
 	AmountOfQueriesInLog int
 	// The queries stored in a format able to be displayed as a table
 	Table []string
+	// What the Pi-Hole's privacy level hid in the queries from the last update, if anything
+	Hidden *PrivacyLevelError
 }
 
 // Make a new AllQueries instance
@@ -55,8 +57,13 @@ func NewAllQueries() *AllQueries {
 	}
 }
 
-// Updates the all queries list with up to date information from the Pi-Hole
-func (allQueries *AllQueries) Update(wg *sync.WaitGroup) {
+/*
+Updates the all queries list with up to date information from the Pi-Hole, returning an error if
+the Pi-Hole couldn't be reached, its response wasn't a query log or its privacy level hides it.
+Privacy levels that only hide the domains or clients in the log aren't errors, as the log can
+still be shown, but what they hide is kept in Hidden.
+*/
+func (allQueries *AllQueries) Update(ctx context.Context, wg *sync.WaitGroup) error {
 	if wg != nil {
 		wg.Add(1)
 		defer wg.Done()
@@ -69,18 +76,30 @@ func (allQueries *AllQueries) Update(wg *sync.WaitGroup) {
 		"&auth=" +
 		data.LivePiCLIData.APIKey
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	res, err := network.HttpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer res.Body.Close()
 
-	parsedBody, _ := ioutil.ReadAll(res.Body)
+	parsedBody, err := readResponse(res, "query log")
+	if err != nil {
+		return err
+	}
+	if err := requireKeys(parsedBody, "query log", AllQueryDataKey); err != nil {
+		return err
+	}
+	// the log is empty rather than missing when the privacy level hides it
+	if _, _, _, err := jsonparser.Get(parsedBody, AllQueryDataKey, "[0]"); err != nil {
+		if err := hiddenByPrivacyLevel(ctx, "query log", PrivacyLevelAnonymous); err != nil {
+			return err
+		}
+	}
 
 	/*
 		For every index in the parsed body's data array, pull out the required fields.
@@ -102,11 +121,36 @@ func (allQueries *AllQueries) Update(wg *sync.WaitGroup) {
 			ForwardedTo:  forwardedTo,
 		}
 	}
-	allQueries.convertToTable()
+	allQueries.Hidden = hiddenQueryFields(allQueries.Queries)
+	allQueries.ConvertToTable()
+	return nil
 }
 
-// Convert slice of queries to a formatted multidimensional slice
-func (allQueries *AllQueries) convertToTable() {
+/*
+Works out which privacy level hid the domains and clients in a set of queries, from the
+placeholders that the Pi-Hole puts in their place. Clients are only taken as hidden along with
+their domain, as privacy level 2 hides both and 0.0.0.0 could otherwise be a real client.
+*/
+func hiddenQueryFields(queries []Query) *PrivacyLevelError {
+	var hidden *PrivacyLevelError
+	for _, query := range queries {
+		if query.Domain != HiddenDomain {
+			continue
+		}
+		if query.OriginClient == HiddenClient {
+			return &PrivacyLevelError{Hidden: "query log domains and clients", Level: "2"}
+		}
+		hidden = &PrivacyLevelError{Hidden: "query log domains", Level: "1"}
+	}
+	return hidden
+}
+
+/*
+	Convert slice of queries to a formatted multidimensional slice. Clients are labelled with their
+	names where they have one and, if enabled, queries for suspicious looking domains are highlighted
+	using termui's style markup.
+*/
+func (allQueries *AllQueries) ConvertToTable() {
 	table := make([]string, allQueries.AmountOfQueriesInLog)
 
 	for i, q := range allQueries.Queries {
@@ -116,10 +160,13 @@ func (allQueries *AllQueries) convertToTable() {
 			(allQueries.AmountOfQueriesInLog)-i,
 			parsedTime.Format("15:04:05"),
 			q.QueryType,
-			q.OriginClient,
+			data.LivePiCLIData.Clients.Label(q.OriginClient),
 			q.Domain,
 			q.ForwardedTo,
 		)
+		if data.LivePiCLIData.HighlightSuspiciousDomains && domains.IsLexicallySuspicious(q.Domain) {
+			entry = fmt.Sprintf("[%s](fg:red,mod:bold)", entry)
+		}
 		table[(allQueries.AmountOfQueriesInLog-1)-i] = entry
 	}
 	allQueries.Table = table
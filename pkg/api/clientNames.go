@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
+	"github.com/buger/jsonparser"
+)
+
+// Key of the list of clients returned by the getClientNames endpoint
+const ClientNamesKey = "clients"
+
+/*
+Adds the names that the Pi-Hole knows its clients by to a directory. Pi-Hole versions that
+don't support the endpoint just don't add any names.
+*/
+func UpdateClientNames(ctx context.Context, directory *clients.Directory) error {
+	url := data.LivePiCLIData.FormattedAPIAddress + "?getClientNames&auth=" + data.LivePiCLIData.APIKey
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := network.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	parsedBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	_, _ = jsonparser.ArrayEach(parsedBody, func(client []byte, _ jsonparser.ValueType, _ int, _ error) {
+		name, _ := jsonparser.GetString(client, "name")
+		ip, _ := jsonparser.GetString(client, "ip")
+		directory.Add(ip, name, clients.PiHoleSource)
+	}, ClientNamesKey)
+	return nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+)
+
+// Tests for api.UpdateClientNames(), and the names being used to label clients in the query log
+func TestUpdateClientNames(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.RequestURI(), "/api.php?getClientNames&auth="+testKey) {
+			t.Errorf("@TestUpdateClientNames: api.UpdateClientNames() requested %s", r.URL.RequestURI())
+		}
+		_, _ = w.Write([]byte(`{"clients": [
+			{"name": "laptop.lan", "ip": "192.168.1.10"},
+			{"name": "speaker.lan", "ip": "192.168.1.23"}
+		]}`))
+	}))
+	defer mockServer.Close()
+
+	data.LivePiCLIData.FormattedAPIAddress = mockServer.URL + "/api.php"
+	data.LivePiCLIData.APIKey = testKey
+
+	directory := clients.NewDirectory()
+	directory.Add("192.168.1.23", "Kitchen Speaker", clients.AliasSource)
+	if err := UpdateClientNames(context.Background(), directory); err != nil {
+		t.Fatalf("@TestUpdateClientNames: api.UpdateClientNames() failed: %s", err)
+	}
+	if directory.Name("192.168.1.10") != "laptop.lan" || directory.Name("192.168.1.23") != "Kitchen Speaker" {
+		t.Errorf("@TestUpdateClientNames: unexpected names %q and %q",
+			directory.Name("192.168.1.10"), directory.Name("192.168.1.23"))
+	}
+
+	data.LivePiCLIData.Clients = directory
+	defer func() { data.LivePiCLIData.Clients = clients.NewDirectory() }()
+
+	allQueries := NewAllQueries()
+	allQueries.AmountOfQueriesInLog = 1
+	allQueries.Queries = []Query{{UnixTime: "0", QueryType: "A", Domain: "example.com", OriginClient: "192.168.1.23"}}
+	allQueries.ConvertToTable()
+	if !strings.Contains(allQueries.Table[0], "from Kitchen Speaker (192.168.1.23) to example.com") {
+		t.Errorf("@TestUpdateClientNames: expected the client to be labelled in the query log, got %q", allQueries.Table[0])
+	}
+}
@@ -1,41 +1,48 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
 	"github.com/Reeceeboii/Pi-CLI/pkg/network"
-	"log"
 	"net/http"
 )
 
 // Enable the Pi-Hole
-func EnablePiHole() {
-	url := data.LivePiCLIData.FormattedAPIAddress + "?enable" + "&auth=" + data.LivePiCLIData.APIKey
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = network.HttpClient.Do(req)
-	if err != nil {
-		log.Fatal(err)
-	}
+func EnablePiHole(ctx context.Context) error {
+	return sendStatusChange(ctx, data.LivePiCLIData.FormattedAPIAddress+"?enable"+"&auth="+data.LivePiCLIData.APIKey)
 }
 
 // Disable the Pi-Hole
-func DisablePiHole(timeout bool, time int64) {
+func DisablePiHole(ctx context.Context, timeout bool, time int64) error {
 	disable := "?disable"
 	if timeout {
 		disable += fmt.Sprintf("=%d", time)
 	}
-	url := data.LivePiCLIData.FormattedAPIAddress + disable + "&auth=" + data.LivePiCLIData.APIKey
-	req, err := http.NewRequest("GET", url, nil)
+	return sendStatusChange(ctx, data.LivePiCLIData.FormattedAPIAddress+disable+"&auth="+data.LivePiCLIData.APIKey)
+}
+
+/*
+Sends a request that changes the Pi-Hole's status. These are never retried, as a request that
+failed may have still reached the Pi-Hole, and the user should check its status before trying
+again. The Pi-Hole replies with its new status, which is checked so that a rejected API key isn't
+mistaken for success.
+*/
+func sendStatusChange(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(network.WithoutRetries(ctx), "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := network.HttpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer res.Body.Close()
 
-	_, err = network.HttpClient.Do(req)
+	parsedBody, err := readResponse(res, "status change")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return requireKeys(parsedBody, "status change", StatusKey)
 }
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/buger/jsonparser"
+)
+
+/*
+Returned when the Pi-Hole doesn't accept the API key. Rather than an error status, the Pi-Hole's
+API replies to requests with a missing or wrong key with an empty JSON array.
+*/
+var ErrAPIKeyRejected = errors.New("API key rejected - run setup to enter it again")
+
+// Privacy levels at which the Pi-Hole stops giving out data
+const (
+	// Top domains and top ads are hidden
+	PrivacyLevelHideDomains = 1
+	// The query log is hidden as well
+	PrivacyLevelAnonymous = 3
+)
+
+// Placeholders that the Pi-Hole puts in the query log in place of what its privacy level hides
+const (
+	// Shown instead of the domain from privacy level 1
+	HiddenDomain = "hidden"
+	// Shown instead of the client from privacy level 2
+	HiddenClient = "0.0.0.0"
+)
+
+// Names of the Pi-Hole's privacy levels
+var PrivacyLevelNames = map[string]string{
+	"0": "Show Everything",
+	"1": "Hide Domains",
+	"2": "Hide Domains and Clients",
+	"3": "Anonymous",
+}
+
+// Returned when a response from the Pi-Hole isn't in the shape that was expected
+type ResponseError struct {
+	// What was requested, i.e. "summary"
+	Endpoint string
+	// What was wrong with the response
+	Reason string
+}
+
+func (err *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected %s response from the Pi-Hole: %s", err.Endpoint, err.Reason)
+}
+
+// Returned when the Pi-Hole's privacy level stops it from giving out what was requested
+type PrivacyLevelError struct {
+	// What is hidden, i.e. "query log"
+	Hidden string
+	// The Pi-Hole's privacy level
+	Level string
+}
+
+func (err *PrivacyLevelError) Error() string {
+	return fmt.Sprintf("%s hidden by privacy level %s (%s)", err.Hidden, err.Level, PrivacyLevelNames[err.Level])
+}
+
+/*
+Reads the body of a response from the Pi-Hole's API, checking that it's a JSON object. Error
+statuses, HTML pages (i.e. from a web server that isn't the Pi-Hole, or a login page in front of
+it) and the empty array that the Pi-Hole replies with when the API key is wrong are all errors.
+*/
+func readResponse(res *http.Response, endpoint string) ([]byte, error) {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &ResponseError{Endpoint: endpoint, Reason: "HTTP status " + res.Status}
+	}
+	if strings.Contains(res.Header.Get("Content-Type"), "text/html") || bytes.HasPrefix(trimmed, []byte("<")) {
+		return nil, &ResponseError{
+			Endpoint: endpoint,
+			Reason:   fmt.Sprintf("got a HTML page rather than JSON - check that %s is the Pi-Hole's address", res.Request.URL.Host),
+		}
+	}
+	if bytes.Equal(bytes.Join(bytes.Fields(trimmed), nil), []byte("[]")) {
+		return nil, ErrAPIKeyRejected
+	}
+	if _, dataType, _, err := jsonparser.Get(trimmed); err != nil || dataType != jsonparser.Object {
+		return nil, &ResponseError{Endpoint: endpoint, Reason: "not a JSON object"}
+	}
+	return trimmed, nil
+}
+
+// Checks that a response has each of the given keys
+func requireKeys(body []byte, endpoint string, keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if _, _, _, err := jsonparser.Get(body, key); err != nil {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return &ResponseError{Endpoint: endpoint, Reason: "missing " + strings.Join(missing, ", ")}
+	}
+	return nil
+}
+
+/*
+Explains a response that came back empty, if the Pi-Hole's privacy level is at least the one that
+hides what was requested. The privacy level is requested separately, as the response itself
+looks the same as one from a Pi-Hole that has nothing to show yet.
+*/
+func hiddenByPrivacyLevel(ctx context.Context, hidden string, minimumLevel int) error {
+	summary := NewSummary()
+	if err := summary.Update(ctx, data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil); err != nil {
+		return err
+	}
+	if level, err := strconv.Atoi(summary.PrivacyLevel); err == nil && level >= minimumLevel {
+		return &PrivacyLevelError{Hidden: hidden, Level: summary.PrivacyLevel}
+	}
+	return nil
+}
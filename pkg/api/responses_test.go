@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+)
+
+// A summary response from a Pi-Hole with a given privacy level
+func testSummaryResponse(privacyLevel string) string {
+	return `{"domains_being_blocked": "1,000", "dns_queries_today": "200", "ads_blocked_today": "20",
+		"ads_percentage_today": "10.0", "status": "enabled", "privacy_level": "` + privacyLevel + `"}`
+}
+
+// Tests for api.Summary.Update() rejecting responses that aren't a summary
+func TestUpdateInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		expected    string
+	}{
+		{"wrong API key", "application/json", http.StatusOK, "[]", ErrAPIKeyRejected.Error()},
+		{"HTML page", "text/html", http.StatusOK, "<html><body>Login</body></html>", "HTML page"},
+		{"error status", "text/plain", http.StatusForbidden, "", "403 Forbidden"},
+		{"not JSON", "text/plain", http.StatusOK, "Not Found", "not a JSON object"},
+		{"missing fields", "application/json", http.StatusOK, `{"status": "enabled"}`, "missing dns_queries_today"},
+	}
+
+	for _, test := range tests {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.WriteHeader(test.status)
+			_, _ = w.Write([]byte(test.body))
+		}))
+
+		err := NewSummary().Update(context.Background(), mockServer.URL+"/api.php", testKey, nil)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("@TestUpdateInvalidResponses: %s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+		mockServer.Close()
+	}
+}
+
+// Tests for empty top items and query logs being explained by the Pi-Hole's privacy level
+func TestHiddenByPrivacyLevel(t *testing.T) {
+	privacyLevel := "3"
+	queryLog := `{"data": []}`
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.RawQuery, "summary"):
+			_, _ = w.Write([]byte(testSummaryResponse(privacyLevel)))
+		case strings.Contains(r.URL.RawQuery, "topItems"):
+			_, _ = w.Write([]byte(`{"top_queries": [], "top_ads": []}`))
+		default:
+			_, _ = w.Write([]byte(queryLog))
+		}
+	}))
+	defer mockServer.Close()
+
+	data.LivePiCLIData.FormattedAPIAddress = mockServer.URL + "/api.php"
+	data.LivePiCLIData.APIKey = testKey
+
+	var privacyErr *PrivacyLevelError
+	err := NewTopItems().Update(context.Background(), nil)
+	if !errors.As(err, &privacyErr) || err.Error() != "top domains hidden by privacy level 3 (Anonymous)" {
+		t.Errorf("@TestHiddenByPrivacyLevel: unexpected top items error %v", err)
+	}
+	err = NewAllQueries().Update(context.Background(), nil)
+	if !errors.As(err, &privacyErr) || err.Error() != "query log hidden by privacy level 3 (Anonymous)" {
+		t.Errorf("@TestHiddenByPrivacyLevel: unexpected query log error %v", err)
+	}
+
+	// the query log is still shown at privacy levels 1 and 2, with placeholders for what they hide
+	privacyLevel = "2"
+	queryLog = `{"data": [["1700000000", "A", "hidden", "0.0.0.0", "2", "0", "0", "0", "N/A", "-1", "N/A", "#", ""]]}`
+	allQueries := NewAllQueries()
+	allQueries.AmountOfQueriesInLog = 1
+	allQueries.Queries = make([]Query, 1)
+	if err := allQueries.Update(context.Background(), nil); err != nil {
+		t.Errorf("@TestHiddenByPrivacyLevel: the query log at privacy level 2 returned %s", err.Error())
+	}
+	if allQueries.Hidden == nil || allQueries.Hidden.Error() != "query log domains and clients hidden by privacy level 2 (Hide Domains and Clients)" {
+		t.Errorf("@TestHiddenByPrivacyLevel: unexpected note for the query log at privacy level 2: %v", allQueries.Hidden)
+	}
+	if len(allQueries.Table) != 1 || !strings.Contains(allQueries.Table[0], "to hidden") {
+		t.Errorf("@TestHiddenByPrivacyLevel: the query log at privacy level 2 was not shown: %v", allQueries.Table)
+	}
+
+	privacyLevel = "1"
+	queryLog = `{"data": [["1700000000", "A", "hidden", "192.168.1.10", "2", "0", "0", "0", "N/A", "-1", "N/A", "#", ""]]}`
+	if err := allQueries.Update(context.Background(), nil); err != nil {
+		t.Errorf("@TestHiddenByPrivacyLevel: the query log at privacy level 1 returned %s", err.Error())
+	}
+	if allQueries.Hidden == nil || allQueries.Hidden.Error() != "query log domains hidden by privacy level 1 (Hide Domains)" {
+		t.Errorf("@TestHiddenByPrivacyLevel: unexpected note for the query log at privacy level 1: %v", allQueries.Hidden)
+	}
+
+	privacyLevel = "0"
+	queryLog = `{"data": [["1700000000", "A", "example.com", "0.0.0.0", "2", "0", "0", "0", "N/A", "-1", "N/A", "#", ""]]}`
+	if err := allQueries.Update(context.Background(), nil); err != nil || allQueries.Hidden != nil {
+		t.Errorf("@TestHiddenByPrivacyLevel: a query log with nothing hidden gave %v and a note of %v", err, allQueries.Hidden)
+	}
+
+	// and with everything shown, empty lists are just a quiet Pi-Hole
+	if err := NewTopItems().Update(context.Background(), nil); err != nil {
+		t.Errorf("@TestHiddenByPrivacyLevel: empty top items at privacy level 0 returned %s", err.Error())
+	}
+}
+
+// Tests for api.EnablePiHole() noticing that the API key was rejected
+func TestEnablePiHoleRejected(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer mockServer.Close()
+
+	data.LivePiCLIData.FormattedAPIAddress = mockServer.URL + "/api.php"
+	data.LivePiCLIData.APIKey = testKey
+
+	if err := EnablePiHole(context.Background()); !errors.Is(err, ErrAPIKeyRejected) {
+		t.Errorf("@TestEnablePiHoleRejected: expected ErrAPIKeyRejected, got %v", err)
+	}
+}
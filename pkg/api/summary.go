@@ -1,10 +1,9 @@
 package api
 
 import (
+	"context"
 	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"github.com/buger/jsonparser"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"sync"
 )
@@ -47,24 +46,22 @@ Returns a new Summary instance with default values for all fields
 */
 func NewSummary() *Summary {
 	return &Summary{
-		QueriesToday:        "",
-		BlockedToday:        "",
-		PercentBlockedToday: "",
-		DomainsOnBlocklist:  "",
-		Status:              "",
-		PrivacyLevel:        "",
-		PrivacyLevelNumberMapping: map[string]string{
-			"0": "Show Everything",
-			"1": "Hide Domains",
-			"2": "Hide Domains and Clients",
-			"3": "Anonymous",
-		},
-		TotalClientsSeen: "",
+		QueriesToday:              "",
+		BlockedToday:              "",
+		PercentBlockedToday:       "",
+		DomainsOnBlocklist:        "",
+		Status:                    "",
+		PrivacyLevel:              "",
+		PrivacyLevelNumberMapping: PrivacyLevelNames,
+		TotalClientsSeen:          "",
 	}
 }
 
-// Updates a Summary struct with up to date information
-func (summary *Summary) Update(url string, key string, wg *sync.WaitGroup) {
+/*
+Updates a Summary struct with up to date information, returning an error if the Pi-Hole couldn't be
+reached or its response wasn't a summary
+*/
+func (summary *Summary) Update(ctx context.Context, url string, key string, wg *sync.WaitGroup) error {
 	if wg != nil {
 		wg.Add(1)
 		defer wg.Done()
@@ -75,18 +72,26 @@ func (summary *Summary) Update(url string, key string, wg *sync.WaitGroup) {
 		url += "&auth=" + key
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	res, err := network.HttpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer res.Body.Close()
 
-	parsedBody, _ := ioutil.ReadAll(res.Body)
+	parsedBody, err := readResponse(res, "summary")
+	if err != nil {
+		return err
+	}
+	err = requireKeys(parsedBody, "summary",
+		StatusKey, DNSQueriesTodayKey, AdsBlockedTodayKey, PercentBlockedTodayKey, DomainsOnBlockListKey, PrivacyLevelKey)
+	if err != nil {
+		return err
+	}
 	// yoink out all the data from the response
 	// pack it into the struct
 	summary.QueriesToday, _ = jsonparser.GetString(parsedBody, DNSQueriesTodayKey)
@@ -96,4 +101,5 @@ func (summary *Summary) Update(url string, key string, wg *sync.WaitGroup) {
 	summary.Status, _ = jsonparser.GetString(parsedBody, StatusKey)
 	summary.PrivacyLevel, _ = jsonparser.GetString(parsedBody, PrivacyLevelKey)
 	summary.TotalClientsSeen, _ = jsonparser.GetString(parsedBody, TotalClientsSeenKey)
+	return nil
 }
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -24,7 +27,7 @@ func TestUpdateWithApiKey(t *testing.T) {
 	defer mockServer.Close()
 	url := mockServer.URL + "/api.php"
 
-	summary.Update(url, testKey, nil)
+	summary.Update(context.Background(), url, testKey, nil)
 }
 
 // Tests for api.Summary.Update() without an API key
@@ -42,5 +45,32 @@ func TestUpdateWithoutAPIKey(t *testing.T) {
 	}))
 	defer mockServer.Close()
 	url := mockServer.URL + "/api.php"
-	summary.Update(url, "", nil)
+	summary.Update(context.Background(), url, "", nil)
+}
+
+// Tests for api.Summary.Update() giving up as soon as its context is cancelled
+func TestUpdateCancelled(t *testing.T) {
+	summary := NewSummary()
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a Pi-Hole that's slow to respond
+		select {
+		case <-release:
+		case <-time.After(time.Second * 10):
+		}
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+
+	start := time.Now()
+	err := summary.Update(ctx, mockServer.URL+"/api.php", testKey, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("@TestUpdateCancelled: api.Summary.Update() returned %v, expected context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("@TestUpdateCancelled: api.Summary.Update() took %s to return after being cancelled", elapsed)
+	}
 }
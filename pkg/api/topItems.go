@@ -1,14 +1,13 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
 	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"github.com/buger/jsonparser"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"sync"
 )
@@ -20,6 +19,10 @@ var LiveTopItems = NewTopItems()
 const (
 	TopQueriesTodayKey = "top_queries"
 	TopAdsTodayKey     = "top_ads"
+	// The number of domains (or groups of domains) in each top list
+	TopItemsListLength = 10
+	// The number of domains requested for each top list when grouping, so that there are enough to fill its groups
+	GroupedTopItemsAmount = 100
 )
 
 // TopItems stores top permitted domains and top blocked domains (requires authentication to retrieve)
@@ -28,101 +31,148 @@ type TopItems struct {
 	TopQueries map[string]int
 	// Mapping of top blocked DNS domains (ads and/or tracking) and their occurrences
 	TopAds map[string]int
+	// How domains are grouped together in the top lists
+	Grouping domains.Grouping
+	// TopQueries grouped, busiest first. Without grouping, each group holds a single domain
+	TopQueryGroups []domains.DomainGroup
+	// TopAds grouped, busiest first. Without grouping, each group holds a single domain
+	TopAdGroups []domains.DomainGroup
 	// Pretty list version of TopQueries
 	PrettyTopQueries []string
 	// Pretty list version of TopAds
 	PrettyTopAds []string
 }
 
-// A single domain and the number of times it occurs
-type domainOccurrencePair struct {
-	// The domain
-	domain string
-	// The number of times it has occurred
-	occurrence int
-}
-
 // Create a new TopItems instance
 func NewTopItems() *TopItems {
 	return &TopItems{
 		TopQueries:       map[string]int{},
 		TopAds:           map[string]int{},
+		Grouping:         domains.NoGrouping,
 		PrettyTopQueries: []string{},
 		PrettyTopAds:     []string{},
 	}
 }
 
-// Updates a TopItems struct with up to date information
-func (topItems *TopItems) Update(wg *sync.WaitGroup) {
+/*
+Updates a TopItems struct with up to date information, returning an error if the Pi-Hole couldn't be
+reached, its response wasn't a list of top items or its privacy level hides them
+*/
+func (topItems *TopItems) Update(ctx context.Context, wg *sync.WaitGroup) error {
 	if wg != nil {
 		wg.Add(1)
 		defer wg.Done()
 	}
 
-	url := data.LivePiCLIData.FormattedAPIAddress + "?topItems" + "&auth=" + data.LivePiCLIData.APIKey
-	req, err := http.NewRequest("GET", url, nil)
+	// when grouping, more domains are needed to fill the top lists' groups
+	amount := ""
+	if topItems.Amount() != TopItemsListLength {
+		amount = "=" + strconv.Itoa(topItems.Amount())
+	}
+
+	url := data.LivePiCLIData.FormattedAPIAddress + "?topItems" + amount + "&auth=" + data.LivePiCLIData.APIKey
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	res, err := network.HttpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer res.Body.Close()
 
-	parsedBody, _ := ioutil.ReadAll(res.Body)
+	parsedBody, err := readResponse(res, "top items")
+	if err != nil {
+		return err
+	}
+	if err := requireKeys(parsedBody, "top items", TopQueriesTodayKey, TopAdsTodayKey); err != nil {
+		return err
+	}
+
+	// start afresh, as the domains in the top lists change over time
+	topQueries := map[string]int{}
+	topAds := map[string]int{}
 
 	// parse the top queries response
 	_ = jsonparser.ObjectEach(parsedBody, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
-		topItems.TopQueries[string(key)], _ = strconv.Atoi(string(value))
+		topQueries[string(key)], _ = strconv.Atoi(string(value))
 		return nil
 	}, TopQueriesTodayKey)
 
 	// and the same for the top ad networks
 	_ = jsonparser.ObjectEach(parsedBody, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
-		topItems.TopAds[string(key)], _ = strconv.Atoi(string(value))
+		topAds[string(key)], _ = strconv.Atoi(string(value))
 		return nil
 	}, TopAdsTodayKey)
 
+	// the lists are empty rather than missing when the privacy level hides them
+	if len(topQueries) == 0 && len(topAds) == 0 {
+		if err := hiddenByPrivacyLevel(ctx, "top domains", PrivacyLevelHideDomains); err != nil {
+			return err
+		}
+	}
+
+	topItems.Set(topQueries, topAds)
+	return nil
+}
+
+// Replaces the top permitted and blocked domains, i.e. with ones that didn't come from the API
+func (topItems *TopItems) Set(topQueries map[string]int, topAds map[string]int) {
+	topItems.TopQueries = topQueries
+	topItems.TopAds = topAds
 	topItems.prettyConvert()
 }
 
+/*
+The number of domains needed for each top list, which is more than fit in the list when
+grouping so that there are enough to fill its groups
+*/
+func (topItems *TopItems) Amount() int {
+	if topItems.Grouping == domains.RegistrableDomainGrouping {
+		return GroupedTopItemsAmount
+	}
+	return TopItemsListLength
+}
+
 // Convert maps of domain:hits to nice lists that can be displayed
 func (topItems *TopItems) prettyConvert() {
-	var sortedTopQueries []domainOccurrencePair
-	var sortedTopAds []domainOccurrencePair
+	topItems.TopQueryGroups = groupTopItems(topItems.TopQueries, topItems.Grouping)
+	topItems.TopAdGroups = groupTopItems(topItems.TopAds, topItems.Grouping)
 	topItems.PrettyTopQueries = []string{}
 	topItems.PrettyTopAds = []string{}
 
-	for key, value := range topItems.TopQueries {
-		sortedTopQueries = append(sortedTopQueries, domainOccurrencePair{
-			domain:     key,
-			occurrence: value,
-		})
+	for _, group := range topItems.TopQueryGroups {
+		topItems.PrettyTopQueries = append(topItems.PrettyTopQueries, PrettyDomainGroup(group))
+	}
+	for _, group := range topItems.TopAdGroups {
+		topItems.PrettyTopAds = append(topItems.PrettyTopAds, PrettyDomainGroup(group))
 	}
+}
 
-	for key, value := range topItems.TopAds {
-		sortedTopAds = append(sortedTopAds, domainOccurrencePair{
-			domain:     key,
-			occurrence: value,
-		})
+// Groups a map of domain:hits, keeping the busiest groups that fit in a top list
+func groupTopItems(items map[string]int, grouping domains.Grouping) []domains.DomainGroup {
+	var counts []domains.DomainCount
+	for domain, hits := range items {
+		counts = append(counts, domains.DomainCount{Domain: domain, Count: hits})
 	}
 
-	// sort ads and domains by occurrence
-	sort.SliceStable(sortedTopQueries[:], func(i, j int) bool {
-		return sortedTopQueries[i].occurrence > sortedTopQueries[j].occurrence
-	})
-	sort.SliceStable(sortedTopAds[:], func(i, j int) bool {
-		return sortedTopAds[i].occurrence > sortedTopAds[j].occurrence
-	})
-
-	for _, domain := range sortedTopQueries {
-		listEntry := fmt.Sprintf("%d hits | %s", domain.occurrence, domain.domain)
-		topItems.PrettyTopQueries = append(topItems.PrettyTopQueries, listEntry)
+	groups := grouping.Group(counts)
+	if len(groups) > TopItemsListLength {
+		groups = groups[:TopItemsListLength]
 	}
-	for _, domain := range sortedTopAds {
-		listEntry := fmt.Sprintf("%d hits | %s", domain.occurrence, domain.domain)
-		topItems.PrettyTopAds = append(topItems.PrettyTopAds, listEntry)
+	return groups
+}
+
+// Formats a group of domains as an entry in a top list
+func PrettyDomainGroup(group domains.DomainGroup) string {
+	if len(group.Members) == 1 {
+		return PrettyDomainCount(group.Members[0])
 	}
+	return fmt.Sprintf("%d hits | %s (%d domains)", group.Count, group.Domain, len(group.Members))
+}
+
+// Formats a single domain as an entry in a top list
+func PrettyDomainCount(count domains.DomainCount) string {
+	return fmt.Sprintf("%d hits | %s", count.Count, count.Domain)
 }
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+)
+
+// Tests for api.TopItems.Update() with registrable domain grouping
+func TestTopItemsUpdateGrouped(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ensure more domains are requested so that there are enough to fill the groups
+		if !strings.Contains(r.URL.RequestURI(), "/api.php?topItems=100&auth="+testKey) {
+			t.Errorf("@TestTopItemsUpdateGrouped: api.TopItems.Update() requested %s", r.URL.RequestURI())
+		}
+		_, _ = w.Write([]byte(`{
+			"top_queries": {"a.cdn.example.com": 5, "b.cdn.example.com": 7, "example.org": 10},
+			"top_ads": {"ads.tracker.net": 3}
+		}`))
+	}))
+	defer mockServer.Close()
+
+	data.LivePiCLIData.FormattedAPIAddress = mockServer.URL + "/api.php"
+	data.LivePiCLIData.APIKey = testKey
+
+	topItems := NewTopItems()
+	topItems.Grouping = domains.RegistrableDomainGrouping
+	topItems.Update(context.Background(), nil)
+
+	expected := []string{"12 hits | example.com (2 domains)", "10 hits | example.org"}
+	if len(topItems.PrettyTopQueries) != len(expected) {
+		t.Fatalf("@TestTopItemsUpdateGrouped: unexpected top queries %v", topItems.PrettyTopQueries)
+	}
+	for i := range expected {
+		if topItems.PrettyTopQueries[i] != expected[i] {
+			t.Errorf("@TestTopItemsUpdateGrouped: got %q, expected %q", topItems.PrettyTopQueries[i], expected[i])
+		}
+	}
+	if len(topItems.TopQueryGroups[0].Members) != 2 || topItems.PrettyTopAds[0] != "3 hits | ads.tracker.net" {
+		t.Errorf("@TestTopItemsUpdateGrouped: unexpected groups %+v and top ads %v", topItems.TopQueryGroups, topItems.PrettyTopAds)
+	}
+}
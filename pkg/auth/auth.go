@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -14,7 +15,18 @@ import (
 var KeyringService = "PiCLI"
 
 // Keyring User: Required for use in authentication and API key management
-var KeyringUsr = "api-key"
+var KeyringUsr = DefaultKeyringUsr
+
+// The keyring user of the default profile. Other profiles have the profile's name appended
+const DefaultKeyringUsr = "api-key"
+
+// Keeps the API key of a named profile in its own keyring entry. An empty name is the default profile
+func UseProfile(name string) {
+	KeyringUsr = DefaultKeyringUsr
+	if name != "" {
+		KeyringUsr += "-" + name
+	}
+}
 
 // Retrieve the API key from the system keyring
 func RetrieveAPIKeyFromKeyring() string {
@@ -51,8 +63,11 @@ func APIKeyIsInKeyring() bool {
 	return true
 }
 
-// Does an key allow authentication? I.e., is is valid?
-func ValidateAPIKey(url string, key string) bool {
+/*
+Does an key allow authentication? I.e., is is valid? Returns an error if the Pi-Hole couldn't be
+asked, with the key redacted from it.
+*/
+func ValidateAPIKey(ctx context.Context, url string, key string) (bool, error) {
 	/*
 		To test the validity of the API key, we can attempt to enable the Pi-Hole.
 
@@ -69,20 +84,22 @@ func ValidateAPIKey(url string, key string) bool {
 	*/
 
 	queryString := url + "?enable" + "&auth=" + key
-	req, err := http.NewRequest("GET", queryString, nil)
+	// enabling the Pi-Hole changes its state, so the request isn't retried
+	// errors from building or sending the request include the URL, and with it the key
+	req, err := http.NewRequestWithContext(network.WithoutRetries(ctx), "GET", queryString, nil)
 	if err != nil {
-		log.Fatal(err)
+		return false, network.RedactError(err)
 	}
 
 	res, err := network.HttpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return false, network.RedactError(err)
 	}
 	defer res.Body.Close()
 	parsedBody, _ := ioutil.ReadAll(res.Body)
 
 	if _, err := jsonparser.GetString(parsedBody, "status"); err != nil {
-		return false
+		return false, nil
 	}
-	return true
+	return true, nil
 }
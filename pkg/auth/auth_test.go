@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -106,12 +107,24 @@ func TestValidateAPIKey(t *testing.T) {
 	defer mockServer.Close()
 	url := mockServer.URL + "/api.php"
 	// Requests should succeed with the correct API key
-	if !ValidateAPIKey(url, testKey) {
+	if valid, err := ValidateAPIKey(context.Background(), url, testKey); !valid || err != nil {
 		t.Error("@TestValidateAPIKey: auth.ValidateAPIKey() should have received a successful response from the server, but it did not.")
 	}
 
 	// Request should return an empty response with the wrong API key
-	if ValidateAPIKey(url, "test") {
+	if valid, _ := ValidateAPIKey(context.Background(), url, "test"); valid {
 		t.Error("@TestValidateAPIKey: auth.ValidateAPIKey() should have received an empty response from the server as it is looking for the wrong API key.")
 	}
 }
+
+// Tests for auth.ValidateAPIKey() keeping the key out of its errors
+func TestValidateAPIKeyRedactsErrors(t *testing.T) {
+	// a URL that can't be parsed, whose error would otherwise include the whole query string
+	valid, err := ValidateAPIKey(context.Background(), "http://[pi.hole/admin/api.php", testKey)
+	if valid || err == nil {
+		t.Fatal("@TestValidateAPIKeyRedactsErrors: auth.ValidateAPIKey() accepted a URL that can't be parsed")
+	}
+	if strings.Contains(err.Error(), testKey) {
+		t.Errorf("@TestValidateAPIKeyRedactsErrors: the API key was included in the error: %s", err.Error())
+	}
+}
@@ -2,7 +2,6 @@ package cli
 
 import (
 	"fmt"
-	"github.com/Reeceeboii/Pi-CLI/pkg/database"
 	"github.com/Reeceeboii/Pi-CLI/pkg/ui"
 	"github.com/urfave/cli/v2"
 	"time"
@@ -23,11 +22,15 @@ var App = cli.App{
 			Email: "reecemercer981@gmail.com",
 		},
 	},
+	Flags:  globalFlags,
+	Before: applyGlobalFlags,
+	After:  closeDebugging,
 	Commands: []*cli.Command{
 		{
 			Name:    "setup",
 			Aliases: []string{"s"},
 			Usage:   "Configure Pi-CLI",
+			Flags:   setupFlags,
 			Action:  SetupCommand,
 		},
 		{
@@ -45,6 +48,7 @@ var App = cli.App{
 					Name:    "view",
 					Aliases: []string{"v"},
 					Usage:   "View config stored config data (config file and API key)",
+					Flags:   []cli.Flag{showSecretsFlag},
 					Action:  ConfigViewCommand,
 				},
 			},
@@ -64,12 +68,14 @@ var App = cli.App{
 					Name:    "top-forwarded",
 					Aliases: []string{"tf"},
 					Usage:   "Extract the current top 10 forwarded DNS queries",
+					Flags:   []cli.Flag{domainGroupingFlag},
 					Action:  RunTopTenForwardedCommand,
 				},
 				{
 					Name:    "top-blocked",
 					Aliases: []string{"tb"},
 					Usage:   "Extract the current top 10 blocked DNS queries",
+					Flags:   []cli.Flag{domainGroupingFlag},
 					Action:  RunTopTenBlockedCommand,
 				},
 				{
@@ -117,49 +123,211 @@ var App = cli.App{
 					Name:    "client-summary",
 					Aliases: []string{"cs"},
 					Usage:   "Summary of all Pi-Hole clients",
-					Flags: []cli.Flag{
-						&cli.StringFlag{
-							Name:        "path",
-							Aliases:     []string{"p"},
-							Usage:       "Path to a Pi-Hole FTL database file",
-							DefaultText: database.DefaultDatabaseFileLocation,
-						},
-					},
-					Action: RunDatabaseClientSummaryCommand,
+					Flags:   flagGroups(databaseSourceFlags, databaseTimeWindowFlags),
+					Action:  RunDatabaseClientSummaryCommand,
 				},
 				{
 					Name:    "top-queries",
 					Aliases: []string{"tq"},
 					Usage:   "Returns the top (all time) queries",
-					Flags: []cli.Flag{
-						&cli.StringFlag{
-							Name:        "path",
-							Aliases:     []string{"p"},
-							Usage:       "Path to the Pi-Hole FTL database file",
-							DefaultText: database.DefaultDatabaseFileLocation,
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{
+							&cli.Int64Flag{
+								Name:        "limit",
+								Aliases:     []string{"l"},
+								Usage:       "The limit on the number of queries to extract",
+								DefaultText: "10",
+							},
+							databaseDomainFilterFlag,
+							domainGroupingFlag,
 						},
-						&cli.Int64Flag{
-							Name:        "limit",
-							Aliases:     []string{"l"},
-							Usage:       "The limit on the number of queries to extract",
-							DefaultText: "10",
+						databaseTimeWindowFlags,
+					),
+					Action: RunDatabaseTopQueriesCommand,
+				},
+				{
+					Name:    "heatmap",
+					Aliases: []string{"hm"},
+					Usage:   "Query volume by weekday and hour of the day",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{
+							&cli.StringFlag{
+								Name:        "client",
+								Aliases:     []string{"c"},
+								Usage:       "Only include queries from this client, by address or name",
+								DefaultText: "All clients",
+							},
+							databaseDomainFilterFlag,
+							databaseOutputFormatFlag,
 						},
-						&cli.StringFlag{
-							Name:        "filter",
-							Aliases:     []string{"f"},
-							Usage:       "Filter by domain or word. (e.g. 'google.com', 'spotify', 'facebook' etc...)",
-							DefaultText: "No filter",
+						databaseTimeWindowFlags,
+					),
+					Action: RunDatabaseHeatmapCommand,
+				},
+				{
+					Name:    "upstreams",
+					Aliases: []string{"u"},
+					Usage:   "Query counts and reply times for each upstream DNS resolver",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag},
+						databaseTimeWindowFlags,
+					),
+					Action: RunDatabaseUpstreamsCommand,
+				},
+				{
+					Name:    "adlist-effectiveness",
+					Aliases: []string{"ae"},
+					Usage:   "Blocked domains and queries that each adlist was responsible for",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{
+							databaseGravityFlag,
+							databaseOutputFormatFlag,
 						},
-					},
-					Action: RunDatabaseTopQueriesCommand,
+						databaseTimeWindowFlags,
+					),
+					Action: RunDatabaseAdlistEffectivenessCommand,
+				},
+				{
+					Name:    "export",
+					Aliases: []string{"ex"},
+					Usage:   "Export query history as CSV, NDJSON or Parquet",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						databaseExportFlags,
+						databaseTimeWindowFlags,
+					),
+					Action: RunDatabaseExportCommand,
+				},
+				{
+					Name:      "diff",
+					Usage:     "Compare two database snapshots",
+					ArgsUsage: "<old.db> <new.db>",
+					Flags: flagGroups(
+						databaseDiffFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunDatabaseDiffCommand,
+				},
+				{
+					Name:    "anomalies",
+					Aliases: []string{"an"},
+					Usage:   "Flag clients behaving differently to usual, or contacting never before seen domains",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						databaseAnomaliesFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunDatabaseAnomaliesCommand,
+				},
+				{
+					Name:    "suspicious-domains",
+					Aliases: []string{"sd"},
+					Usage:   "Domains that look like DNS tunnelling or algorithmically generated domains, by client",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						databaseTimeWindowFlags,
+						databaseSuspiciousDomainsFlags,
+						[]cli.Flag{databaseOutputFormatFlag},
+					),
+					Action: RunDatabaseSuspiciousDomainsCommand,
+				},
+				{
+					Name:      "sql",
+					Usage:     "Run a read-only SQL query against the database",
+					ArgsUsage: "\"<query>\"",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunDatabaseSQLCommand,
+				},
+				{
+					Name:  "shell",
+					Usage: "Interactive read-only SQL shell for the database",
+					Flags: flagGroups(
+						databaseSourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunDatabaseShellCommand,
+				},
+			},
+		},
+		{
+			Name:   "replay",
+			Usage:  "Replay the history in an FTL database through the live UI",
+			Flags:  replayFlags,
+			Action: RunReplayCommand,
+		},
+		{
+			Name:    "gravity",
+			Aliases: []string{"g"},
+			Usage:   "Analytics options to run on a Pi-Hole's gravity database (adlists, domains, groups and clients)",
+			Subcommands: []*cli.Command{
+				{
+					Name:    "adlists",
+					Aliases: []string{"al"},
+					Usage:   "Size, status and group assignments of each adlist",
+					Flags: flagGroups(
+						gravitySourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunGravityAdlistsCommand,
+				},
+				{
+					Name:    "duplicates",
+					Aliases: []string{"dup"},
+					Usage:   "Domains that appear in more than one adlist",
+					Flags: flagGroups(
+						gravitySourceFlags,
+						[]cli.Flag{
+							&cli.IntFlag{
+								Name:        "limit",
+								Aliases:     []string{"l"},
+								Usage:       "The limit on the number of duplicated domains to list",
+								DefaultText: "10",
+							},
+							databaseOutputFormatFlag,
+							databaseTimezoneFlag,
+						},
+					),
+					Action: RunGravityDuplicatesCommand,
+				},
+				{
+					Name:    "groups",
+					Aliases: []string{"gr"},
+					Usage:   "Groups and the adlists, domains and clients assigned to them",
+					Flags: flagGroups(
+						gravitySourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunGravityGroupsCommand,
+				},
+				{
+					Name:    "problems",
+					Aliases: []string{"pr"},
+					Usage:   "Entries that are disabled, invalid or not doing anything",
+					Flags: flagGroups(
+						gravitySourceFlags,
+						[]cli.Flag{databaseOutputFormatFlag, databaseTimezoneFlag},
+					),
+					Action: RunGravityProblemsCommand,
 				},
 			},
 		},
 	},
 
-	Action: func(context *cli.Context) error {
+	Action: func(c *cli.Context) error {
+		// the live view draws over the terminal, so debug logs have to go somewhere else
+		if debugLogFile == nil && c.Bool("debug") {
+			if err := moveDebugLogToFile(); err != nil {
+				return err
+			}
+		}
 		InitialisePICLI()
-		ui.StartUI()
-		return nil
+		return ui.StartUI(c.Context, ui.NewLiveSource())
 	},
 }
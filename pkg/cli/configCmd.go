@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/auth"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 	"os/exec"
+	"strings"
 )
 
 /*
@@ -31,36 +33,75 @@ func ConfigDeleteCommand(*cli.Context) error {
 /*
 	Displays any saved configuration data to the user.
 	If a config file is present, that can be loaded and displayed,
-	otherwise, the user can be prompted to create one.
+	otherwise, the user can be prompted to create one. Secrets are masked unless --show-secrets
+	is given.
 */
-func ConfigViewCommand(*cli.Context) error {
+func ConfigViewCommand(c *cli.Context) error {
+	if c.Bool("show-secrets") {
+		network.ShowSecrets = true
+	}
 	/*
-		- Pi-Hole IP address
-		- Pi-Hole port
+		- Pi-Hole URL
 		- Data refresh rate
+		- TLS options
+		- Retry options
+		- Proxy options
 	*/
 	if data.ConfigFileExists() {
 		// Display the location of the config file in the filesystem
 		color.Green("Config location: %s\n", data.GetConfigFileLocation())
+		if data.Profile != "" {
+			fmt.Printf("Profile: %s\n", data.Profile)
+		}
 
 		// Open the config file so we can extract data from it
 		data.PICLISettings.LoadFromFile()
-		fmt.Printf("Pi-Hole address: %s\n", data.PICLISettings.PiHoleAddress)
-		fmt.Printf("Pi-Hole port: %d\n", data.PICLISettings.PiHolePort)
+		fmt.Printf("Pi-Hole URL: %s\n", data.PICLISettings.PiHoleURL)
 		fmt.Printf("Refresh rate: %ds\n", data.PICLISettings.RefreshS)
+		if tlsOptions := data.PICLISettings.TLS; tlsOptions.IsSet() {
+			fmt.Printf("TLS CA bundle: %s\n", tlsOptions.CAFile)
+			fmt.Printf("TLS client certificate: %s (key %s)\n", tlsOptions.CertFile, tlsOptions.KeyFile)
+			fmt.Printf("TLS server name: %s\n", tlsOptions.ServerName)
+			fmt.Printf("TLS pinned SHA-256 fingerprints: %s\n", strings.Join(tlsOptions.PinnedSHA256, ", "))
+			if tlsOptions.InsecureSkipVerify {
+				color.Red("TLS certificate verification: disabled (insecure)")
+			}
+		}
+		if retry := data.PICLISettings.Retry; retry != nil {
+			fmt.Printf("Retry options: %+v\n", *retry)
+		}
+		if proxy := data.PICLISettings.Proxy; proxy.IsSet() {
+			// the proxy's password isn't shown
+			if proxyURL, err := network.ParseProxyURL(proxy.URL); err == nil && proxyURL != nil && !network.ShowSecrets {
+				fmt.Printf("Proxy: %s\n", proxyURL.Redacted())
+			} else if proxy.URL != "" {
+				fmt.Printf("Proxy: %s\n", proxy.URL)
+			}
+			if tunnel := proxy.SSHTunnel; tunnel != nil {
+				fmt.Printf("SSH jump host: %s\n", tunnel.Host)
+				if tunnel.User != "" {
+					fmt.Printf("SSH user: %s\n", tunnel.User)
+				}
+				fmt.Printf("SSH identity file: %s\n", tunnel.IdentityFile)
+				fmt.Printf("SSH known hosts file: %s\n", tunnel.KnownHostsFile)
+			}
+		}
 	} else {
 		color.Yellow("No config file is present - run the setup command to create one")
 	}
 
 	// and the same with the API key
 	if auth.APIKeyIsInKeyring() {
-		fmt.Printf("API key (keyring): %s\n", auth.RetrieveAPIKeyFromKeyring())
+		fmt.Printf("API key (keyring): %s\n", network.MaskSecret(auth.RetrieveAPIKeyFromKeyring()))
 	} else if data.PICLISettings.APIKeyIsInFile() {
-		fmt.Printf("API key (config file): %s\n", data.PICLISettings.APIKey)
+		fmt.Printf("API key (config file): %s\n", network.MaskSecret(data.PICLISettings.APIKey))
 	} else {
 		color.Yellow("No API key has been provided - run the setup command to enter it")
 	}
 
+	// where the user can give their clients names
+	fmt.Printf("Client alias file: %s\n", data.GetClientAliasFileLocation())
+
 	_ = exec.Command(data.GetConfigFileLocation()).Run()
 
 	return nil
@@ -1,8 +1,20 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
 	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
 )
 
 /*
@@ -10,34 +22,422 @@ import (
 		If no path is provided by the user, Pi-CLI will assume that the database file's
 		name hasn't been changed from it's default name, and that is has been placed in the
 		same working directory that it is being executed from. This saves some command typing.
+
+		All database commands can also be constrained to a window of time via the --since,
+		--until and --last flags, and can have their timestamps outputted in a given timezone
+		via the --tz flag.
+
+		Rather than a local path, a remote Pi-Hole can be given via --remote. A snapshot of its
+		database is pulled over SSH and cached locally, and the command runs against that.
 */
 
 /*
 	Extracts a summary of data regarding the Pi-Hole's clients
 */
 func RunDatabaseClientSummaryCommand(c *cli.Context) error {
-	path := c.String("path")
-	if path == "" {
-		path = database.DefaultDatabaseFileLocation
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
 	}
 
-	conn := database.Connect(path)
-	database.ClientSummary(conn)
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
 
-	return nil
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	return database.ClientSummary(conn, window)
 }
 
 /*
 	Extracts all time top query data from the database file.
 */
 func RunDatabaseTopQueriesCommand(c *cli.Context) error {
-	path := c.String("path")
-	if path == "" {
-		path = database.DefaultDatabaseFileLocation
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	grouping, err := domains.ParseGrouping(c.String("group"))
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	return database.TopQueries(conn, c.Int64("limit"), c.String("filter"), window, grouping)
+}
+
+/*
+	Aggregates query volume into a weekday/hour heatmap
+*/
+func RunDatabaseHeatmapCommand(c *cli.Context) error {
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	heatmap, err := database.QueryHeatmap(conn, window, c.String("client"), c.String("filter"))
+	if err != nil {
+		return err
+	}
+
+	heatmap.Print(format)
+	return nil
+}
+
+/*
+	Reports on the performance of each upstream DNS resolver
+*/
+func RunDatabaseUpstreamsCommand(c *cli.Context) error {
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	report, err := database.Upstreams(conn, window)
+	if err != nil {
+		return err
+	}
+
+	report.Print(format)
+	return nil
+}
+
+/*
+	Reports on how many blocked queries each adlist was responsible for, by joining the FTL
+	database with the gravity database
+*/
+func RunDatabaseAdlistEffectivenessCommand(c *cli.Context) error {
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	gravityPath, err := gravityPathForDatabaseCommand(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	report, err := database.AdlistEffectiveness(conn, gravityPath, window)
+	if err != nil {
+		return err
+	}
+
+	report.Print(format)
+	return nil
+}
+
+/*
+	Exports the queries table to a file (or stdout) as CSV, NDJSON or Parquet. Progress is
+	reported on stderr when exporting to a file.
+*/
+func RunDatabaseExportCommand(c *cli.Context) (err error) {
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	outputPath := c.String("output")
+	format, err := database.ParseExportFormat(c.String("format"), outputPath)
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+
+	if outputPath == "" || outputPath == "-" {
+		_, err = database.ExportQueries(conn, os.Stdout, format, window, database.DefaultExportChunkSize, nil)
+		return err
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		// don't leave a partial export behind
+		if err != nil {
+			_ = os.Remove(outputPath)
+		}
+	}()
+
+	localisedNumberWriter := message.NewPrinter(language.English)
+	progress := func(exported int64, total int64) {
+		percentage := 100.0
+		if total > 0 {
+			percentage = float64(exported) / float64(total) * 100
+		}
+		_, _ = localisedNumberWriter.Fprintf(
+			os.Stderr,
+			"\rExported %d of %d queries (%.0f%%)",
+			exported,
+			total,
+			percentage)
+	}
+
+	exported, err := database.ExportQueries(conn, file, format, window, database.DefaultExportChunkSize, progress)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	color.Green("Exported %s queries to %s (%s)", localisedNumberWriter.Sprintf("%d", exported), outputPath, format)
+	return nil
+}
+
+/*
+	Compares two FTL database snapshots, given as arguments
+*/
+func RunDatabaseDiffCommand(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("expected two database snapshots to compare, i.e. 'picli database diff old.db new.db'")
+	}
+
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+	if format == database.CSVOutput {
+		return errors.New("diff supports text and json output")
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	oldConn := database.Connect(c.Args().Get(0))
+	newConn := database.Connect(c.Args().Get(1))
+
+	diff, err := database.DiffSnapshots(oldConn, newConn, c.Duration("period"), c.Int("limit"))
+	if err != nil {
+		return err
+	}
+
+	diff.Print(format)
+	return nil
+}
+
+/*
+	Flags clients whose recent behaviour deviates from their history, and clients contacting
+	domains that have never been seen on the network before
+*/
+func RunDatabaseAnomaliesCommand(c *cli.Context) error {
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+	if format == database.CSVOutput {
+		return errors.New("anomalies supports text and json output")
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
 	}
 
 	conn := database.Connect(path)
-	database.TopQueries(conn, c.Int64("limit"), c.String("filter"))
+	report, err := database.Anomalies(
+		conn,
+		c.Duration("recent"),
+		c.Duration("baseline"),
+		c.Float64("threshold"),
+		c.Int("limit"))
+	if err != nil {
+		return err
+	}
 
+	report.Print(format)
 	return nil
 }
+
+/*
+	Scores the domains queried by each client, listing those that look like DNS tunnelling or
+	algorithmically generated domains
+*/
+func RunDatabaseSuspiciousDomainsCommand(c *cli.Context) error {
+	window, err := timeWindowFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.Connect(path)
+	report, err := database.SuspiciousDomains(conn, window, c.Float64("min-score"), c.Int("limit"))
+	if err != nil {
+		return err
+	}
+
+	report.Print(format)
+	return nil
+}
+
+/*
+	Loads the names known for clients outside of the database (aliases and DHCP leases), so that
+	database reports label clients in the same way as the live UI. Every database command that
+	reports on clients calls this before reading the database.
+*/
+func loadKnownClientNames() error {
+	knownClientNames, err := data.LoadClientNames(clients.DefaultLeaseFileLocation)
+	if err != nil {
+		return err
+	}
+	database.KnownClientNames = knownClientNames
+	return nil
+}
+
+// Returns the path to the FTL database that a command should run against
+func databasePathFromFlags(c *cli.Context) (string, error) {
+	return sourcePathFromFlags(c, database.DefaultDatabaseFileLocation, database.DefaultRemoteDatabaseLocation)
+}
+
+/*
+	Returns the path to the gravity database used by database commands that also need it. If
+	it isn't given via --gravity and a remote is being used, it's pulled from the same remote,
+	out of the same directory as the FTL database.
+*/
+func gravityPathForDatabaseCommand(c *cli.Context) (string, error) {
+	if gravityPath := c.String("gravity"); gravityPath != "" {
+		return gravityPath, nil
+	}
+
+	if remote := c.String("remote"); remote != "" {
+		remoteDatabase, err := database.ParseRemoteDatabase(remote, database.DefaultRemoteDatabaseLocation)
+		if err != nil {
+			return "", err
+		}
+		gravityDatabase := remoteDatabase.Sibling(path.Base(database.DefaultRemoteGravityLocation))
+		return gravityDatabase.Snapshot(c.Duration("max-age"), c.Bool("refresh"))
+	}
+
+	return database.DefaultGravityFileLocation, nil
+}
+
+/*
+	Returns the path to the database that a command should run against. If a remote has been
+	given, this is the path to a local snapshot of the remote database. Otherwise, it's the path
+	given by the user, or the default path if one wasn't given
+*/
+func sourcePathFromFlags(c *cli.Context, defaultPath string, defaultRemotePath string) (string, error) {
+	if remote := c.String("remote"); remote != "" {
+		if c.IsSet("path") {
+			return "", errors.New("--path and --remote cannot be used together")
+		}
+		remoteDatabase, err := database.ParseRemoteDatabase(remote, defaultRemotePath)
+		if err != nil {
+			return "", err
+		}
+		return remoteDatabase.Snapshot(c.Duration("max-age"), c.Bool("refresh"))
+	}
+
+	path := c.String("path")
+	if path == "" {
+		path = defaultPath
+	}
+	return path, nil
+}
+
+/*
+	Builds a time window from the --since, --until and --last flags. The --tz flag is
+	applied first so that any absolute times are parsed in the user's chosen timezone.
+*/
+func timeWindowFromFlags(c *cli.Context) (*database.TimeWindow, error) {
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return nil, err
+	}
+	return database.NewTimeWindow(c.String("since"), c.String("until"), c.String("last"), time.Now())
+}
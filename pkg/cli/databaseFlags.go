@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+	"github.com/urfave/cli/v2"
+)
+
+// Flags shared by all of the database subcommands, telling them where to find the FTL database
+var databaseSourceFlags = sourceFlags("Path to the Pi-Hole FTL database file", database.DefaultDatabaseFileLocation)
+
+// Flags shared by all of the gravity subcommands, telling them where to find the gravity database
+var gravitySourceFlags = sourceFlags("Path to the Pi-Hole gravity database file", database.DefaultGravityFileLocation)
+
+/*
+	Flags shared by all of the database subcommands, allowing the rows they analyse
+	to be constrained to a window of time
+*/
+var databaseTimeWindowFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:        "since",
+		Usage:       "Only include queries from this time onwards. (e.g. '7d', '2021-02-05', '2021-02-05 18:00')",
+		DefaultText: "Beginning of database",
+	},
+	&cli.StringFlag{
+		Name:        "until",
+		Usage:       "Only include queries up until this time. Accepts the same formats as --since",
+		DefaultText: "Now",
+	},
+	&cli.StringFlag{
+		Name:  "last",
+		Usage: "Only include queries from the last given duration. (e.g. '30m', '12h', '7d', '2w')",
+	},
+	databaseTimezoneFlag,
+}
+
+// Flag allowing database subcommands to parse and display times in a given timezone
+var databaseTimezoneFlag = &cli.StringFlag{
+	Name:        "tz",
+	Usage:       "Timezone used to parse and display times. (e.g. 'UTC', 'Europe/London')",
+	DefaultText: "Local",
+}
+
+// Flag allowing database subcommands to output their results in a machine readable format
+var databaseOutputFormatFlag = &cli.StringFlag{
+	Name:        "format",
+	Aliases:     []string{"o"},
+	Usage:       "Output format: text, csv or json",
+	DefaultText: "text",
+}
+
+// Flags used by the database export command
+var databaseExportFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:        "format",
+		Aliases:     []string{"o"},
+		Usage:       "Export format: csv, ndjson or parquet",
+		DefaultText: "inferred from the output file's extension, or csv",
+	},
+	&cli.StringFlag{
+		Name:        "output",
+		Aliases:     []string{"out"},
+		Usage:       "File to export to, or '-' for stdout",
+		DefaultText: "stdout",
+	},
+}
+
+// Flags used by the database diff command
+var databaseDiffFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:        "period",
+		Usage:       "How much of each snapshot's most recent activity to compare (0 compares their entire histories)",
+		Value:       database.DefaultDiffPeriod,
+		DefaultText: "24h",
+	},
+	&cli.IntFlag{
+		Name:        "limit",
+		Aliases:     []string{"l"},
+		Usage:       "The limit on the number of domains listed for each kind of change",
+		DefaultText: "10",
+	},
+}
+
+// Flags used by the database anomalies command
+var databaseAnomaliesFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:        "recent",
+		Usage:       "How much of the most recent activity to check for anomalies",
+		Value:       database.DefaultAnomalyRecentPeriod,
+		DefaultText: "24h",
+	},
+	&cli.DurationFlag{
+		Name:        "baseline",
+		Usage:       "How much history before the recent activity to build each client's baseline from",
+		Value:       database.DefaultAnomalyBaselinePeriod,
+		DefaultText: "336h (14 days)",
+	},
+	&cli.Float64Flag{
+		Name:        "threshold",
+		Aliases:     []string{"z"},
+		Usage:       "How many standard deviations from a client's baseline counts as an anomaly",
+		Value:       database.DefaultAnomalyThreshold,
+		DefaultText: "3",
+	},
+	&cli.IntFlag{
+		Name:        "limit",
+		Aliases:     []string{"l"},
+		Usage:       "The limit on the number of never before seen domains to list",
+		DefaultText: "10",
+	},
+}
+
+// Flags used by the database suspicious-domains command
+var databaseSuspiciousDomainsFlags = []cli.Flag{
+	&cli.Float64Flag{
+		Name:        "min-score",
+		Usage:       "The score out of 100 that a domain needs to be listed",
+		Value:       domains.SuspicionThreshold,
+		DefaultText: "50",
+	},
+	&cli.IntFlag{
+		Name:        "limit",
+		Aliases:     []string{"l"},
+		Usage:       "The limit on the number of suspicious domains to list for each client",
+		DefaultText: "5",
+	},
+}
+
+/*
+	Flags used by the replay command. The database can also be given via --db, which reads
+	more naturally for a command that isn't under the database subcommand
+*/
+var replayFlags = flagGroups(
+	replaySourceFlags(),
+	[]cli.Flag{
+		&cli.StringFlag{
+			Name:        "from",
+			Usage:       "The point in the database's history to start replaying from. (e.g. '2d', '2021-02-05 18:00')",
+			DefaultText: "First query in the database",
+		},
+		&cli.StringFlag{
+			Name:  "speed",
+			Usage: "How many times faster than real time to play back. (e.g. '1x', '10x', '60')",
+			Value: "1x",
+		},
+		databaseTimezoneFlag,
+	},
+)
+
+// Creates the FTL database source flags used by the replay command, with --db as an alias of --path
+func replaySourceFlags() []cli.Flag {
+	flags := sourceFlags("Path to the Pi-Hole FTL database file to replay", database.DefaultDatabaseFileLocation)
+	path := flags[0].(*cli.StringFlag)
+	path.Aliases = append([]string{"db"}, path.Aliases...)
+	return flags
+}
+
+// Flag allowing database subcommands that also need the gravity database to find it
+var databaseGravityFlag = &cli.StringFlag{
+	Name:        "gravity",
+	Aliases:     []string{"g"},
+	Usage:       "Path to the Pi-Hole gravity database file (pulled from --remote if one is given)",
+	DefaultText: database.DefaultGravityFileLocation,
+}
+
+// Flag allowing database subcommands to only include domains matching a filter
+var databaseDomainFilterFlag = &cli.StringFlag{
+	Name:        "filter",
+	Aliases:     []string{"f"},
+	Usage:       "Filter by domain or word. (e.g. 'google.com', 'spotify', 'facebook' etc...)",
+	DefaultText: "No filter",
+}
+
+// Flag allowing commands that list top domains to roll them up to their registrable domain
+var domainGroupingFlag = &cli.StringFlag{
+	Name:        "group",
+	Usage:       "Group domains: none, or etld1 to roll them up to their registrable domain (a.cdn.example.com -> example.com)",
+	DefaultText: "none",
+}
+
+/*
+	Creates the flags used to tell a command where to find a database file. This is either a
+	local path, or a remote Pi-Hole that a snapshot of the database can be pulled from over SSH
+*/
+func sourceFlags(pathUsage string, defaultPath string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "path",
+			Aliases:     []string{"p"},
+			Usage:       pathUsage,
+			DefaultText: defaultPath,
+		},
+		&cli.StringFlag{
+			Name:  "remote",
+			Usage: "Pull a snapshot of the database from a Pi-Hole over SSH. (e.g. 'pi@192.168.1.2', 'pi@pihole:/path/to/file.db')",
+		},
+		&cli.DurationFlag{
+			Name:        "max-age",
+			Usage:       "How old a cached remote snapshot can be before a new one is pulled",
+			Value:       database.DefaultSnapshotMaxAge,
+			DefaultText: database.DefaultSnapshotMaxAge.String(),
+		},
+		&cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "Always pull a new remote snapshot, even if the cached one is fresh enough",
+		},
+	}
+}
+
+// Joins groups of flags together, allowing commands to mix shared flags with their own
+func flagGroups(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+	return flags
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+/*
+	Commands understood by the interactive database shell, on top of regular SQL statements.
+	Like the sqlite3 CLI, these are prefixed with a dot and don't need a trailing semicolon.
+*/
+var databaseShellHelp = []string{
+	".tables            List the tables and views in the database",
+	".schema <name>     Show the SQL used to create a table or view",
+	".views             List the helper views provided by Pi-CLI",
+	".format <format>   Change the output format (text, csv or json)",
+	".help              Show this help",
+	".quit              Exit the shell",
+}
+
+/*
+	Runs a single SQL query against a read-only copy of the database connection
+*/
+func RunDatabaseSQLCommand(c *cli.Context) error {
+	query := strings.TrimSpace(strings.Join(c.Args().Slice(), " "))
+	if query == "" {
+		return fmt.Errorf("please provide a query, e.g. picli database sql \"SELECT * FROM queries LIMIT 10\"")
+	}
+
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.ConnectReadOnly(path)
+	return database.RunSQL(conn, query, format)
+}
+
+/*
+	Starts an interactive SQL shell against a read-only connection to the database.
+	Statements can span multiple lines and are ran once a line ends with a semicolon.
+*/
+func RunDatabaseShellCommand(c *cli.Context) error {
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	conn := database.ConnectReadOnly(path)
+
+	color.Green("Connected to %s (read-only)", path)
+	fmt.Println("Enter SQL statements terminated with a ';', or '.help' for more commands")
+
+	reader := bufio.NewReader(os.Stdin)
+	var statement strings.Builder
+
+	for {
+		if statement.Len() == 0 {
+			fmt.Print("picli> ")
+		} else {
+			fmt.Print("   ...> ")
+		}
+
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+
+		// EOF (Ctrl-D) ends the session
+		if err != nil && trimmed == "" {
+			fmt.Println()
+			return nil
+		}
+
+		// dot commands are only recognised at the start of a statement
+		if statement.Len() == 0 && strings.HasPrefix(trimmed, ".") {
+			if quit := runDatabaseShellDotCommand(conn, trimmed, &format); quit {
+				return nil
+			}
+			continue
+		}
+
+		statement.WriteString(line)
+		if !strings.HasSuffix(trimmed, ";") && err == nil {
+			continue
+		}
+
+		if query := strings.TrimSpace(statement.String()); query != ";" {
+			if err := database.RunSQL(conn, query, format); err != nil {
+				color.Red("Error: %s", err.Error())
+			}
+		}
+		statement.Reset()
+	}
+}
+
+// Runs one of the shell's dot commands. Returns true if the shell should exit
+func runDatabaseShellDotCommand(conn *sql.DB, command string, format *database.OutputFormat) bool {
+	fields := strings.Fields(command)
+	argument := ""
+	if len(fields) > 1 {
+		argument = fields[1]
+	}
+
+	var err error
+
+	switch fields[0] {
+	case ".quit", ".exit":
+		return true
+	case ".help":
+		for _, line := range databaseShellHelp {
+			fmt.Println(line)
+		}
+	case ".tables":
+		err = database.RunSQL(conn, `
+			SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view')
+			UNION ALL
+			SELECT name, 'temp view' FROM sqlite_temp_master WHERE type = 'view'
+			ORDER BY name
+		`, *format)
+	case ".schema":
+		if argument == "" {
+			color.Yellow("Usage: .schema <name>")
+			break
+		}
+		err = database.RunSQL(conn, fmt.Sprintf(`
+			SELECT sql FROM sqlite_master WHERE name = '%[1]s'
+			UNION ALL
+			SELECT sql FROM sqlite_temp_master WHERE name = '%[1]s'
+		`, strings.ReplaceAll(argument, "'", "''")), database.TextOutput)
+	case ".views":
+		for _, view := range database.ConsoleHelperViews {
+			fmt.Printf("%-18s %s\n", view.Name, view.Description)
+		}
+		fmt.Println()
+		fmt.Println("Helper functions: status_name(status), type_name(type), is_blocked(status), human_time(timestamp)")
+	case ".format":
+		parsed, parseErr := database.ParseOutputFormat(argument)
+		if parseErr != nil || argument == "" {
+			color.Yellow("Usage: .format text|csv|json")
+			break
+		}
+		*format = parsed
+		color.Green("Output format: %s", parsed)
+	default:
+		color.Yellow("Unknown command '%s', try .help", fields[0])
+	}
+
+	if err != nil {
+		color.Red("Error: %s", err.Error())
+	}
+	return false
+}
@@ -10,14 +10,21 @@ import (
 /*
 Enable the Pi-Hole if it is not already enabled,
 */
-func RunEnablePiHoleCommand(*cli.Context) error {
+func RunEnablePiHoleCommand(c *cli.Context) error {
 	InitialisePICLI()
-	api.LiveSummary.Update(data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil)
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
+
+	if err := api.LiveSummary.Update(ctx, data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil); err != nil {
+		return requestError(err)
+	}
 
 	if api.LiveSummary.Status == "enabled" {
 		color.Yellow("Pi-Hole is already enabled!")
 	} else {
-		api.EnablePiHole()
+		if err := api.EnablePiHole(ctx); err != nil {
+			return requestError(err)
+		}
 		color.Green("Pi-Hole enabled")
 	}
 
@@ -31,17 +38,26 @@ time period has elapsed
 */
 func RunDisablePiHoleCommand(c *cli.Context) error {
 	InitialisePICLI()
-	api.LiveSummary.Update(data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil)
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
+
+	if err := api.LiveSummary.Update(ctx, data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil); err != nil {
+		return requestError(err)
+	}
 
 	if api.LiveSummary.Status == "disabled" {
 		color.Yellow("Pi-Hole is already disabled!")
 	} else {
 		timeout := c.Int64("timeout")
 		if timeout == 0 {
-			api.DisablePiHole(false, 0)
+			if err := api.DisablePiHole(ctx, false, 0); err != nil {
+				return requestError(err)
+			}
 			color.Green("Pi-Hole disabled until explicitly re-enabled")
 		} else {
-			api.DisablePiHole(true, timeout)
+			if err := api.DisablePiHole(ctx, true, timeout); err != nil {
+				return requestError(err)
+			}
 			color.Green("Pi-Hole disabled. Will re-enable in %d seconds\n", timeout)
 		}
 	}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/auth"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+// Reveals secrets (i.e. the API key) that are otherwise redacted from output and errors
+var showSecretsFlag = &cli.BoolFlag{
+	Name:  "show-secrets",
+	Usage: "Show secrets such as the API key, rather than redacting them",
+}
+
+// Flags that apply to every command, given before the command's name
+var globalFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "profile",
+		Usage:   "Use a named profile, which has its own config file and API key (i.e. to manage more than one Pi-Hole)",
+		EnvVars: []string{data.ProfileEnvVar},
+	},
+	showSecretsFlag,
+	&cli.BoolFlag{
+		Name:    "debug",
+		Usage:   "Log every request to the Pi-Hole (URL, status, latency and response body) to stderr, or to a temporary file while the live view is shown",
+		EnvVars: []string{"PICLI_DEBUG"},
+	},
+	&cli.StringFlag{
+		Name:    "debug-file",
+		Usage:   "Log every request to the Pi-Hole to this file, rather than stderr (implies --debug)",
+		EnvVars: []string{"PICLI_DEBUG_FILE"},
+	},
+	&cli.StringFlag{
+		Name:  "dump-har",
+		Usage: "Record every request to the Pi-Hole in a HAR file at this path, i.e. to attach to a bug report",
+	},
+}
+
+// The file that debug logs are written to, if --debug-file was given or the live view moved them
+var debugLogFile *os.File
+
+// Was the debug log file created to keep the logs away from the live view, rather than given?
+var debugLogFileCreated bool
+
+// Applies the global flags before any command is ran
+func applyGlobalFlags(c *cli.Context) error {
+	if err := data.UseProfile(c.String("profile")); err != nil {
+		return err
+	}
+	auth.UseProfile(c.String("profile"))
+	network.ShowSecrets = c.Bool("show-secrets")
+
+	var logTo io.Writer
+	if c.IsSet("debug-file") {
+		file, err := os.OpenFile(c.String("debug-file"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open the debug log file: %s", err.Error())
+		}
+		debugLogFile = file
+		logTo = file
+	} else if c.Bool("debug") {
+		logTo = os.Stderr
+	}
+
+	if logTo == nil && c.String("dump-har") == "" {
+		return nil
+	}
+	return network.ConfigureTracing(network.NewTracer(logTo, c.String("dump-har")))
+}
+
+/*
+	Moves debug logs from stderr to a temporary file, as the live view draws over the terminal
+	and would be drawn over by them in turn. The file's location is shown before the live view
+	starts and again once it has finished.
+*/
+func moveDebugLogToFile() error {
+	file, err := os.CreateTemp("", "picli-debug-*.log")
+	if err != nil {
+		return fmt.Errorf("failed to create a file for the debug logs: %s", err.Error())
+	}
+	debugLogFile = file
+	debugLogFileCreated = true
+	network.ActiveTracer.LogTo(file)
+	color.Yellow("Debug logs are being written to %s", file.Name())
+	return nil
+}
+
+// Writes out the HAR file and closes the debug log file once a command has finished, if they were used
+func closeDebugging(*cli.Context) error {
+	if err := network.ActiveTracer.Close(); err != nil {
+		return err
+	}
+	if debugLogFile == nil {
+		return nil
+	}
+	if debugLogFileCreated {
+		color.Yellow("Debug logs were written to %s", debugLogFile.Name())
+	}
+	return debugLogFile.Close()
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"database/sql"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+	"github.com/urfave/cli/v2"
+)
+
+/*
+	FOR ALL GRAVITY COMMANDS:
+		Like the database commands, if no path is provided by the user, Pi-CLI will assume that
+		the gravity database file is named gravity.db and is in the current working directory.
+		A remote Pi-Hole can also be given via --remote.
+*/
+
+/*
+	Lists every adlist, its size, status and group assignments
+*/
+func RunGravityAdlistsCommand(c *cli.Context) error {
+	format, conn, err := gravityCommandSetup(c)
+	if err != nil {
+		return err
+	}
+
+	adlists, err := database.Adlists(conn)
+	if err != nil {
+		return err
+	}
+
+	database.PrintAdlists(adlists, format)
+	return nil
+}
+
+/*
+	Reports on how much the adlists overlap with each other
+*/
+func RunGravityDuplicatesCommand(c *cli.Context) error {
+	format, conn, err := gravityCommandSetup(c)
+	if err != nil {
+		return err
+	}
+
+	report, err := database.GravityDuplicates(conn, c.Int("limit"))
+	if err != nil {
+		return err
+	}
+
+	report.Print(format)
+	return nil
+}
+
+/*
+	Lists every group and what is assigned to it
+*/
+func RunGravityGroupsCommand(c *cli.Context) error {
+	format, conn, err := gravityCommandSetup(c)
+	if err != nil {
+		return err
+	}
+
+	groups, err := database.Groups(conn)
+	if err != nil {
+		return err
+	}
+
+	database.PrintGroups(groups, format)
+	return nil
+}
+
+/*
+	Lists entries that are disabled, invalid, or otherwise not doing anything
+*/
+func RunGravityProblemsCommand(c *cli.Context) error {
+	format, conn, err := gravityCommandSetup(c)
+	if err != nil {
+		return err
+	}
+
+	problems, err := database.GravityProblems(conn)
+	if err != nil {
+		return err
+	}
+
+	database.PrintGravityProblems(problems, format)
+	return nil
+}
+
+// Parses the flags shared by all gravity commands and connects to the gravity database
+func gravityCommandSetup(c *cli.Context) (database.OutputFormat, *sql.DB, error) {
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return "", nil, err
+	}
+
+	format, err := database.ParseOutputFormat(c.String("format"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	path, err := sourcePathFromFlags(c, database.DefaultGravityFileLocation, database.DefaultRemoteGravityLocation)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return format, database.Connect(path), nil
+}
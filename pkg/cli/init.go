@@ -1,28 +1,63 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Reeceeboii/Pi-CLI/pkg/api"
 	"github.com/Reeceeboii/Pi-CLI/pkg/auth"
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
 	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
 	"os"
+	"os/signal"
 )
 
 /*
 	Validate that the config file and API key are in place.
-	Load the required settings into memory
+	Load the required settings into memory. The Pi-Hole's URL and API key can be overridden with
+	the PICLI_ADDRESS and PICLI_API_KEY environment variables, and when both are set, a config
+	file isn't needed at all.
 */
 func InitialisePICLI() {
+	addressFromEnv := os.Getenv(data.AddressEnvVar)
+	apiKeyFromEnv := os.Getenv(data.APIKeyEnvVar)
+
 	// firstly, has a config file been created?
-	if !data.ConfigFileExists() {
-		color.Red("Please configure Pi-CLI via the 'setup' command")
+	if data.ConfigFileExists() {
+		data.PICLISettings.LoadFromFile()
+	} else if addressFromEnv == "" || apiKeyFromEnv == "" {
+		color.Red("Please configure Pi-CLI via the 'setup' command, or set %s and %s", data.AddressEnvVar, data.APIKeyEnvVar)
 		os.Exit(1)
 	}
 
-	data.PICLISettings.LoadFromFile()
+	if addressFromEnv != "" {
+		piHoleURL, err := network.ParseBaseURL(addressFromEnv)
+		if err != nil {
+			color.Red("Invalid %s: %s", data.AddressEnvVar, err.Error())
+			os.Exit(1)
+		}
+		data.PICLISettings.PiHoleURL = piHoleURL
+	}
+	if err := network.ConfigureTLS(data.PICLISettings.TLS); err != nil {
+		color.Red("Failed to configure TLS: %s", err.Error())
+		os.Exit(1)
+	}
+	if err := network.ConfigureRetries(data.PICLISettings.Retry); err != nil {
+		color.Red("Failed to configure retries: %s", err.Error())
+		os.Exit(1)
+	}
+	if err := network.ConfigureProxy(data.PICLISettings.Proxy); err != nil {
+		color.Red("Failed to configure the proxy: %s", err.Error())
+		os.Exit(1)
+	}
 
 	// retrieve the API key depending upon its storage location
-	if !data.PICLISettings.APIKeyIsInFile() && !auth.APIKeyIsInKeyring() {
+	if apiKeyFromEnv != "" {
+		data.LivePiCLIData.APIKey = apiKeyFromEnv
+	} else if !data.PICLISettings.APIKeyIsInFile() && !auth.APIKeyIsInKeyring() {
 		color.Red("Please configure Pi-CLI via the 'setup' command")
 		os.Exit(1)
 	} else {
@@ -32,9 +67,48 @@ func InitialisePICLI() {
 			data.LivePiCLIData.APIKey = auth.RetrieveAPIKeyFromKeyring()
 		}
 	}
+	// the API key is sent in the query string of every request, so it has to be kept out of errors
+	network.AddSecret(data.LivePiCLIData.APIKey)
+
+	// names for clients from DHCP leases (if ran on the Pi-Hole itself) and the user's alias file
+	clientNames, err := data.LoadClientNames(clients.DefaultLeaseFileLocation)
+	if err != nil {
+		color.Red(err.Error())
+		os.Exit(1)
+	}
+	data.LivePiCLIData.Clients = clientNames
 
 	data.LivePiCLIData.Settings = data.PICLISettings
-	data.LivePiCLIData.FormattedAPIAddress = network.GenerateAPIAddress(
-		data.PICLISettings.PiHoleAddress,
-		data.PICLISettings.PiHolePort)
+	data.LivePiCLIData.FormattedAPIAddress = network.GenerateAPIAddress(data.PICLISettings.PiHoleURL)
+}
+
+/*
+	Returns a context for a command's requests to the Pi-Hole, which is cancelled as soon as the
+	user presses Ctrl-C so that the command doesn't wait on them to finish or time out. Pressing
+	Ctrl-C again exits straight away.
+*/
+func interruptibleContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+/*
+	Wraps an error from a request to the Pi-Hole. Responses that couldn't be used (i.e. because the
+	API key was rejected) already say what went wrong, and any other error means that the Pi-Hole
+	couldn't be reached.
+*/
+func requestError(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted")
+	}
+	var responseErr *api.ResponseError
+	var privacyErr *api.PrivacyLevelError
+	if errors.Is(err, api.ErrAPIKeyRejected) || errors.As(err, &responseErr) || errors.As(err, &privacyErr) {
+		return err
+	}
+	return fmt.Errorf("failed to reach the Pi-Hole at %s: %s", data.PICLISettings.PiHoleURL, network.Redact(network.WithoutURL(err).Error()))
 }
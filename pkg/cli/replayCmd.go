@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+	"github.com/Reeceeboii/Pi-CLI/pkg/ui"
+	"github.com/urfave/cli/v2"
+)
+
+/*
+	Replays the history stored in an FTL database through the live UI, starting at --from
+	and playing back at --speed
+*/
+func RunReplayCommand(c *cli.Context) error {
+	if err := database.SetOutputLocation(c.String("tz")); err != nil {
+		return err
+	}
+
+	var from time.Time
+	if c.String("from") != "" {
+		var err error
+		from, err = database.ParseTimeArgument(c.String("from"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	speed, err := ui.ParseReplaySpeed(c.String("speed"))
+	if err != nil {
+		return err
+	}
+
+	if err := loadKnownClientNames(); err != nil {
+		return err
+	}
+
+	path, err := databasePathFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	source, err := ui.NewReplaySource(database.Connect(path), path, from, speed)
+	if err != nil {
+		return err
+	}
+	return ui.StartUI(c.Context, source)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Reeceeboii/Pi-CLI/pkg/api"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 )
@@ -18,9 +19,14 @@ import (
 /*
 Extracts a quick summary of the previous 24/hr of data from the Pi-Hole.
 */
-func RunSummaryCommand(*cli.Context) error {
+func RunSummaryCommand(c *cli.Context) error {
 	InitialisePICLI()
-	api.LiveSummary.Update(data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil)
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
+
+	if err := api.LiveSummary.Update(ctx, data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil); err != nil {
+		return requestError(err)
+	}
 	fmt.Printf("Summary @ %s\n", time.Now().Format(time.Stamp))
 	fmt.Println()
 
@@ -45,12 +51,23 @@ func RunSummaryCommand(*cli.Context) error {
 }
 
 /*
-Extract the current top 10 permitted domains that have been forwarded to the upstream DNS resolver
+Extract the current top 10 permitted domains that have been forwarded to the upstream DNS resolver,
+optionally grouped by their registrable domain
 */
-func RunTopTenForwardedCommand(*cli.Context) error {
+func RunTopTenForwardedCommand(c *cli.Context) error {
+	grouping, err := domains.ParseGrouping(c.String("group"))
+	if err != nil {
+		return err
+	}
+
 	InitialisePICLI()
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
 
-	api.LiveTopItems.Update(nil)
+	api.LiveTopItems.Grouping = grouping
+	if err := api.LiveTopItems.Update(ctx, nil); err != nil {
+		return requestError(err)
+	}
 	fmt.Printf("Top queries as of @ %s\n\n", time.Now().Format(time.Stamp))
 	for _, q := range api.LiveTopItems.PrettyTopQueries {
 		fmt.Println(q)
@@ -61,12 +78,22 @@ func RunTopTenForwardedCommand(*cli.Context) error {
 
 /*
 Extract the current top 10 blocked domains that the FTL has filtered out and not forwarded
-to the upstream DNS resolver
+to the upstream DNS resolver, optionally grouped by their registrable domain
 */
-func RunTopTenBlockedCommand(*cli.Context) error {
+func RunTopTenBlockedCommand(c *cli.Context) error {
+	grouping, err := domains.ParseGrouping(c.String("group"))
+	if err != nil {
+		return err
+	}
+
 	InitialisePICLI()
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
 
-	api.LiveTopItems.Update(nil)
+	api.LiveTopItems.Grouping = grouping
+	if err := api.LiveTopItems.Update(ctx, nil); err != nil {
+		return requestError(err)
+	}
 	fmt.Printf("Top blocked domains as of @ %s\n\n", time.Now().Format(time.Stamp))
 	for _, q := range api.LiveTopItems.PrettyTopAds {
 		fmt.Println(q)
@@ -87,14 +114,25 @@ func RunLatestQueriesCommand(c *cli.Context) error {
 	}
 
 	InitialisePICLI()
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
+
+	if err := api.UpdateClientNames(ctx, data.LivePiCLIData.Clients); err != nil {
+		return requestError(err)
+	}
 
 	api.LiveAllQueries.AmountOfQueriesInLog = queryAmount
 	api.LiveAllQueries.Queries = make([]api.Query, api.LiveAllQueries.AmountOfQueriesInLog)
-	api.LiveAllQueries.Update(nil)
+	if err := api.LiveAllQueries.Update(ctx, nil); err != nil {
+		return requestError(err)
+	}
 
 	for _, query := range api.LiveAllQueries.Table {
 		fmt.Println(query)
 	}
+	if api.LiveAllQueries.Hidden != nil {
+		color.Yellow("Note: %s", api.LiveAllQueries.Hidden.Error())
+	}
 
 	return nil
 }
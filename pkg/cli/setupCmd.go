@@ -2,6 +2,8 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/auth"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
@@ -9,7 +11,6 @@ import (
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -21,88 +22,208 @@ Reads in data from the user and uses it to construct a config file that Pi-CLI c
 in the future.
 
 The setup commands takes:
-  - The IP address of the target Pi-Hole instance
-  - The port exposing the Pi-Hole's web interface
+  - The URL of the target Pi-Hole instance's web interface (an IP address or host name on its
+    own, or a full URL with a scheme, port and path prefix)
   - A data refresh rate in seconds
   - User's Pi-Hole API key (used for authentication)
 
 It will then ask them if they wish to store the API key in their system keyring or the config
-file itself.
+file itself. Options for connecting to a Pi-Hole over HTTPS (i.e. a custom CA or a client
+certificate), or through a proxy or SSH jump host, are given as flags, and are kept if setup
+is ran again without them. Retry options, which are only set in the config file, are kept too.
+
+Each prompt can be answered with a flag instead (--address, --refresh, --api-key-stdin and
+--store), so that setup can be scripted. Details given as flags aren't asked for again if they
+turn out to be wrong; setup fails instead. When the API key is read from stdin, nothing else can
+be, so the refresh rate and key storage fall back to their defaults if their flags aren't given.
 */
 func SetupCommand(c *cli.Context) error {
 	reader := bufio.NewReader(os.Stdin)
+	if c.Bool("api-key-stdin") && !c.IsSet("address") {
+		return errors.New("--api-key-stdin needs the Pi-Hole's URL to be given with --address")
+	}
+	if c.Bool("discover") && c.IsSet("address") {
+		return errors.New("--discover and --address cannot be used together")
+	}
 
-	for {
-		// read in the IP address and check that it is valid
-		fmt.Print(" > Please enter the IP address of your Pi-Hole: ")
-		piHoleAddress, _ := reader.ReadString('\n')
-		ip := net.ParseIP(strings.TrimSpace(piHoleAddress))
-		if ip == nil {
-			color.Yellow("Please enter a valid IP address")
-			continue
+	// re-running setup keeps any TLS, proxy and retry options that were configured previously
+	if data.ConfigFileExists() {
+		previous := data.NewSettings()
+		previous.LoadFromFile()
+		data.PICLISettings.TLS = previous.TLS
+		data.PICLISettings.Proxy = previous.Proxy
+		data.PICLISettings.Retry = previous.Retry
+	}
+	data.PICLISettings.TLS = tlsOptionsFromFlags(c, data.PICLISettings.TLS)
+	if err := network.ConfigureTLS(data.PICLISettings.TLS); err != nil {
+		return err
+	}
+	proxy, err := proxyOptionsFromFlags(c, data.PICLISettings.Proxy)
+	if err != nil {
+		return err
+	}
+	data.PICLISettings.Proxy = proxy
+	if err := network.ConfigureProxy(data.PICLISettings.Proxy); err != nil {
+		return err
+	}
+
+	if err := setupPiHoleURL(c, reader); err != nil {
+		return err
+	}
+	if err := setupRefreshRate(c, reader); err != nil {
+		return err
+	}
+	if err := setupAPIKey(c, reader); err != nil {
+		return err
+	}
+	if err := setupKeyStorage(c, reader); err != nil {
+		return err
+	}
+
+	// write config file to disk
+	// all fields in the settings struct would have been set by this point
+	if err := data.PICLISettings.SaveToFile(); err != nil {
+		color.Red("Failed to save settings")
+		log.Fatal(err.Error())
+	}
+
+	color.Green("\nConfiguration successfully saved to %s", data.GetConfigFileLocation())
+	return nil
+}
+
+/*
+Reads in the Pi-Hole's URL (from --address, a Pi-Hole found with --discover, or the user) and
+checks that it points to a Pi-Hole
+*/
+func setupPiHoleURL(c *cli.Context, reader *bufio.Reader) error {
+	discovered := ""
+	if c.Bool("discover") {
+		var err error
+		if discovered, err = discoverPiHoleURL(c, reader); err != nil {
+			return err
 		}
-		data.PICLISettings.PiHoleAddress = ip.String()
-		break
 	}
 
 	for {
-		// read in the port
-		fmt.Print(" > Please enter the port that exposes the web interface (default 80): ")
-		piHolePort, _ := reader.ReadString('\n')
-		trimmed := strings.TrimSpace(piHolePort)
-		// if the user entered something, validate and apply. Else, revert to the default
-		if len(trimmed) > 0 {
-			intPiHolePort, err := strconv.Atoi(trimmed)
-			if err != nil {
-				color.Yellow("Please enter a number")
-				continue
-			}
-			if intPiHolePort < 1 || intPiHolePort > 65535 {
-				color.Yellow("Port must be between 1 and 65535")
-				continue
-			}
-			testAddressWithPort := network.GenerateAPIAddress(data.PICLISettings.PiHoleAddress, intPiHolePort)
-			if network.IsAlive(testAddressWithPort) {
-				data.PICLISettings.PiHolePort = intPiHolePort
-			} else {
-				continue
-			}
+		var piHoleURL string
+		if discovered != "" {
+			// if the picked Pi-Hole doesn't work out, the user is asked for its URL instead
+			piHoleURL, discovered = discovered, ""
+		} else if c.IsSet("address") {
+			piHoleURL = c.String("address")
 		} else {
-			testAddressWithPort := network.GenerateAPIAddress(data.PICLISettings.PiHoleAddress, data.DefaultPort)
-			if network.IsAlive(testAddressWithPort) {
-				data.PICLISettings.PiHolePort = data.DefaultPort
-			} else {
-				continue
-			}
+			fmt.Print(" > Please enter the URL of your Pi-Hole (e.g. 192.168.1.2, https://pihole.lan/pihole): ")
+			piHoleURL, _ = reader.ReadString('\n')
 		}
 
-		// send a request to the PiHole to validate that the IP and port actually point to it
-		tempURL := fmt.Sprintf(
-			"http://%s:%d/admin/api.php",
-			data.PICLISettings.PiHoleAddress,
-			data.PICLISettings.PiHolePort)
-		req, err := http.NewRequest("GET", tempURL, nil)
+		baseURL, err := network.ParseBaseURL(piHoleURL)
+		if err == nil && c.IsSet("port") {
+			baseURL, err = withPort(baseURL, c.Int("port"))
+		}
 		if err != nil {
-			log.Fatal(err)
+			if c.IsSet("address") {
+				return fmt.Errorf("invalid --address: %s", err.Error())
+			}
+			color.Yellow("Please enter a valid URL: %s", err.Error())
+			continue
 		}
-		res, err := network.HttpClient.Do(req)
 
-		// if the details are valid and the request didn't time out...
-		// lazy evaluation saves us from deref errors here and saves a check
-		if err == nil && network.ValidatePiHoleDetails(res) {
+		if c.Bool("no-validate") || piHoleIsAlive(c, network.GenerateAPIAddress(baseURL)) {
+			data.PICLISettings.PiHoleURL = baseURL
 			break
-		} else {
-			color.Yellow("Pi-Hole doesn't seem to be alive, check your details and try again!")
-			fmt.Println()
 		}
+		if c.IsSet("address") {
+			return fmt.Errorf("couldn't reach a Pi-Hole at %s", baseURL)
+		}
+		color.Yellow("Pi-Hole doesn't seem to be alive, check your details and try again!")
+		fmt.Println()
+	}
+
+	if !c.Bool("no-validate") {
+		color.Green("Pi-Hole reachable at %s!\n", data.PICLISettings.PiHoleURL)
+	}
+	return nil
+}
+
+/*
+Searches the local network for Pi-Holes and asks the user to pick one. Returns an empty URL if
+none were found, or the user would rather type it in.
+*/
+func discoverPiHoleURL(c *cli.Context, reader *bufio.Reader) (string, error) {
+	options := network.DiscoveryOptions{MDNS: c.Bool("mdns")}
+	if c.IsSet("port") {
+		options.Ports = []int{c.Int("port")}
+	}
+
+	ctx, cancel := interruptibleContext(c)
+	defer cancel()
+	color.Yellow("Searching the local network for Pi-Holes...")
+	piHoles, err := network.DiscoverPiHoles(ctx, options)
+	if errors.Is(err, context.Canceled) {
+		return "", errors.New("interrupted")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to search for Pi-Holes: %s", err.Error())
+	}
+	if len(piHoles) == 0 {
+		color.Yellow("No Pi-Holes were found")
+		return "", nil
+	}
+
+	for i, piHole := range piHoles {
+		fmt.Printf("   %d) %s\n", i+1, piHole)
+	}
+	for {
+		fmt.Printf(" > Please pick a Pi-Hole (1-%d), or press enter to type in its URL: ", len(piHoles))
+		choice, _ := reader.ReadString('\n')
+		choice = strings.TrimSpace(choice)
+		if choice == "" {
+			return "", nil
+		}
+		index, err := strconv.Atoi(choice)
+		if err != nil || index < 1 || index > len(piHoles) {
+			color.Yellow("Please enter a number between 1 and %d", len(piHoles))
+			continue
+		}
+		if !piHoles[index-1].Supported {
+			color.Yellow("Pi-CLI can't talk to that Pi-Hole's API yet, please pick another")
+			continue
+		}
+		return piHoles[index-1].URL, nil
 	}
+}
 
-	color.Green(
-		"Pi-Hole reachable at %s:%d!\n",
-		data.PICLISettings.PiHoleAddress,
-		data.PICLISettings.PiHolePort)
+// Sends a request to the Pi-Hole's API to validate that the URL actually points to it
+func piHoleIsAlive(c *cli.Context, apiAddress string) bool {
+	if !network.IsAlive(c.Context, apiAddress) {
+		return false
+	}
+
+	req, err := http.NewRequestWithContext(c.Context, "GET", apiAddress, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := network.HttpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	return network.ValidatePiHoleDetails(res)
+}
+
+// Reads in the data refresh rate (from --refresh or the user)
+func setupRefreshRate(c *cli.Context, reader *bufio.Reader) error {
+	if c.IsSet("refresh") {
+		if c.Int("refresh") < 1 {
+			return errors.New("--refresh cannot be less than 1 second")
+		}
+		data.PICLISettings.RefreshS = c.Int("refresh")
+		return nil
+	}
+	if c.Bool("api-key-stdin") {
+		return nil
+	}
 
-	// read in the data refresh rate
 	for {
 		fmt.Print(" > Please enter your preferred data refresh rate in seconds (default 1s): ")
 		refreshS, _ := reader.ReadString('\n')
@@ -118,46 +239,79 @@ func SetupCommand(c *cli.Context) error {
 				continue
 			}
 			data.PICLISettings.RefreshS = intRefreshS
-			break
-		} else {
-			break
 		}
+		return nil
 	}
+}
 
-	// read in the API key and work out where the user wants to store it (keyring or config file)
+/*
+Reads in the API key (from stdin with --api-key-stdin, or the user) and checks that the Pi-Hole
+accepts it
+*/
+func setupAPIKey(c *cli.Context, reader *bufio.Reader) error {
 	for {
-		fmt.Print(" > Please enter your Pi-Hole API key: ")
+		if !c.Bool("api-key-stdin") {
+			fmt.Print(" > Please enter your Pi-Hole API key: ")
+		}
 		apiKey, _ := reader.ReadString('\n')
 		apiKey = strings.TrimSpace(apiKey)
 		if len(apiKey) < 1 {
+			if c.Bool("api-key-stdin") {
+				return errors.New("--api-key-stdin was given, but no API key was read from stdin")
+			}
 			color.Yellow("Please provide your API key for authentication")
 			continue
 		}
 
 		data.PICLISettings.APIKey = apiKey
+		network.AddSecret(apiKey)
+
+		if c.Bool("no-validate") {
+			return nil
+		}
 
 		// before we store the API token (keyring or config file), we should check that it's valid
 		// the address + port have been validated by this point so we're safe to shoot requests at it
 		data.LivePiCLIData.Settings = data.PICLISettings
-		data.LivePiCLIData.FormattedAPIAddress = network.GenerateAPIAddress(
-			data.PICLISettings.PiHoleAddress,
-			data.PICLISettings.PiHolePort)
+		data.LivePiCLIData.FormattedAPIAddress = network.GenerateAPIAddress(data.PICLISettings.PiHoleURL)
 
-		if !auth.ValidateAPIKey(data.LivePiCLIData.FormattedAPIAddress, data.PICLISettings.APIKey) {
-			color.Yellow("That API token doesn't seem to be correct, check it and try again!")
-		} else {
+		valid, err := auth.ValidateAPIKey(c.Context, data.LivePiCLIData.FormattedAPIAddress, data.PICLISettings.APIKey)
+		if err != nil {
+			return fmt.Errorf("failed to check the API key: %s", err.Error())
+		}
+		if valid {
 			break
 		}
+		if c.Bool("api-key-stdin") {
+			return errors.New("the Pi-Hole rejected the API key read from stdin")
+		}
+		color.Yellow("That API token doesn't seem to be correct, check it and try again!")
 	}
 
 	color.Green("Authenticated with API key!\n")
+	return nil
+}
 
-	fmt.Print(" > Do you wish to store the API key in your system keyring? (y/n - default y): ")
-	storageChoice, _ := reader.ReadString('\n')
-	storageChoice = strings.ToLower(strings.TrimSpace(storageChoice))
+/*
+Works out where the API key is stored (from --store or the user). When the keyring is chosen
+with --store, failing to use it is an error rather than falling back to the config file, so that
+the key isn't written to disk unexpectedly.
+*/
+func setupKeyStorage(c *cli.Context, reader *bufio.Reader) error {
+	storageChoice := c.String("store")
+	if !c.IsSet("store") && c.Bool("api-key-stdin") {
+		storageChoice = KeyringStorage
+	} else if !c.IsSet("store") {
+		fmt.Print(" > Do you wish to store the API key in your system keyring? (y/n - default y): ")
+		storageChoice, _ = reader.ReadString('\n')
+		storageChoice = strings.ToLower(strings.TrimSpace(storageChoice))
+		if storageChoice == "y" || len(storageChoice) == 0 {
+			storageChoice = KeyringStorage
+		}
+	}
 
 	// if they wish to use their system's keyring...
-	if storageChoice == "y" || len(storageChoice) == 0 {
+	if storageChoice == KeyringStorage {
 		err := auth.StoreAPIKeyInKeyring(data.PICLISettings.APIKey)
 
 		if err == nil {
@@ -168,18 +322,11 @@ func SetupCommand(c *cli.Context) error {
 				instance before it gets serialised to disk
 			*/
 			data.PICLISettings.APIKey = ""
+		} else if c.IsSet("store") {
+			return fmt.Errorf("failed to store the API key in the system keyring: %s", err.Error())
 		} else {
 			color.Yellow("System keyring call failed, falling back to config file")
 		}
 	}
-
-	// write config file to disk
-	// all fields in the settings struct would have been set by this point
-	if err := data.PICLISettings.SaveToFile(); err != nil {
-		color.Red("Failed to save settings")
-		log.Fatal(err.Error())
-	}
-
-	color.Green("\nConfiguration successfully saved to %s", data.GetConfigFileLocation())
 	return nil
 }
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
+)
+
+// Tests that re-running setup keeps the retry options that were added to the config file
+func TestSetupKeepsRetryOptions(t *testing.T) {
+	// a profile of its own keeps the test away from the user's config file
+	profile := fmt.Sprintf("setup-test-%d", time.Now().UnixNano())
+	if err := data.UseProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	configFile := data.GetConfigFileLocation()
+	defer func() {
+		_ = os.Remove(configFile)
+		_ = data.UseProfile("")
+	}()
+
+	retry := &network.RetryOptions{Attempts: 5, BackoffMS: 250, MaxBackoffMS: 4000, BreakerThreshold: 3, BreakerCooldownS: 10}
+	previous := data.NewSettings()
+	previous.PiHoleURL = "http://192.168.1.2"
+	previous.Retry = retry
+	if err := previous.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the API key is read from stdin, as it would be when setup is scripted
+	stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = stdin.WriteString("0123456789abcdef\n")
+	_, _ = stdin.Seek(0, 0)
+	realStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = realStdin }()
+
+	err = App.Run([]string{
+		"picli", "--profile", profile,
+		"setup", "--address", "http://192.168.1.3", "--api-key-stdin", "--store", FileStorage, "--no-validate",
+	})
+	if err != nil {
+		t.Fatalf("@TestSetupKeepsRetryOptions: setup failed: %s", err.Error())
+	}
+
+	saved := data.NewSettings()
+	saved.LoadFromFile()
+	if saved.PiHoleURL != "http://192.168.1.3" {
+		t.Errorf("@TestSetupKeepsRetryOptions: setup saved the URL %s", saved.PiHoleURL)
+	}
+	if !reflect.DeepEqual(saved.Retry, retry) {
+		t.Errorf("@TestSetupKeepsRetryOptions: setup saved the retry options %+v, expected %+v", saved.Retry, retry)
+	}
+}
@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
+	"github.com/urfave/cli/v2"
+)
+
+// Where the setup command can store the API key
+const (
+	KeyringStorage = "keyring"
+	FileStorage    = "file"
+)
+
+/*
+	Flags that answer the setup command's prompts, so that it can be ran without any input from
+	the user (i.e. when provisioning Pi-CLI with a configuration management tool)
+*/
+var setupDetailFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "address",
+		Usage: "URL of the Pi-Hole's web interface (i.e. 192.168.1.2, https://pihole.lan/pihole)",
+	},
+	&cli.IntFlag{
+		Name:  "port",
+		Usage: "Port of the Pi-Hole's web interface, if it isn't part of its URL",
+	},
+	&cli.IntFlag{
+		Name:  "refresh",
+		Usage: "Data refresh rate in seconds",
+	},
+	&cli.BoolFlag{
+		Name:  "api-key-stdin",
+		Usage: "Read the API key from stdin, rather than prompting for it",
+	},
+	&cli.StringFlag{
+		Name:  "store",
+		Usage: "Where to store the API key: \"keyring\" or \"file\"",
+		Action: func(c *cli.Context, store string) error {
+			if store != KeyringStorage && store != FileStorage {
+				return fmt.Errorf("--store must be \"%s\" or \"%s\", got \"%s\"", KeyringStorage, FileStorage, store)
+			}
+			return nil
+		},
+	},
+	&cli.BoolFlag{
+		Name:  "no-validate",
+		Usage: "Don't check that the Pi-Hole can be reached and accepts the API key",
+	},
+	&cli.BoolFlag{
+		Name:  "discover",
+		Usage: "Search the local network for Pi-Holes and pick one, rather than typing in its URL",
+	},
+	&cli.BoolFlag{
+		Name:  "mdns",
+		Usage: "Also look for Pi-Holes announced over mDNS (i.e. pihole.local) when searching with --discover",
+	},
+}
+
+/*
+	Sets the port of a base URL, replacing any port that it already has. The URL is parsed again
+	so that the port is validated.
+*/
+func withPort(baseURL string, port int) (string, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	parsed.Host = net.JoinHostPort(parsed.Hostname(), strconv.Itoa(port))
+	return network.ParseBaseURL(parsed.String())
+}
+
+// Flags used by the setup command to configure TLS connections to a Pi-Hole served over HTTPS
+var setupTLSFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "ca-file",
+		Usage: "Path to a PEM bundle of certificate authorities to trust (i.e. an internal CA)",
+	},
+	&cli.StringFlag{
+		Name:  "cert",
+		Usage: "Path to a PEM client certificate to present to the Pi-Hole (mTLS)",
+	},
+	&cli.StringFlag{
+		Name:  "key",
+		Usage: "Path to the PEM private key of the client certificate",
+	},
+	&cli.StringFlag{
+		Name:  "server-name",
+		Usage: "Verify the Pi-Hole's certificate against this name rather than the URL's host",
+	},
+	&cli.StringSliceFlag{
+		Name:  "pin-sha256",
+		Usage: "Only trust a server certificate with this SHA-256 fingerprint (can be given more than once)",
+	},
+	&cli.BoolFlag{
+		Name:  "insecure-skip-verify",
+		Usage: "Don't verify the Pi-Hole's certificate at all. INSECURE, only use this for testing",
+	},
+}
+
+/*
+	Applies the TLS flags given to the setup command on top of any existing TLS options, so that
+	setup can be re-ran without losing them. Returns nil if no TLS options are set.
+*/
+func tlsOptionsFromFlags(c *cli.Context, existing *network.TLSOptions) *network.TLSOptions {
+	options := &network.TLSOptions{}
+	if existing != nil {
+		*options = *existing
+	}
+
+	if c.IsSet("ca-file") {
+		options.CAFile = c.String("ca-file")
+	}
+	if c.IsSet("cert") {
+		options.CertFile = c.String("cert")
+	}
+	if c.IsSet("key") {
+		options.KeyFile = c.String("key")
+	}
+	if c.IsSet("server-name") {
+		options.ServerName = c.String("server-name")
+	}
+	if c.IsSet("pin-sha256") {
+		options.PinnedSHA256 = c.StringSlice("pin-sha256")
+	}
+	if c.IsSet("insecure-skip-verify") {
+		options.InsecureSkipVerify = c.Bool("insecure-skip-verify")
+	}
+
+	if !options.IsSet() {
+		return nil
+	}
+	return options
+}
+
+// Flags used by the setup command to configure how the Pi-Hole is reached through a proxy or SSH jump host
+var setupProxyFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "proxy",
+		Usage: "Send requests through a HTTP or SOCKS5 proxy (i.e. socks5://bastion.lan:1080), or \"none\" to ignore HTTP(S)_PROXY",
+	},
+	&cli.StringFlag{
+		Name:  "ssh-tunnel",
+		Usage: "Tunnel connections to the Pi-Hole through an SSH jump host, given as [user@]host[:port]",
+	},
+	&cli.StringFlag{
+		Name:  "ssh-identity",
+		Usage: "Path to the private key used to log into the SSH jump host (the SSH agent is also used)",
+	},
+	&cli.StringFlag{
+		Name:  "ssh-known-hosts",
+		Usage: "Path to the known_hosts file used to verify the SSH jump host (default: ~/.ssh/known_hosts)",
+	},
+}
+
+// All of the flags used by the setup command
+var setupFlags = append(append(append([]cli.Flag{}, setupDetailFlags...), setupTLSFlags...), setupProxyFlags...)
+
+/*
+	Applies the proxy flags given to the setup command on top of any existing proxy options, in
+	the same way as the TLS flags. Setting a proxy replaces an SSH tunnel and vice versa. Returns
+	nil if no proxy options are set.
+*/
+func proxyOptionsFromFlags(c *cli.Context, existing *network.ProxyOptions) (*network.ProxyOptions, error) {
+	options := &network.ProxyOptions{}
+	if existing != nil {
+		*options = *existing
+	}
+
+	if c.IsSet("proxy") {
+		if _, err := network.ParseProxyURL(c.String("proxy")); err != nil {
+			return nil, err
+		}
+		options.URL = c.String("proxy")
+		options.SSHTunnel = nil
+	}
+	if c.IsSet("ssh-tunnel") {
+		tunnel, err := network.ParseSSHDestination(c.String("ssh-tunnel"))
+		if err != nil {
+			return nil, err
+		}
+		options.URL = ""
+		options.SSHTunnel = tunnel
+	}
+	if c.IsSet("ssh-identity") || c.IsSet("ssh-known-hosts") {
+		if options.SSHTunnel == nil {
+			return nil, errors.New("--ssh-identity and --ssh-known-hosts need a jump host, given with --ssh-tunnel")
+		}
+		tunnel := *options.SSHTunnel
+		if c.IsSet("ssh-identity") {
+			tunnel.IdentityFile = c.String("ssh-identity")
+		}
+		if c.IsSet("ssh-known-hosts") {
+			tunnel.KnownHostsFile = c.String("ssh-known-hosts")
+		}
+		options.SSHTunnel = &tunnel
+	}
+
+	if !options.IsSet() {
+		return nil, nil
+	}
+	return options, nil
+}
@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Where a client's name came from. Later sources take precedence over earlier ones
+type Source int
+
+// Supported name sources, in ascending order of precedence
+const (
+	// A host name that FTL found for the client, stored in its network table
+	NetworkSource Source = iota
+	// The host name that the client gave when it leased its address via Pi-Hole's DHCP server
+	LeaseSource
+	// A name reported by the Pi-Hole's API
+	PiHoleSource
+	// A name given to the client by the user in their alias file
+	AliasSource
+)
+
+// Returns a readable description of the source
+func (source Source) String() string {
+	switch source {
+	case NetworkSource:
+		return "network table"
+	case LeaseSource:
+		return "DHCP lease"
+	case PiHoleSource:
+		return "Pi-Hole"
+	case AliasSource:
+		return "alias"
+	}
+	return fmt.Sprintf("source %d", int(source))
+}
+
+// A name for a client, and where it came from
+type Identity struct {
+	Name   string
+	Source Source
+}
+
+/*
+	Maps client addresses (IP or MAC) to their names. Names can come from several sources, and
+	where more than one source names the same client, the one with the highest precedence wins.
+
+	A nil directory holds no names, so can always be used to look clients up.
+*/
+type Directory struct {
+	identities map[string]Identity
+}
+
+// Creates an empty directory
+func NewDirectory() *Directory {
+	return &Directory{identities: make(map[string]Identity)}
+}
+
+/*
+	Normalises a client address so that the same client is always looked up in the same way.
+	FTL's "ip-" prefix for clients without a MAC address is removed, and IP and MAC addresses
+	are written in their canonical forms. Anything else is lower cased.
+*/
+func NormaliseAddress(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	address = strings.TrimPrefix(address, "ip-")
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	if mac, err := net.ParseMAC(address); err == nil {
+		return mac.String()
+	}
+	return address
+}
+
+/*
+	Names a client. Blank names (and "*", which dnsmasq uses for leases without a host name) are
+	ignored, as is a name from a source with lower precedence than the client's current name.
+*/
+func (directory *Directory) Add(address string, name string, source Source) {
+	name = strings.TrimSpace(name)
+	address = NormaliseAddress(address)
+	if name == "" || name == "*" || address == "" {
+		return
+	}
+	if existing, exists := directory.identities[address]; exists && existing.Source > source {
+		return
+	}
+	directory.identities[address] = Identity{Name: name, Source: source}
+}
+
+// Adds every name from another directory, keeping whichever name has the highest precedence
+func (directory *Directory) Merge(other *Directory) {
+	if other == nil {
+		return
+	}
+	for address, identity := range other.identities {
+		directory.Add(address, identity.Name, identity.Source)
+	}
+}
+
+// Returns a copy of the directory that can be added to without changing the original
+func (directory *Directory) Copy() *Directory {
+	copied := NewDirectory()
+	copied.Merge(directory)
+	return copied
+}
+
+// Returns the identity of a client, and whether it has one
+func (directory *Directory) Lookup(address string) (Identity, bool) {
+	if directory == nil {
+		return Identity{}, false
+	}
+	identity, exists := directory.identities[NormaliseAddress(address)]
+	return identity, exists
+}
+
+// Returns the name of a client, or an empty string if it doesn't have one
+func (directory *Directory) Name(address string) string {
+	identity, _ := directory.Lookup(address)
+	return identity.Name
+}
+
+/*
+	Returns a label to display a client with, i.e. "Kitchen Speaker (192.168.1.23)". Clients
+	without a name are labelled with their address.
+*/
+func (directory *Directory) Label(address string) string {
+	name := directory.Name(address)
+	if name == "" || strings.EqualFold(name, address) {
+		return address
+	}
+	return fmt.Sprintf("%s (%s)", name, address)
+}
+
+// Returns the addresses of the clients with a given name (ignoring case), in sorted order
+func (directory *Directory) Addresses(name string) []string {
+	var addresses []string
+	if directory == nil {
+		return addresses
+	}
+	for address, identity := range directory.identities {
+		if strings.EqualFold(identity.Name, strings.TrimSpace(name)) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// The number of clients that have a name
+func (directory *Directory) Len() int {
+	if directory == nil {
+		return 0
+	}
+	return len(directory.identities)
+}
@@ -0,0 +1,59 @@
+package clients
+
+import (
+	"testing"
+)
+
+// Tests for clients.NormaliseAddress()
+func TestNormaliseAddress(t *testing.T) {
+	expected := map[string]string{
+		"192.168.1.23":      "192.168.1.23",
+		"ip-192.168.1.23":   "192.168.1.23",
+		" FE80:0:0::1 ":     "fe80::1",
+		"AA-BB-CC-DD-EE-FF": "aa:bb:cc:dd:ee:ff",
+		"Laptop.lan":        "laptop.lan",
+	}
+	for input, address := range expected {
+		if result := NormaliseAddress(input); result != address {
+			t.Errorf("@TestNormaliseAddress: clients.NormaliseAddress(%q) returned %q, expected %q", input, result, address)
+		}
+	}
+}
+
+// Tests for clients.Directory.Add(), and its precedence between sources
+func TestDirectoryPrecedence(t *testing.T) {
+	directory := NewDirectory()
+	directory.Add("192.168.1.23", "speaker.lan", NetworkSource)
+	directory.Add("192.168.1.23", "Kitchen Speaker", AliasSource)
+	directory.Add("ip-192.168.1.23", "esp-3a41f2", LeaseSource)
+	directory.Add("192.168.1.24", "*", LeaseSource)
+
+	if identity, _ := directory.Lookup("192.168.1.23"); identity.Name != "Kitchen Speaker" || identity.Source != AliasSource {
+		t.Errorf("@TestDirectoryPrecedence: expected the alias to take precedence, got %+v", identity)
+	}
+	if name := directory.Name("192.168.1.24"); name != "" {
+		t.Errorf("@TestDirectoryPrecedence: expected a lease without a host name to be ignored, got %q", name)
+	}
+	if label := directory.Label("192.168.1.23"); label != "Kitchen Speaker (192.168.1.23)" {
+		t.Errorf("@TestDirectoryPrecedence: unexpected label %q", label)
+	}
+	if label := directory.Label("10.0.0.1"); label != "10.0.0.1" {
+		t.Errorf("@TestDirectoryPrecedence: expected an unnamed client to be labelled with its address, got %q", label)
+	}
+
+	directory.Add("aa:bb:cc:dd:ee:ff", "kitchen speaker", LeaseSource)
+	if addresses := directory.Addresses("Kitchen Speaker"); len(addresses) != 2 || addresses[0] != "192.168.1.23" {
+		t.Errorf("@TestDirectoryPrecedence: unexpected addresses for 'Kitchen Speaker' %v", addresses)
+	}
+
+	copied := directory.Copy()
+	copied.Add("10.0.0.1", "router", PiHoleSource)
+	if directory.Len() != 2 || copied.Len() != 3 {
+		t.Errorf("@TestDirectoryPrecedence: expected a copy to be independent, got lengths %d and %d", directory.Len(), copied.Len())
+	}
+
+	var empty *Directory
+	if empty.Name("10.0.0.1") != "" || empty.Label("10.0.0.1") != "10.0.0.1" {
+		t.Error("@TestDirectoryPrecedence: expected a nil directory to hold no names")
+	}
+}
@@ -0,0 +1,55 @@
+package clients
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Where Pi-Hole's DHCP server (dnsmasq) keeps its leases
+const DefaultLeaseFileLocation = "/etc/pihole/dhcp.leases"
+
+/*
+	Reads a user's alias file into the directory. Each line names a client by its IP or MAC
+	address, i.e. "192.168.1.23 = Kitchen Speaker". Blank lines, and anything after a #, are
+	ignored.
+*/
+func (directory *Directory) ReadAliases(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if comment := strings.Index(text, "#"); comment != -1 {
+			text = text[:comment]
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		address, name, found := strings.Cut(text, "=")
+		if !found || strings.TrimSpace(address) == "" || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("line %d of the alias file should be in the form 'address = name', got '%s'", line, scanner.Text())
+		}
+		directory.Add(address, name, AliasSource)
+	}
+	return scanner.Err()
+}
+
+/*
+	Reads a dnsmasq lease file into the directory. Each lease names the client by both its MAC
+	and IP address. The file's lines are in the form "<expiry> <MAC> <IP> <host name> <client ID>",
+	and anything that doesn't look like a lease is skipped.
+*/
+func (directory *Directory) ReadLeases(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		mac, ip, name := fields[1], fields[2], fields[3]
+		directory.Add(mac, name, LeaseSource)
+		directory.Add(ip, name, LeaseSource)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,47 @@
+package clients
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests for clients.Directory.ReadAliases()
+func TestReadAliases(t *testing.T) {
+	directory := NewDirectory()
+	err := directory.ReadAliases(strings.NewReader(`
+# devices around the house
+192.168.1.23 = Kitchen Speaker
+aa:bb:cc:dd:ee:ff=Living Room TV   # by MAC, so it follows the TV between addresses
+`))
+	if err != nil {
+		t.Fatalf("@TestReadAliases: clients.Directory.ReadAliases() failed: %s", err)
+	}
+	if name := directory.Name("192.168.1.23"); name != "Kitchen Speaker" {
+		t.Errorf("@TestReadAliases: expected 'Kitchen Speaker', got %q", name)
+	}
+	if name := directory.Name("AA:BB:CC:DD:EE:FF"); name != "Living Room TV" {
+		t.Errorf("@TestReadAliases: expected 'Living Room TV', got %q", name)
+	}
+
+	if err := NewDirectory().ReadAliases(strings.NewReader("192.168.1.23 Kitchen Speaker")); err == nil {
+		t.Error("@TestReadAliases: expected an error for a line without an =")
+	}
+}
+
+// Tests for clients.Directory.ReadLeases()
+func TestReadLeases(t *testing.T) {
+	directory := NewDirectory()
+	err := directory.ReadLeases(strings.NewReader(
+		"1613403216 aa:bb:cc:dd:ee:ff 192.168.1.50 pixel-5 01:aa:bb:cc:dd:ee:ff\n" +
+			"1613403216 11:22:33:44:55:66 192.168.1.51 * *\n" +
+			"duid 00:01:00:01:27:aa:bb:cc\n"))
+	if err != nil {
+		t.Fatalf("@TestReadLeases: clients.Directory.ReadLeases() failed: %s", err)
+	}
+	if directory.Name("192.168.1.50") != "pixel-5" || directory.Name("aa:bb:cc:dd:ee:ff") != "pixel-5" {
+		t.Errorf("@TestReadLeases: expected pixel-5 to be named by both its IP and MAC address")
+	}
+	if directory.Len() != 2 {
+		t.Errorf("@TestReadLeases: expected 2 names, got %d", directory.Len())
+	}
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+)
+
+// Return the path to the user's client alias file (or at least where it should be)
+func GetClientAliasFileLocation() string {
+	return homeFileLocation(ClientAliasFileName)
+}
+
+/*
+Loads the names that this machine knows for clients: the host names in a DHCP lease file
+(which is only present when Pi-CLI is ran on the Pi-Hole itself), and the aliases in the
+user's alias file. Either file not existing is fine, as neither is required.
+*/
+func LoadClientNames(leaseFileLocation string) (*clients.Directory, error) {
+	directory := clients.NewDirectory()
+
+	if leaseFile, err := os.Open(leaseFileLocation); err == nil {
+		defer leaseFile.Close()
+		if err := directory.ReadLeases(leaseFile); err != nil {
+			return nil, fmt.Errorf("error reading DHCP leases from %s: %s", leaseFileLocation, err.Error())
+		}
+	}
+
+	aliasFileLocation := GetClientAliasFileLocation()
+	aliasFile, err := os.Open(aliasFileLocation)
+	if os.IsNotExist(err) {
+		return directory, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer aliasFile.Close()
+
+	if err := directory.ReadAliases(aliasFile); err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", aliasFileLocation, err.Error())
+	}
+	return directory, nil
+}
@@ -2,6 +2,8 @@ package data
 
 import (
 	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
 )
 
 // live updating config data used at runtime
@@ -19,24 +21,36 @@ type PiCLIData struct {
 	LastUpdated time.Time
 	// If the keybinds screen is being shown or not
 	ShowKeybindsScreen bool
+	// If suspicious looking domains are highlighted in the query log or not
+	HighlightSuspiciousDomains bool
+	// The names given to clients, used to label them in the query log
+	Clients *clients.Directory
 	// String used to display the keybindings
 	Keybinds []string
 }
 
 func NewPiCLIData() *PiCLIData {
 	return &PiCLIData{
+		Clients: clients.NewDirectory(),
 		Keybinds: []string{
 			"",
 			"---------- Query Log ----------",
 			"",
 			"          [E/D]  Increase/decrease number of queries in query log by 1",
 			"          [R/F]  Increase/decrease number of queries in query log by 10 ",
-			"[UP/DOWN ARROW]  Scroll up/down query log by 1",
-			" [PAGE UP/DOWN]  Scroll up/down query log by 10",
+			"[UP/DOWN ARROW]  Scroll up/down the focused list by 1",
+			" [PAGE UP/DOWN]  Scroll up/down the focused list by 10",
+			"            [H]  Highlight suspicious looking domains (i.e. DNS tunnelling) in query log",
+			"",
+			"---------- Top Domains ----------",
+			"",
+			"          [TAB]  Move focus between the query log and the top domain lists",
+			"            [G]  Group/ungroup top domains by registrable domain (a.cdn.example.com -> example.com)",
+			"        [ENTER]  Expand/collapse the selected group in the focused top domain list",
 			"",
 			"---------- Misc. ----------",
 			"",
-			"[P]  Enable/Disable Pi-Hole",
+			"[P]  Enable/Disable Pi-Hole (or pause/resume a replay)",
 			"[Q]  Quit Pi-CLI",
 		},
 	}
@@ -2,13 +2,17 @@ package data
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/user"
 	"path"
+	"regexp"
 	"runtime"
 	"strings"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
 )
 
 // Store PiCLI settings
@@ -16,24 +20,50 @@ var PICLISettings = NewSettings()
 
 // Constant values required by Pi-CLI
 const (
-	// Port that the Pi-Hole API is defaulted to
+	// Port that the Pi-Hole API was defaulted to in config files that stored an address and port
 	DefaultPort = 80
 	// The default refresh rate of the data in seconds
 	DefaultRefreshS = 1
 	// The name of the configuration file
 	ConfigFileName = "picli-config.json"
+	// The name of the file that the user can give their clients names in
+	ClientAliasFileName = "picli-aliases.conf"
+)
+
+// Environment variables that override the config file, so that Pi-CLI can run without one (i.e. in CI or a container)
+const (
+	// The base URL of the Pi-Hole's web interface, overriding the configured one
+	AddressEnvVar = "PICLI_ADDRESS"
+	// The Pi-Hole's API key, overriding the one in the config file or system keyring
+	APIKeyEnvVar = "PICLI_API_KEY"
+	// The profile to use, as set by the --profile flag
+	ProfileEnvVar = "PICLI_PROFILE"
 )
 
+// The name of the profile in use. Empty for the default profile
+var Profile = ""
+
+// Profile names end up in file names, so are kept to a safe set of characters
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 // Settings contains the current configuration options being used by Pi-CLI
 type Settings struct {
-	// The Pi-Hole's address
-	PiHoleAddress string `json:"pi_hole_address"`
-	// The port the Pi-Hole exposes that can be used for HTTP/S traffic
-	PiHolePort int `json:"pi_hole_port"`
+	// The base URL of the Pi-Hole's web interface (i.e. http://192.168.1.2, https://pihole.lan/pihole)
+	PiHoleURL string `json:"pi_hole_url"`
+	// The Pi-Hole's address, as stored by older versions of Pi-CLI. Migrated to PiHoleURL when loaded
+	PiHoleAddress string `json:"pi_hole_address,omitempty"`
+	// The Pi-Hole's port, as stored by older versions of Pi-CLI. Migrated to PiHoleURL when loaded
+	PiHolePort int `json:"pi_hole_port,omitempty"`
 	// The number of seconds to wait between each data refresh
 	RefreshS int `json:"refresh_s"`
 	// API key used to authenticate with the Pi-Hole instance
 	APIKey string `json:"api_key"`
+	// Options for connecting to a Pi-Hole served over HTTPS
+	TLS *network.TLSOptions `json:"tls,omitempty"`
+	// Options for retrying failed requests to the Pi-Hole
+	Retry *network.RetryOptions `json:"retry,omitempty"`
+	// Options for reaching the Pi-Hole through a proxy or SSH jump host
+	Proxy *network.ProxyOptions `json:"proxy,omitempty"`
 }
 
 // Generate the location of the config file (or at least where it should be)
@@ -48,10 +78,9 @@ func ConfigFileExists() bool {
 // Return a new Settings instance
 func NewSettings() *Settings {
 	return &Settings{
-		PiHoleAddress: "",
-		PiHolePort:    DefaultPort,
-		RefreshS:      DefaultRefreshS,
-		APIKey:        "",
+		PiHoleURL: "",
+		RefreshS:  DefaultRefreshS,
+		APIKey:    "",
 	}
 }
 
@@ -64,6 +93,33 @@ func (settings *Settings) LoadFromFile() {
 			log.Fatal(err)
 		}
 	}
+
+	// save the migrated settings so that the config file only needs to be migrated once
+	if settings.migrate() {
+		if err := settings.SaveToFile(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+/*
+Migrates settings stored by older versions of Pi-CLI, which stored the Pi-Hole's address and
+port rather than its base URL. Returns true if anything was migrated.
+*/
+func (settings *Settings) migrate() bool {
+	if settings.PiHoleAddress == "" {
+		return false
+	}
+	if settings.PiHoleURL == "" {
+		port := settings.PiHolePort
+		if port == 0 {
+			port = DefaultPort
+		}
+		settings.PiHoleURL = network.LegacyBaseURL(settings.PiHoleAddress, port)
+	}
+	settings.PiHoleAddress = ""
+	settings.PiHolePort = 0
+	return true
 }
 
 // Saves the current settings to a config file
@@ -95,19 +151,40 @@ func DeleteConfigFile() bool {
 	return true
 }
 
-// Return the path to the config file
+/*
+Switches to a named profile, which has its own config file (i.e. picli-config-work.json) so that
+more than one Pi-Hole can be configured. An empty name switches back to the default profile.
+*/
+func UseProfile(name string) error {
+	if name != "" && !validProfileName.MatchString(name) {
+		return fmt.Errorf("'%s' is not a valid profile name (use letters, numbers, '-' and '_')", name)
+	}
+	Profile = name
+	configFileLocation = GetConfigFileLocation()
+	return nil
+}
+
+// Return the path to the config file of the profile in use
 func GetConfigFileLocation() string {
+	if Profile == "" {
+		return homeFileLocation(ConfigFileName)
+	}
+	return homeFileLocation(strings.TrimSuffix(ConfigFileName, ".json") + "-" + Profile + ".json")
+}
+
+// Return the path to a file in the user's home directory
+func homeFileLocation(fileName string) string {
 	usr, err := user.Current()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	/*
-		Return user's home directory plus the config file name. If on Windows, make sure path is returned
+		Return user's home directory plus the file name. If on Windows, make sure path is returned
 		with backslashes as the directory separators rather than forward slashes
 	*/
 	if runtime.GOOS == "windows" {
-		return strings.ReplaceAll(path.Join(usr.HomeDir, ConfigFileName), "/", "\\")
+		return strings.ReplaceAll(path.Join(usr.HomeDir, fileName), "/", "\\")
 	}
-	return path.Join(usr.HomeDir, ConfigFileName)
+	return path.Join(usr.HomeDir, fileName)
 }
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Tests for data.Settings.migrate() on a config file saved by an older version of Pi-CLI
+func TestSettingsMigrate(t *testing.T) {
+	settings := NewSettings()
+	if err := json.Unmarshal([]byte(`{"pi_hole_address": "192.168.1.2", "pi_hole_port": 8080, "refresh_s": 2}`), settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if !settings.migrate() {
+		t.Fatal("@TestSettingsMigrate: data.Settings.migrate() did not migrate an address and port")
+	}
+	if settings.PiHoleURL != "http://192.168.1.2:8080" || settings.PiHoleAddress != "" || settings.PiHolePort != 0 {
+		t.Errorf("@TestSettingsMigrate: unexpected migrated settings %+v", settings)
+	}
+	if settings.migrate() {
+		t.Error("@TestSettingsMigrate: data.Settings.migrate() migrated settings that were already migrated")
+	}
+
+	// the old fields aren't written back out once migrated
+	saved, _ := json.Marshal(settings)
+	expected := `{"pi_hole_url":"http://192.168.1.2:8080","refresh_s":2,"api_key":""}`
+	if string(saved) != expected {
+		t.Errorf("@TestSettingsMigrate: saved %s, expected %s", saved, expected)
+	}
+}
+
+// Tests for data.UseProfile()
+func TestUseProfile(t *testing.T) {
+	defaultLocation := GetConfigFileLocation()
+	defer func() { _ = UseProfile("") }()
+
+	if err := UseProfile("work-lab_2"); err != nil {
+		t.Fatalf("@TestUseProfile: %s", err.Error())
+	}
+	if location := GetConfigFileLocation(); !strings.HasSuffix(location, "picli-config-work-lab_2.json") || configFileLocation != location {
+		t.Errorf("@TestUseProfile: unexpected config file location %s", location)
+	}
+
+	for _, name := range []string{"../escape", "a/b", "with space"} {
+		if err := UseProfile(name); err == nil {
+			t.Errorf("@TestUseProfile: invalid profile name %q was accepted", name)
+		}
+	}
+
+	if err := UseProfile(""); err != nil || GetConfigFileLocation() != defaultLocation {
+		t.Errorf("@TestUseProfile: the default profile wasn't restored")
+	}
+}
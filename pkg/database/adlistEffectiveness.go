@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// The name that the gravity database is attached under when it's joined with the FTL database
+const attachedGravitySchema = "gravitydb"
+
+// How much blocking a single adlist was responsible for
+type AdlistMatches struct {
+	// The adlist's ID
+	ID int `json:"id"`
+	// The URL that the adlist is downloaded from
+	Address string `json:"address"`
+	// Is the adlist enabled?
+	Enabled bool `json:"enabled"`
+	// The number of domains that the adlist contributed to gravity
+	Domains int `json:"domains"`
+	// The number of distinct blocked domains that were found in the adlist
+	MatchedDomains int `json:"matched_domains"`
+	// The number of those domains that no other adlist contains
+	UniqueMatches int `json:"unique_matches"`
+	// The total number of blocked queries for domains found in the adlist
+	Queries int `json:"queries"`
+}
+
+// A report on which adlists actually blocked queries inside of a window of time
+type AdlistEffectivenessReport struct {
+	// Per adlist effectiveness, most effective first
+	Adlists []AdlistMatches `json:"adlists"`
+	// The total number of queries blocked by gravity inside of the window
+	GravityBlocked int `json:"gravity_blocked"`
+	// Queries blocked by gravity for domains that are no longer in any adlist
+	Unattributed int `json:"unattributed"`
+	// The window of time that the report covers
+	Window *TimeWindow `json:"-"`
+}
+
+/*
+	Works out which adlists are responsible for the queries that gravity has blocked, by joining
+	the blocked domains in the FTL database against the domains in the gravity database.
+
+	A domain can be found in more than one adlist, in which case each of those adlists is credited
+	with the block. UniqueMatches counts the blocked domains that only one adlist contains, which
+	are the blocks that would be lost if that adlist was removed.
+
+	Gravity only reflects the adlists as they are now, so queries blocked before a domain was
+	dropped from its adlists can't be attributed to any of them; these are counted separately.
+*/
+func AdlistEffectiveness(db *sql.DB, gravityPath string, window *TimeWindow) (*AdlistEffectivenessReport, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	if err := doesDatabaseFileExist(gravityPath); err != nil {
+		return nil, err
+	}
+
+	// attached databases are per connection, so everything has to run on the same one
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(
+		ctx,
+		fmt.Sprintf("ATTACH DATABASE ? AS %s", attachedGravitySchema),
+		readOnlyDSN(gravityPath)); err != nil {
+		return nil, fmt.Errorf("unable to open the gravity database: %s", err.Error())
+	}
+	defer conn.ExecContext(ctx, fmt.Sprintf("DETACH DATABASE %s", attachedGravitySchema))
+
+	var gravityTables int
+	if err := conn.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s.sqlite_master WHERE type = 'table' AND name IN ('adlist', 'gravity')
+	`, attachedGravitySchema)).Scan(&gravityTables); err != nil || gravityTables != 2 {
+		return nil, ErrNotGravityDatabase
+	}
+
+	/*
+		Queries blocked by a CNAME found in gravity record the blocked CNAME target in
+		additional_info, rather than the domain that the client asked for
+	*/
+	blockedDomain := "domain"
+	if tableHasColumn(db, "queries", "additional_info") {
+		blockedDomain = "CASE WHEN status = 9 AND additional_info IS NOT NULL THEN additional_info ELSE domain END"
+	}
+
+	since, until := window.Bounds()
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`
+		WITH blocked AS (
+			SELECT %[1]s AS domain, COUNT(*) AS queries
+			FROM queries
+			WHERE status IN (1, 9) AND timestamp BETWEEN ? AND ?
+			GROUP BY 1
+		),
+		matches AS (
+			SELECT g.adlist_id, b.domain, b.queries
+			FROM blocked b
+			INNER JOIN %[2]s.gravity g ON g.domain = b.domain
+		),
+		match_lists AS (
+			SELECT domain, COUNT(DISTINCT adlist_id) AS lists
+			FROM matches
+			GROUP BY domain
+		),
+		list_sizes AS (
+			SELECT adlist_id, COUNT(*) AS domains
+			FROM %[2]s.gravity
+			GROUP BY adlist_id
+		)
+		SELECT a.id, a.address, a.enabled,
+		       COALESCE((SELECT domains FROM list_sizes WHERE adlist_id = a.id), 0),
+		       COUNT(m.domain),
+		       COALESCE(SUM(CASE WHEN ml.lists = 1 THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(m.queries), 0),
+		       (SELECT COALESCE(SUM(queries), 0) FROM blocked),
+		       (SELECT COALESCE(SUM(queries), 0) FROM blocked WHERE domain NOT IN (SELECT domain FROM match_lists))
+		FROM %[2]s.adlist a
+		LEFT JOIN matches m ON m.adlist_id = a.id
+		LEFT JOIN match_lists ml ON ml.domain = m.domain
+		GROUP BY a.id
+		ORDER BY 7 DESC, a.id
+	`, blockedDomain, attachedGravitySchema), since, until)
+
+	if err != nil {
+		return nil, fmt.Errorf("error in adlist effectiveness query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	report := &AdlistEffectivenessReport{Window: window}
+	for rows.Next() {
+		var adlist AdlistMatches
+		if err := rows.Scan(
+			&adlist.ID,
+			&adlist.Address,
+			&adlist.Enabled,
+			&adlist.Domains,
+			&adlist.MatchedDomains,
+			&adlist.UniqueMatches,
+			&adlist.Queries,
+			&report.GravityBlocked,
+			&report.Unattributed); err != nil {
+			return nil, fmt.Errorf("error reading adlist effectiveness: %s", err.Error())
+		}
+		report.Adlists = append(report.Adlists, adlist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading adlist effectiveness: %s", err.Error())
+	}
+
+	return report, nil
+}
+
+// The adlists that didn't match a single blocked query inside of the window
+func (report *AdlistEffectivenessReport) Unmatched() []AdlistMatches {
+	var unmatched []AdlistMatches
+	for _, adlist := range report.Adlists {
+		if adlist.Queries == 0 {
+			unmatched = append(unmatched, adlist)
+		}
+	}
+	return unmatched
+}
+
+// Writes the report to stdout in a given format
+func (report *AdlistEffectivenessReport) Print(format OutputFormat) {
+	var records [][]string
+	for _, adlist := range report.Adlists {
+		records = append(records, []string{
+			strconv.Itoa(adlist.ID),
+			adlist.Address,
+			enabledString(adlist.Enabled),
+			strconv.Itoa(adlist.Domains),
+			strconv.Itoa(adlist.MatchedDomains),
+			strconv.Itoa(adlist.UniqueMatches),
+			strconv.Itoa(adlist.Queries),
+		})
+	}
+	header := []string{"ID", "Address", "Enabled", "Domains", "Matched", "Unique", "Queries"}
+
+	switch format {
+	case JSONOutput:
+		adlists := report.Adlists
+		if adlists == nil {
+			adlists = []AdlistMatches{}
+		}
+		writeJSON(struct {
+			Window         string          `json:"window"`
+			GravityBlocked int             `json:"gravity_blocked"`
+			Unattributed   int             `json:"unattributed"`
+			Adlists        []AdlistMatches `json:"adlists"`
+		}{
+			Window:         report.Window.String(),
+			GravityBlocked: report.GravityBlocked,
+			Unattributed:   report.Unattributed,
+			Adlists:        adlists,
+		})
+	case CSVOutput:
+		writeCSV(header, records)
+	default:
+		localisedNumberWriter := message.NewPrinter(language.English)
+
+		color.Yellow("Window: %s", report.Window)
+		color.Yellow(
+			"%s queries blocked by gravity\n\n",
+			localisedNumberWriter.Sprintf("%d", report.GravityBlocked))
+
+		printRecordsTable(header, records)
+
+		if report.Unattributed > 0 {
+			color.Yellow(
+				"\n%s blocked queries were for domains that are no longer in any adlist",
+				localisedNumberWriter.Sprintf("%d", report.Unattributed))
+		}
+
+		if unmatched := report.Unmatched(); len(unmatched) > 0 {
+			fmt.Println()
+			color.Red("%d of %d adlists did not block a single query:", len(unmatched), len(report.Adlists))
+			for _, adlist := range unmatched {
+				fmt.Printf("  %d  %s\n", adlist.ID, adlist.Address)
+			}
+		}
+	}
+}
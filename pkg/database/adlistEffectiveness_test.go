@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests for database.AdlistEffectiveness()
+func TestAdlistEffectiveness(t *testing.T) {
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT, additional_info TEXT)",
+		// shared.com is in both adlists, unique.com only in adlist 1
+		"INSERT INTO queries (timestamp, status, domain) VALUES (100, 1, 'shared.com'), (200, 1, 'shared.com'), (300, 1, 'unique.com')",
+		// blocked by a CNAME, the blocked target is in additional_info
+		"INSERT INTO queries (timestamp, status, domain, additional_info) VALUES (400, 9, 'alias.com', 'unique.com')",
+		// no longer in any adlist
+		"INSERT INTO queries (timestamp, status, domain) VALUES (500, 1, 'removed.com')",
+		// not blocked by gravity
+		"INSERT INTO queries (timestamp, status, domain) VALUES (600, 2, 'unique.com'), (700, 5, 'shared.com')",
+	)
+
+	gravityPath := filepath.Join(t.TempDir(), "gravity.db")
+	gravity, err := sql.Open(DBDriverName, gravityPath)
+	if err != nil {
+		t.Fatalf("failed to create test gravity database: %s", err)
+	}
+	for _, statement := range []string{
+		"CREATE TABLE adlist (id INTEGER PRIMARY KEY, address TEXT, enabled BOOLEAN)",
+		"CREATE TABLE gravity (domain TEXT, adlist_id INTEGER)",
+		"INSERT INTO adlist VALUES (1, 'https://one', 1), (2, 'https://two', 1), (3, 'https://three', 1)",
+		"INSERT INTO gravity VALUES ('shared.com', 1), ('unique.com', 1), ('shared.com', 2), ('other.com', 3)",
+	} {
+		if _, err := gravity.Exec(statement); err != nil {
+			t.Fatalf("failed to set up test gravity database: %s", err)
+		}
+	}
+	_ = gravity.Close()
+
+	report, err := AdlistEffectiveness(db, gravityPath, nil)
+	if err != nil {
+		t.Fatalf("@TestAdlistEffectiveness: database.AdlistEffectiveness() failed: %s", err)
+	}
+
+	if report.GravityBlocked != 5 || report.Unattributed != 1 {
+		t.Errorf(
+			"@TestAdlistEffectiveness: expected 5 gravity blocked and 1 unattributed queries, got %d and %d",
+			report.GravityBlocked,
+			report.Unattributed)
+	}
+
+	expected := []AdlistMatches{
+		{ID: 1, Address: "https://one", Enabled: true, Domains: 2, MatchedDomains: 2, UniqueMatches: 1, Queries: 4},
+		{ID: 2, Address: "https://two", Enabled: true, Domains: 1, MatchedDomains: 1, UniqueMatches: 0, Queries: 2},
+		{ID: 3, Address: "https://three", Enabled: true, Domains: 1, MatchedDomains: 0, UniqueMatches: 0, Queries: 0},
+	}
+	if len(report.Adlists) != len(expected) {
+		t.Fatalf("@TestAdlistEffectiveness: expected %d adlists, got %d", len(expected), len(report.Adlists))
+	}
+	for i, adlist := range expected {
+		if report.Adlists[i] != adlist {
+			t.Errorf("@TestAdlistEffectiveness: expected %+v, got %+v", adlist, report.Adlists[i])
+		}
+	}
+
+	if unmatched := report.Unmatched(); len(unmatched) != 1 || unmatched[0].ID != 3 {
+		t.Errorf("@TestAdlistEffectiveness: expected only adlist 3 to be unmatched, got %+v", unmatched)
+	}
+
+	window := &TimeWindow{Since: time.Unix(250, 0), Until: time.Unix(450, 0)}
+	if report, err := AdlistEffectiveness(db, gravityPath, window); err != nil || report.GravityBlocked != 2 {
+		t.Errorf("@TestAdlistEffectiveness: expected 2 gravity blocked queries inside of the window, got %+v (%v)", report, err)
+	}
+
+	if _, err := AdlistEffectiveness(db, filepath.Join(t.TempDir(), "empty.db"), nil); err == nil {
+		t.Error("@TestAdlistEffectiveness: database.AdlistEffectiveness() did not reject a missing gravity database")
+	}
+
+	otherPath := filepath.Join(t.TempDir(), "other.db")
+	other, _ := sql.Open(DBDriverName, otherPath)
+	_, _ = other.Exec("CREATE TABLE a (b)")
+	_ = other.Close()
+	if _, err := AdlistEffectiveness(db, otherPath, nil); !errors.Is(err, ErrNotGravityDatabase) {
+		t.Errorf("@TestAdlistEffectiveness: expected ErrNotGravityDatabase, got %v", err)
+	}
+}
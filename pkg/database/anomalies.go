@@ -0,0 +1,445 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Anomaly detection constants
+const (
+	// The default length of the recent period that is checked for anomalies
+	DefaultAnomalyRecentPeriod = time.Hour * 24
+	// The default length of the history before the recent period that baselines are built from
+	DefaultAnomalyBaselinePeriod = time.Hour * 24 * 14
+	// The default number of standard deviations from the baseline that counts as an anomaly
+	DefaultAnomalyThreshold = 3.0
+	// The number of hours of history a client needs before a baseline is built for it
+	minimumBaselineHours = 24
+	/*
+		The smallest standard deviation used when scoring, so that a client with a perfectly
+		steady baseline isn't flagged for a deviation of a single query
+	*/
+	minimumBaselineStdDev = 1.0
+)
+
+// Metrics that client baselines are built from
+const (
+	// The number of queries made in an hour
+	AnomalyMetricQueries = "queries"
+	// The number of distinct domains queried in an hour
+	AnomalyMetricDistinctDomains = "distinct domains"
+	// The percentage of an hour's queries that were blocked
+	AnomalyMetricBlockRate = "block rate"
+)
+
+// The mean and standard deviation of a metric over a client's baseline
+type MetricBaseline struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+}
+
+// An hour in which a client's behaviour deviated from its baseline
+type Anomaly struct {
+	// The client's address
+	Client string `json:"client"`
+	// The client's host name, if it is known
+	Name string `json:"name"`
+	// Unix time of the start of the hour
+	Hour int64 `json:"hour"`
+	// The metric that deviated
+	Metric string `json:"metric"`
+	// The metric's value during the hour
+	Value float64 `json:"value"`
+	// The client's baseline for the metric
+	Baseline MetricBaseline `json:"baseline"`
+	// How many standard deviations the value is from the baseline's mean
+	ZScore float64 `json:"z_score"`
+}
+
+// A client querying a domain that had never been seen on the network before the recent period
+type NewDomainSighting struct {
+	// The client's address
+	Client string `json:"client"`
+	// The client's host name, if it is known
+	Name string `json:"name"`
+	// The domain
+	Domain string `json:"domain"`
+	// Unix time of the client's first query for the domain
+	FirstSeen int64 `json:"first_seen"`
+	// The number of times the client queried the domain
+	Queries int `json:"queries"`
+}
+
+// The result of checking the recent period for anomalies
+type AnomalyReport struct {
+	// Unix times of the start and end of the baseline and recent periods
+	BaselineSince int64 `json:"baseline_since"`
+	RecentSince   int64 `json:"recent_since"`
+	RecentUntil   int64 `json:"recent_until"`
+	// The number of standard deviations from the baseline that counts as an anomaly
+	Threshold float64 `json:"threshold"`
+	// Hours in which a client deviated from its baseline, biggest deviations first
+	Anomalies []Anomaly `json:"anomalies"`
+	// Clients querying domains never seen on the network before, most queried first
+	NewDomains []NewDomainSighting `json:"new_domains"`
+	// The total number of new domain sightings, which can be more than are listed
+	TotalNewDomains int `json:"total_new_domains"`
+	// Clients active in the recent period without enough history to build a baseline
+	InsufficientHistory []string `json:"insufficient_history"`
+}
+
+// The values of each metric during a single hour of a single client's activity
+type clientHour struct {
+	queries         float64
+	distinctDomains float64
+	blocked         float64
+}
+
+/*
+	Looks for clients whose behaviour in the recent period deviates from their own history. For
+	each client, baselines of their hourly query volume, number of distinct domains and block rate
+	are built from the baseline period. Each hour of the recent period is then scored against the
+	baselines, and hours that are more than threshold standard deviations away are flagged.
+
+	Clients that contacted domains that had never been seen on the network before the recent
+	period are also listed, up to limit sightings.
+
+	The recent period ends at the most recent query in the database, so snapshots taken some time
+	ago can be checked just the same as a live database.
+*/
+func Anomalies(
+	db *sql.DB,
+	recent time.Duration,
+	baseline time.Duration,
+	threshold float64,
+	limit int) (*AnomalyReport, error) {
+
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	if recent <= 0 {
+		recent = DefaultAnomalyRecentPeriod
+	}
+	if baseline <= 0 {
+		baseline = DefaultAnomalyBaselinePeriod
+	}
+	if threshold <= 0 {
+		threshold = DefaultAnomalyThreshold
+	}
+	if limit <= 0 {
+		limit = DefaultQueryTableLimit
+	}
+
+	var latest sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(timestamp) FROM queries").Scan(&latest); err != nil {
+		return nil, fmt.Errorf("error reading the latest query (schema v%d): %s", schema.Version, err.Error())
+	}
+
+	report := &AnomalyReport{
+		RecentUntil:         latest.Int64,
+		Threshold:           threshold,
+		Anomalies:           []Anomaly{},
+		NewDomains:          []NewDomainSighting{},
+		InsufficientHistory: []string{},
+	}
+	// align the periods to whole hours, so that the recent period's hours line up with the baseline's
+	recentSinceHour := (report.RecentUntil - int64(recent.Seconds())) / 3600
+	baselineSinceHour := recentSinceHour - int64(baseline.Hours())
+	report.RecentSince = recentSinceHour * 3600
+	report.BaselineSince = baselineSinceHour * 3600
+
+	names, err := clientNames(db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT client, timestamp / 3600, COUNT(*), COUNT(DISTINCT domain), SUM(status IN (%s))
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		GROUP BY client, timestamp / 3600
+		ORDER BY client, timestamp / 3600
+	`, blockedStatusSQLList()), report.BaselineSince, report.RecentUntil)
+	if err != nil {
+		return nil, fmt.Errorf("error in database anomalies query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	// every hour that each client was active, keyed by client and then by hour
+	activity := make(map[string]map[int64]clientHour)
+	for rows.Next() {
+		var client string
+		var hourIndex int64
+		var hour clientHour
+		if err := rows.Scan(&client, &hourIndex, &hour.queries, &hour.distinctDomains, &hour.blocked); err != nil {
+			return nil, fmt.Errorf("error reading client activity: %s", err.Error())
+		}
+		if activity[client] == nil {
+			activity[client] = make(map[int64]clientHour)
+		}
+		activity[client][hourIndex] = hour
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading client activity: %s", err.Error())
+	}
+
+	for client, hours := range activity {
+		report.Anomalies = append(
+			report.Anomalies,
+			scoreClient(report, client, names.Name(client), hours, baselineSinceHour, recentSinceHour)...)
+	}
+
+	sort.Strings(report.InsufficientHistory)
+	sort.Slice(report.Anomalies, func(i, j int) bool {
+		if math.Abs(report.Anomalies[i].ZScore) != math.Abs(report.Anomalies[j].ZScore) {
+			return math.Abs(report.Anomalies[i].ZScore) > math.Abs(report.Anomalies[j].ZScore)
+		}
+		if report.Anomalies[i].Hour != report.Anomalies[j].Hour {
+			return report.Anomalies[i].Hour < report.Anomalies[j].Hour
+		}
+		if report.Anomalies[i].Client != report.Anomalies[j].Client {
+			return report.Anomalies[i].Client < report.Anomalies[j].Client
+		}
+		return report.Anomalies[i].Metric < report.Anomalies[j].Metric
+	})
+
+	if err := report.findNewDomains(db, schema, names, limit); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+/*
+	Builds a client's baselines and scores each of their hours in the recent period against them.
+	Baselines start at the client's first active hour inside of the baseline period, so that a
+	client that joined the network part way through isn't given a baseline full of idle hours.
+*/
+func scoreClient(
+	report *AnomalyReport,
+	client string,
+	name string,
+	hours map[int64]clientHour,
+	baselineSinceHour int64,
+	recentSinceHour int64) []Anomaly {
+
+	firstHour := recentSinceHour
+	for hourIndex := range hours {
+		if hourIndex >= baselineSinceHour && hourIndex < firstHour {
+			firstHour = hourIndex
+		}
+	}
+
+	var volumes, distinctDomains, blockRates []float64
+	for hourIndex := firstHour; hourIndex < recentSinceHour; hourIndex++ {
+		hour := hours[hourIndex]
+		volumes = append(volumes, hour.queries)
+		distinctDomains = append(distinctDomains, hour.distinctDomains)
+		if hour.queries >= minimumBlockRateQueries {
+			blockRates = append(blockRates, hour.blocked/hour.queries*100)
+		}
+	}
+
+	var anomalies []Anomaly
+	if len(volumes) < minimumBaselineHours {
+		for hourIndex := range hours {
+			if hourIndex >= recentSinceHour {
+				report.InsufficientHistory = append(report.InsufficientHistory, client)
+				break
+			}
+		}
+		return anomalies
+	}
+
+	baselines := map[string]MetricBaseline{
+		AnomalyMetricQueries:         newMetricBaseline(volumes),
+		AnomalyMetricDistinctDomains: newMetricBaseline(distinctDomains),
+		AnomalyMetricBlockRate:       newMetricBaseline(blockRates),
+	}
+
+	for hourIndex, hour := range hours {
+		if hourIndex < recentSinceHour {
+			continue
+		}
+		values := map[string]float64{
+			AnomalyMetricQueries:         hour.queries,
+			AnomalyMetricDistinctDomains: hour.distinctDomains,
+			AnomalyMetricBlockRate:       hour.blocked / hour.queries * 100,
+		}
+		for _, metric := range []string{AnomalyMetricQueries, AnomalyMetricDistinctDomains, AnomalyMetricBlockRate} {
+			// block rates are only scored for hours with enough queries for them to be meaningful
+			if metric == AnomalyMetricBlockRate && (len(blockRates) == 0 || hour.queries < minimumBlockRateQueries) {
+				continue
+			}
+			baseline := baselines[metric]
+			if score := zScore(values[metric], baseline); math.Abs(score) >= report.Threshold {
+				anomalies = append(anomalies, Anomaly{
+					Client:   client,
+					Name:     name,
+					Hour:     hourIndex * 3600,
+					Metric:   metric,
+					Value:    values[metric],
+					Baseline: baseline,
+					ZScore:   score,
+				})
+			}
+		}
+	}
+
+	return anomalies
+}
+
+// Lists clients that queried domains in the recent period that had never been seen before it
+func (report *AnomalyReport) findNewDomains(db *sql.DB, schema *Schema, names *clients.Directory, limit int) error {
+	rows, err := db.Query(`
+		SELECT client, domain, MIN(timestamp), COUNT(*)
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		AND domain NOT IN (SELECT domain FROM queries WHERE timestamp < ?)
+		GROUP BY client, domain
+		ORDER BY COUNT(*) DESC, MIN(timestamp), domain
+	`, report.RecentSince, report.RecentUntil, report.RecentSince)
+	if err != nil {
+		return fmt.Errorf("error in database new domains query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		report.TotalNewDomains++
+		if len(report.NewDomains) == limit {
+			continue
+		}
+		var sighting NewDomainSighting
+		if err := rows.Scan(&sighting.Client, &sighting.Domain, &sighting.FirstSeen, &sighting.Queries); err != nil {
+			return fmt.Errorf("error reading new domain: %s", err.Error())
+		}
+		sighting.Name = names.Name(sighting.Client)
+		report.NewDomains = append(report.NewDomains, sighting)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading new domains: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Calculates the mean and (population) standard deviation of a set of values
+func newMetricBaseline(values []float64) MetricBaseline {
+	if len(values) == 0 {
+		return MetricBaseline{}
+	}
+
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+
+	return MetricBaseline{Mean: mean, StdDev: math.Sqrt(squares / float64(len(values)))}
+}
+
+// How many standard deviations a value is from a baseline's mean
+func zScore(value float64, baseline MetricBaseline) float64 {
+	return (value - baseline.Mean) / math.Max(baseline.StdDev, minimumBaselineStdDev)
+}
+
+// Writes the report to stdout in a given format. CSV isn't supported, as the report isn't a single table
+func (report *AnomalyReport) Print(format OutputFormat) {
+	if format == JSONOutput {
+		writeJSON(report)
+		return
+	}
+
+	localisedNumberWriter := message.NewPrinter(language.English)
+
+	color.Yellow(
+		"Baseline: %s -> %s",
+		FormattedDBUnixTimestamp(int(report.BaselineSince)),
+		FormattedDBUnixTimestamp(int(report.RecentSince)))
+	color.Yellow(
+		"Recent:   %s -> %s",
+		FormattedDBUnixTimestamp(int(report.RecentSince)),
+		FormattedDBUnixTimestamp(int(report.RecentUntil)))
+	color.Yellow("Threshold: %.1f standard deviations", report.Threshold)
+
+	fmt.Println()
+	color.Cyan("Hours that deviated from the client's baseline")
+	if len(report.Anomalies) == 0 {
+		color.Green("None")
+	} else {
+		var records [][]string
+		for _, anomaly := range report.Anomalies {
+			records = append(records, []string{
+				anomaly.Client,
+				anomaly.Name,
+				FormattedDBUnixTimestamp(int(anomaly.Hour)),
+				anomaly.Metric,
+				formattedMetric(anomaly.Metric, anomaly.Value),
+				fmt.Sprintf(
+					"%s ± %s",
+					formattedMetric(anomaly.Metric, anomaly.Baseline.Mean),
+					formattedMetric(anomaly.Metric, anomaly.Baseline.StdDev)),
+				strconv.FormatFloat(anomaly.ZScore, 'f', 1, 64),
+			})
+		}
+		printRecordsTable([]string{"Client", "DNS", "Hour", "Metric", "Value", "Baseline", "z"}, records)
+	}
+
+	fmt.Println()
+	color.Cyan("Domains never seen on the network before")
+	if len(report.NewDomains) == 0 {
+		color.Green("None")
+	} else {
+		var records [][]string
+		for _, sighting := range report.NewDomains {
+			records = append(records, []string{
+				sighting.Client,
+				sighting.Name,
+				sighting.Domain,
+				FormattedDBUnixTimestamp(int(sighting.FirstSeen)),
+				localisedNumberWriter.Sprintf("%d", sighting.Queries),
+			})
+		}
+		printRecordsTable([]string{"Client", "DNS", "Domain", "First seen", "Queries"}, records)
+		if report.TotalNewDomains > len(report.NewDomains) {
+			color.Yellow(
+				"%s more not shown (use --limit to show more)",
+				localisedNumberWriter.Sprintf("%d", report.TotalNewDomains-len(report.NewDomains)))
+		}
+	}
+
+	if len(report.InsufficientHistory) > 0 {
+		fmt.Println()
+		color.Yellow(
+			"Not enough history to build a baseline for %d client(s): %v",
+			len(report.InsufficientHistory),
+			report.InsufficientHistory)
+	}
+}
+
+// Formats the value of a metric for display
+func formattedMetric(metric string, value float64) string {
+	if metric == AnomalyMetricBlockRate {
+		return fmt.Sprintf("%.1f%%", value)
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Tests for database.Anomalies()
+func TestAnomalies(t *testing.T) {
+	statements := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	}
+
+	const start = 3600 * 1000
+	// two days of history, with the steady client making 2 queries for the same domain every hour
+	for hour := 0; hour < 48; hour++ {
+		for i := 0; i < 2; i++ {
+			statements = append(statements, fmt.Sprintf(
+				"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (%d, 1, 2, 'example.com', '10.0.0.1')",
+				start+hour*3600+i))
+		}
+	}
+	// the final hour holds a spike in volume and a domain never seen before
+	for i := 0; i < 30; i++ {
+		statements = append(statements, fmt.Sprintf(
+			"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (%d, 1, 2, 'c2.evil.com', '10.0.0.1')",
+			start+47*3600+100+i))
+	}
+	// a client with no history at all
+	statements = append(statements,
+		fmt.Sprintf("INSERT INTO queries (timestamp, type, status, domain, client) VALUES (%d, 1, 2, 'example.com', '10.0.0.2')", start+47*3600))
+
+	report, err := Anomalies(newTestDatabase(t, statements...), time.Hour, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("@TestAnomalies: database.Anomalies() failed: %s", err)
+	}
+
+	if len(report.Anomalies) == 0 {
+		t.Fatal("@TestAnomalies: expected the spike to be flagged as an anomaly")
+	}
+	flagged := map[string]bool{}
+	for _, anomaly := range report.Anomalies {
+		if anomaly.Client != "10.0.0.1" || anomaly.Hour != start+47*3600 {
+			t.Errorf("@TestAnomalies: unexpected anomaly %+v", anomaly)
+		}
+		flagged[anomaly.Metric] = true
+	}
+	if !flagged[AnomalyMetricQueries] || flagged[AnomalyMetricBlockRate] {
+		t.Errorf("@TestAnomalies: expected only volume based anomalies, got %+v", report.Anomalies)
+	}
+
+	if len(report.NewDomains) != 1 || report.NewDomains[0].Domain != "c2.evil.com" || report.NewDomains[0].Queries != 30 {
+		t.Errorf("@TestAnomalies: expected c2.evil.com to be a new domain, got %+v", report.NewDomains)
+	}
+
+	if len(report.InsufficientHistory) != 1 || report.InsufficientHistory[0] != "10.0.0.2" {
+		t.Errorf("@TestAnomalies: expected 10.0.0.2 to have insufficient history, got %v", report.InsufficientHistory)
+	}
+}
+
+// Tests for database.newMetricBaseline() and database.zScore()
+func TestMetricBaseline(t *testing.T) {
+	baseline := newMetricBaseline([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if baseline.Mean != 5 || baseline.StdDev != 2 {
+		t.Errorf("@TestMetricBaseline: expected a mean of 5 and standard deviation of 2, got %+v", baseline)
+	}
+	if score := zScore(11, baseline); score != 3 {
+		t.Errorf("@TestMetricBaseline: expected a z-score of 3, got %f", score)
+	}
+
+	// a perfectly steady baseline uses the minimum standard deviation rather than dividing by zero
+	if score := zScore(3, newMetricBaseline([]float64{1, 1, 1})); math.IsInf(score, 0) || score != 2 {
+		t.Errorf("@TestMetricBaseline: expected a z-score of 2 against a steady baseline, got %f", score)
+	}
+}
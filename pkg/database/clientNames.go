@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+)
+
+/*
+	Names for clients that don't come from the database itself, i.e. the user's aliases and
+	DHCP leases. Reports merge these with the host names that FTL stored in its network table,
+	with these taking precedence.
+*/
+var KnownClientNames = clients.NewDirectory()
+
+// Returns the names of the clients in a database, merged with KnownClientNames
+func ClientNames(db *sql.DB) (*clients.Directory, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	return clientNames(db, schema)
+}
+
+// Reads the host name of each client address that FTL has found one for, merged with KnownClientNames
+func clientNames(db *sql.DB, schema *Schema) (*clients.Directory, error) {
+	rows, err := db.Query(schema.clientNamesQuery())
+	if err != nil {
+		return nil, fmt.Errorf("error in database client names query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	names := KnownClientNames.Copy()
+	for rows.Next() {
+		var ip, name string
+		if err := rows.Scan(&ip, &name); err != nil {
+			return nil, fmt.Errorf("error reading client name: %s", err.Error())
+		}
+		names.Add(ip, name, clients.NetworkSource)
+	}
+	return names, nil
+}
+
+/*
+	Returns the name known for a device in the network table, which can be given by its hardware
+	address or by any of the IP addresses that FTL has seen it use
+*/
+func knownDeviceName(db *sql.DB, schema *Schema, hwaddr string) (string, error) {
+	if name := KnownClientNames.Name(hwaddr); name != "" {
+		return name, nil
+	}
+
+	var query string
+	if schema.HasNetworkAddresses {
+		query = `
+			SELECT na.ip
+			FROM network n
+			INNER JOIN network_addresses na ON n.id = na.network_id
+			WHERE n.hwaddr = ?`
+	} else if schema.HasNetworkIPs {
+		query = "SELECT ip FROM network WHERE hwaddr = ?"
+	} else {
+		return "", nil
+	}
+
+	rows, err := db.Query(query, hwaddr)
+	if err != nil {
+		return "", fmt.Errorf("error in database device addresses query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return "", fmt.Errorf("error reading device address: %s", err.Error())
+		}
+		if name := KnownClientNames.Name(ip); name != "" {
+			return name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+)
+
+// Tests for database.ClientNames(), merging the network table's names with KnownClientNames
+func TestClientNames(t *testing.T) {
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+		"CREATE TABLE network (id INTEGER PRIMARY KEY, hwaddr TEXT)",
+		"CREATE TABLE network_addresses (network_id INTEGER, ip TEXT, name TEXT)",
+		"INSERT INTO network_addresses VALUES (1, '10.0.0.1', 'laptop.lan'), (2, '10.0.0.2', 'esp-3a41f2.lan')",
+	)
+
+	known := clients.NewDirectory()
+	known.Add("10.0.0.2", "Kitchen Speaker", clients.AliasSource)
+	known.Add("10.0.0.3", "pixel-5", clients.LeaseSource)
+	KnownClientNames = known
+	defer func() { KnownClientNames = clients.NewDirectory() }()
+
+	names, err := ClientNames(db)
+	if err != nil {
+		t.Fatalf("@TestClientNames: database.ClientNames() failed: %s", err)
+	}
+	expected := map[string]string{"10.0.0.1": "laptop.lan", "10.0.0.2": "Kitchen Speaker", "10.0.0.3": "pixel-5"}
+	for address, name := range expected {
+		if result := names.Name(address); result != name {
+			t.Errorf("@TestClientNames: expected %s to be named %q, got %q", address, name, result)
+		}
+	}
+	if known.Len() != 2 {
+		t.Error("@TestClientNames: database.ClientNames() modified KnownClientNames")
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/fatih/color"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
-	"log"
 	"strings"
 )
 
@@ -24,21 +23,38 @@ import (
 		- The date that the client was first seen
 		- The date that the last query from the client was received
 		- The total number of queries received from the client
-		- The client's DNS name
+		- The client's name (from the user's aliases or DHCP leases, falling back to its DNS name)
+
+	If a bounded time window is given, the network table's all time counters can't be used.
+	Instead, the client's queries inside of the window are counted, and the first seen and
+	last query dates become those of the first and last queries inside of the window.
 */
-func ClientSummary(db *sql.DB) {
-	rows, err := db.Query(`
-		SELECT DISTINCT n.hwaddr, n.firstSeen, n.lastQuery, n.numQueries, na.name
-		FROM network n
-		INNER JOIN network_addresses na on n.id = na.network_id
-		WHERE n.numQueries != 0
-		ORDER BY numQueries DESC
-	`)
+func ClientSummary(db *sql.DB, window *TimeWindow) error {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return err
+	}
 
+	query, err := clientSummaryQuery(schema, !window.IsUnbounded())
 	if err != nil {
-		log.Fatalf("Error in database client summary query: %s", err.Error())
+		return err
 	}
 
+	var rows *sql.Rows
+
+	if window.IsUnbounded() {
+		rows, err = db.Query(query)
+	} else {
+		color.Yellow("Window: %s \n\n", window)
+		since, until := window.Bounds()
+		rows, err = db.Query(query, since, until)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error in database client summary query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
 	var address string
 	var firstSeen int
 	var lastQuery int
@@ -56,7 +72,7 @@ func ClientSummary(db *sql.DB) {
 		"First seen\t",
 		"Last query\t",
 		"No. queries\t",
-		"DNS\t")
+		"Name\t")
 
 	// insert blank line separator
 	_, _ = fmt.Fprintln(tabWriter, "\t", "\t", "\t", "\t", "\t", "\t")
@@ -67,6 +83,15 @@ func ClientSummary(db *sql.DB) {
 	for rows.Next() {
 		_ = rows.Scan(&address, &firstSeen, &lastQuery, &numQueries, &name)
 
+		// names that the user has given the client (or that it leased an address with) take precedence
+		knownName, err := knownDeviceName(db, schema, address)
+		if err != nil {
+			return err
+		}
+		if knownName != "" {
+			name = knownName
+		}
+
 		// if the string is denoting an IP, we can chop off the IP identifier from the row entry
 		if strings.Contains(address, "ip-") {
 			address = strings.Split(address, "ip-")[1]
@@ -88,7 +113,70 @@ func ClientSummary(db *sql.DB) {
 		color.Red("0 results in database")
 	}
 
-	if err := tabWriter.Flush(); err != nil {
-		return
+	return tabWriter.Flush()
+}
+
+/*
+	Selects the client summary query to use for a given schema. Host names and addresses
+	moved from the network table to the network_addresses table over time, so the query
+	needs to look for them in the right place.
+
+	Windowed queries take the since and until bounds as arguments.
+*/
+func clientSummaryQuery(schema *Schema, windowed bool) (string, error) {
+	if err := schema.RequireNetwork(); err != nil {
+		return "", err
+	}
+
+	name := "''"
+	if schema.HasNetworkAddresses && schema.HasAddressNames {
+		name = "COALESCE(na.name, '')"
+	} else if schema.HasNetworkNames {
+		name = "COALESCE(n.name, '')"
+	}
+
+	// all time data can come straight from the network table's counters
+	if !windowed {
+		if schema.HasNetworkAddresses {
+			return fmt.Sprintf(`
+				SELECT DISTINCT n.hwaddr, n.firstSeen, n.lastQuery, n.numQueries, %s
+				FROM network n
+				INNER JOIN network_addresses na on n.id = na.network_id
+				WHERE n.numQueries != 0
+				ORDER BY numQueries DESC
+			`, name), nil
+		}
+		return fmt.Sprintf(`
+			SELECT n.hwaddr, n.firstSeen, n.lastQuery, n.numQueries, %s
+			FROM network n
+			WHERE n.numQueries != 0
+			ORDER BY numQueries DESC
+		`, name), nil
+	}
+
+	// windowed data needs each client's queries to be matched up by address
+	if err := schema.RequireQueries(); err != nil {
+		return "", err
 	}
+
+	var addressJoin string
+	if schema.HasNetworkAddresses {
+		addressJoin = `
+			INNER JOIN network_addresses na on n.id = na.network_id
+			INNER JOIN queries q on q.client = na.ip`
+	} else if schema.HasNetworkIPs {
+		addressJoin = `
+			INNER JOIN queries q on q.client = n.ip`
+	} else {
+		return "", schema.unsupported("unable to find client addresses in the network tables")
+	}
+
+	return fmt.Sprintf(`
+		SELECT n.hwaddr, MIN(q.timestamp), MAX(q.timestamp), COUNT(q.id), %[1]s
+		FROM network n
+		%[2]s
+		WHERE q.timestamp BETWEEN ? AND ?
+		GROUP BY n.hwaddr, %[1]s
+		ORDER BY COUNT(q.id) DESC
+	`, name, addressJoin), nil
 }
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+/*
+	The name of the database driver used by the SQL console. This is the regular SQLite driver,
+	but every connection it opens has Pi-CLI's helper functions and views registered on it.
+*/
+const ConsoleDBDriverName = "sqlite3_picli_console"
+
+// A view that is made available to users of the SQL console
+type ConsoleView struct {
+	// The name of the view
+	Name string
+	// What the view contains
+	Description string
+	// The query that the view is created from
+	Query string
+}
+
+/*
+	Helper views created on every console connection, in order of creation. They only live
+	in the connection's temporary schema, so nothing is ever written to the database file itself.
+*/
+var ConsoleHelperViews = []ConsoleView{
+	{
+		Name:        "queries_decoded",
+		Description: "The queries table with human readable times, query types and statuses",
+		Query: `
+		SELECT id, timestamp, human_time(timestamp) AS time,
+		       type, type_name(type) AS type_name,
+		       status, status_name(status) AS status_name, is_blocked(status) AS blocked,
+		       domain, client, forward
+		FROM queries`,
+	},
+	{
+		Name:        "blocked_queries",
+		Description: "Only the queries that were blocked, decoded as above",
+		Query:       `SELECT * FROM queries_decoded WHERE blocked = 1`,
+	},
+}
+
+// Helper SQL functions registered on every console connection
+var consoleHelperFunctions = map[string]interface{}{
+	"status_name": QueryStatusName,
+	"type_name":   QueryTypeName,
+	"is_blocked":  IsBlockedStatus,
+	"human_time":  FormattedDBUnixTimestamp,
+}
+
+func init() {
+	sql.Register(ConsoleDBDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for name, function := range consoleHelperFunctions {
+				if err := conn.RegisterFunc(name, function, true); err != nil {
+					return err
+				}
+			}
+
+			/*
+				Views are created on a best effort basis, a database that doesn't have a queries
+				table can still be explored, it just won't have the helper views available
+			*/
+			for _, view := range ConsoleHelperViews {
+				_, _ = conn.Exec(fmt.Sprintf("CREATE TEMP VIEW IF NOT EXISTS %s AS %s", view.Name, view.Query), nil)
+			}
+
+			// belt and braces on top of the read-only URI, nothing can modify the database
+			_, err := conn.Exec("PRAGMA query_only = 1", nil)
+			return err
+		},
+	})
+}
+
+/*
+	Opens a read-only connection to a database for use by the SQL console. The database is
+	opened as immutable, meaning that SQLite will not take any locks on it or try to recover
+	a journal, so the file is guaranteed to be left exactly as it was found.
+*/
+func ConnectReadOnly(pathToPotentialDB string) *sql.DB {
+	conn := &sql.DB{}
+	if validateDatabase(pathToPotentialDB) {
+		conn, _ = sql.Open(ConsoleDBDriverName, readOnlyDSN(pathToPotentialDB))
+	}
+	return conn
+}
+
+// Builds an SQLite URI that opens a database file in read-only, immutable mode
+func readOnlyDSN(path string) string {
+	escaper := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+	return fmt.Sprintf("file:%s?mode=ro&immutable=1", escaper.Replace(path))
+}
+
+/*
+	How many rows of a console query's text output are lined up together. Console queries can
+	return every row of a multi-gigabyte database, so text and CSV output is written as rows are
+	read rather than collected first. Only JSON output, which is a single array, is held in memory.
+*/
+const consoleTableFlushRows = 1000
+
+/*
+	Runs an arbitrary SQL query and writes its results to stdout in a given format.
+	Unlike the canned database commands, an error is returned rather than exiting, as the
+	console should be able to carry on after a typo.
+*/
+func RunSQL(db *sql.DB, query string, format OutputFormat) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var writeRow func(record []string, object map[string]interface{})
+	var finish func() error
+
+	switch format {
+	case JSONOutput:
+		objects := []map[string]interface{}{}
+		writeRow = func(record []string, object map[string]interface{}) {
+			objects = append(objects, object)
+		}
+		finish = func() error {
+			writeJSON(objects)
+			return nil
+		}
+	case CSVOutput:
+		writer := csv.NewWriter(os.Stdout)
+		_ = writer.Write(columns)
+		writeRow = func(record []string, object map[string]interface{}) {
+			_ = writer.Write(record)
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		table := newRecordsTable(columns, consoleTableFlushRows)
+		writeRow = func(record []string, object map[string]interface{}) {
+			table.write(record)
+		}
+		finish = func() error {
+			table.finish()
+			return nil
+		}
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		record := make([]string, len(columns))
+		var object map[string]interface{}
+		if format == JSONOutput {
+			object = make(map[string]interface{}, len(columns))
+		}
+		for i, value := range values {
+			// SQLite hands back TEXT as []byte in some cases, which would be base64 encoded as JSON
+			if bytes, ok := value.([]byte); ok {
+				value = string(bytes)
+			}
+			record[i] = formattedSQLValue(value)
+			if object != nil {
+				object[columns[i]] = value
+			}
+		}
+		writeRow(record, object)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return finish()
+}
+
+// Formats a single value returned by SQLite for text and CSV output
+func formattedSQLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a database file with a single queries row and moves it to a given name
+func newTestConsoleDatabase(t *testing.T, name string) string {
+	directory := t.TempDir()
+	db, err := sql.Open(DBDriverName, filepath.Join(directory, "pihole-FTL.db"))
+	if err != nil {
+		t.Fatalf("failed to create test database: %s", err)
+	}
+	statements := []string{
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+		"INSERT INTO queries VALUES (1, 1700000000, 1, 1, 'ads.example.com', '192.168.1.10', NULL)",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("failed to set up test database: %s", err)
+		}
+	}
+	_ = db.Close()
+
+	// the name is given afterwards, as the regular driver would read a '?' as the start of its options
+	path := filepath.Join(directory, name)
+	if err := os.Rename(filepath.Join(directory, "pihole-FTL.db"), path); err != nil {
+		t.Fatalf("failed to rename test database: %s", err)
+	}
+	return path
+}
+
+// Tests that database.ConnectReadOnly() connections can read, but never write
+func TestConnectReadOnly(t *testing.T) {
+	conn := ConnectReadOnly(newTestConsoleDatabase(t, "pihole-FTL.db"))
+	defer conn.Close()
+
+	var blocked int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM blocked_queries").Scan(&blocked); err != nil || blocked != 1 {
+		t.Errorf("@TestConnectReadOnly: the blocked_queries helper view gave %d rows (%v)", blocked, err)
+	}
+
+	_, err := conn.Exec("INSERT INTO queries VALUES (2, 1700000001, 1, 2, 'example.com', '192.168.1.10', NULL)")
+	if err == nil || !strings.Contains(err.Error(), "attempt to write a readonly database") {
+		t.Errorf("@TestConnectReadOnly: a write was not rejected: %v", err)
+	}
+	if err := RunSQL(conn, "DELETE FROM queries", CSVOutput); err == nil {
+		t.Error("@TestConnectReadOnly: database.RunSQL() did not return an error for a write")
+	}
+}
+
+// Tests that database.readOnlyDSN() escapes characters that SQLite URIs give a meaning to
+func TestReadOnlyDSN(t *testing.T) {
+	if dsn := readOnlyDSN("/data/pi?hole#1%.db"); dsn != "file:/data/pi%3fhole%231%25.db?mode=ro&immutable=1" {
+		t.Errorf("@TestReadOnlyDSN: unexpected DSN %s", dsn)
+	}
+
+	conn := ConnectReadOnly(newTestConsoleDatabase(t, "pi?hole#1.db"))
+	defer conn.Close()
+
+	var count int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM queries").Scan(&count); err != nil || count != 1 {
+		t.Errorf("@TestReadOnlyDSN: failed to read a database with '?' and '#' in its path (%d rows, %v)", count, err)
+	}
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+)
+
+// The period that the dashboard's summary and top lists cover, matching the Pi-Hole's own "today" figures
+const DashboardPeriod = time.Hour * 24
+
+// A single query as shown in the dashboard's query log
+type DashboardQuery struct {
+	// Unix time of when the query was made
+	Timestamp int64
+	// The name of the query's type (i.e. A, AAAA)
+	Type string
+	// The domain that was queried
+	Domain string
+	// The client that made the query
+	Client string
+	// The upstream that the query was forwarded to, if it was forwarded
+	Forward string
+}
+
+// The data shown on the live dashboard, as it was at a point in time
+type DashboardSnapshot struct {
+	// Unix time that the snapshot was taken at
+	At int64
+	// The number of queries made in the DashboardPeriod leading up to the snapshot
+	Queries int
+	// The number of those queries that were blocked
+	Blocked int
+	// The number of distinct clients that made those queries
+	Clients int
+	// The most queried domains that were permitted, and that were blocked, busiest first
+	TopPermitted []domains.DomainCount
+	TopBlocked   []domains.DomainCount
+	// The latest queries made up to the snapshot, oldest first
+	Latest []DashboardQuery
+}
+
+/*
+	Rebuilds the data shown on the live dashboard as it was at a point in time, from the
+	queries stored in the database. This allows the dashboard to be replayed from history.
+
+	The summary and top lists cover the DashboardPeriod leading up to at, with up to topLimit
+	domains in each top list. Up to latestLimit of the latest queries are included for the
+	query log.
+
+	The database's schema is passed in rather than detected, as a replay rebuilds the dashboard
+	every second and the schema doesn't change while it runs.
+*/
+func Dashboard(db *sql.DB, schema *Schema, at time.Time, topLimit int, latestLimit int) (*DashboardSnapshot, error) {
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	snapshot := &DashboardSnapshot{
+		At:           at.Unix(),
+		TopPermitted: []domains.DomainCount{},
+		TopBlocked:   []domains.DomainCount{},
+		Latest:       []DashboardQuery{},
+	}
+	since := at.Add(-DashboardPeriod).Unix()
+
+	if err := db.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(status IN (%s)), 0), COUNT(DISTINCT client)
+		FROM queries
+		WHERE timestamp > ? AND timestamp <= ?
+	`, blockedStatusSQLList()), since, snapshot.At).Scan(
+		&snapshot.Queries,
+		&snapshot.Blocked,
+		&snapshot.Clients); err != nil {
+		return nil, fmt.Errorf("error in database dashboard summary query (schema v%d): %s", schema.Version, err.Error())
+	}
+
+	for _, list := range []struct {
+		counts   *[]domains.DomainCount
+		operator string
+	}{
+		{&snapshot.TopPermitted, "NOT IN"},
+		{&snapshot.TopBlocked, "IN"},
+	} {
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT domain, COUNT(*)
+			FROM queries
+			WHERE timestamp > ? AND timestamp <= ?
+			AND status %s (%s)
+			GROUP BY domain
+			ORDER BY COUNT(*) DESC, domain
+			LIMIT ?
+		`, list.operator, blockedStatusSQLList()), since, snapshot.At, topLimit)
+		if err != nil {
+			return nil, fmt.Errorf("error in database dashboard top domains query (schema v%d): %s", schema.Version, err.Error())
+		}
+
+		for rows.Next() {
+			var count domains.DomainCount
+			if err := rows.Scan(&count.Domain, &count.Count); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("error reading top domain: %s", err.Error())
+			}
+			*list.counts = append(*list.counts, count)
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading top domains: %s", err.Error())
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT timestamp, type, domain, client, COALESCE(forward, '')
+		FROM queries
+		WHERE timestamp <= ?
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ?
+	`, snapshot.At, latestLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error in database dashboard latest queries query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var query DashboardQuery
+		var queryType int
+		if err := rows.Scan(&query.Timestamp, &queryType, &query.Domain, &query.Client, &query.Forward); err != nil {
+			return nil, fmt.Errorf("error reading latest query: %s", err.Error())
+		}
+		query.Type = QueryTypeName(queryType)
+		snapshot.Latest = append(snapshot.Latest, query)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading latest queries: %s", err.Error())
+	}
+
+	// the latest queries were read newest first
+	for i, j := 0, len(snapshot.Latest)-1; i < j; i, j = i+1, j-1 {
+		snapshot.Latest[i], snapshot.Latest[j] = snapshot.Latest[j], snapshot.Latest[i]
+	}
+
+	return snapshot, nil
+}
+
+// Returns the Unix times of the first and last queries stored in the database
+func QueryTimeRange(db *sql.DB) (int64, int64, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return 0, 0, err
+	}
+
+	var first, last sql.NullInt64
+	if err := db.QueryRow("SELECT MIN(timestamp), MAX(timestamp) FROM queries").Scan(&first, &last); err != nil {
+		return 0, 0, fmt.Errorf("error reading the range of queries (schema v%d): %s", schema.Version, err.Error())
+	}
+	if !first.Valid {
+		return 0, 0, errors.New("the database doesn't hold any queries")
+	}
+	return first.Int64, last.Int64, nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	statements := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	}
+	insert := func(timestamp int64, status int, domain string, client string) {
+		statements = append(statements, fmt.Sprintf(
+			"INSERT INTO queries (timestamp, type, status, domain, client, forward) VALUES (%d, 1, %d, '%s', '%s', '8.8.8.8')",
+			timestamp, status, domain, client))
+	}
+
+	day := int64(DashboardPeriod.Seconds())
+	// a query that falls outside of the period leading up to the snapshot
+	insert(1000, 2, "old.example.com", "10.0.0.9")
+	insert(1000+day+1, 2, "www.example.com", "10.0.0.1")
+	insert(1000+day+2, 2, "www.example.com", "10.0.0.2")
+	insert(1000+day+3, 1, "ads.example.net", "10.0.0.1")
+	insert(1000+day+4, 2, "mail.example.org", "10.0.0.1")
+	// a query made after the snapshot
+	insert(1000+day+10, 1, "later.example.net", "10.0.0.3")
+
+	db := newTestDatabase(t, statements...)
+	schema, err := DetectSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := Dashboard(db, schema, time.Unix(1000+day+5, 0), 1, 3)
+	if err != nil {
+		t.Fatalf("@TestDashboard: database.Dashboard() failed: %s", err)
+	}
+
+	if snapshot.Queries != 4 || snapshot.Blocked != 1 || snapshot.Clients != 2 {
+		t.Errorf("@TestDashboard: unexpected summary %+v", snapshot)
+	}
+	if len(snapshot.TopPermitted) != 1 || snapshot.TopPermitted[0].Domain != "www.example.com" || snapshot.TopPermitted[0].Count != 2 {
+		t.Errorf("@TestDashboard: unexpected top permitted domains %+v", snapshot.TopPermitted)
+	}
+	if len(snapshot.TopBlocked) != 1 || snapshot.TopBlocked[0].Domain != "ads.example.net" {
+		t.Errorf("@TestDashboard: unexpected top blocked domains %+v", snapshot.TopBlocked)
+	}
+
+	latest := snapshot.Latest
+	if len(latest) != 3 || latest[0].Timestamp != 1000+day+2 || latest[2].Domain != "mail.example.org" {
+		t.Fatalf("@TestDashboard: expected the latest 3 queries oldest first, got %+v", latest)
+	}
+	if latest[2].Type != "A" || latest[2].Forward != "8.8.8.8" {
+		t.Errorf("@TestDashboard: unexpected latest query %+v", latest[2])
+	}
+
+	first, last, err := QueryTimeRange(db)
+	if err != nil || first != 1000 || last != 1000+day+10 {
+		t.Errorf("@TestDashboard: unexpected query time range %d - %d (%v)", first, last, err)
+	}
+
+	// an empty database can't be replayed
+	if _, _, err := QueryTimeRange(newTestDatabase(t, statements[:3]...)); err == nil {
+		t.Errorf("@TestDashboard: expected an error for a database without any queries")
+	}
+}
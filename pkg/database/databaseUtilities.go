@@ -39,10 +39,11 @@ func Connect(pathToPotentialDB string) *sql.DB {
 /*
 	Returns a RFC822 formatted version of a given Unix time integer retrieved
 	from a database row. For example, given the Unix time of 1612548060, the function
-	will return the string "05 Feb 21 18:01 GMT"
+	will return the string "05 Feb 21 18:01 GMT". The time is given in the OutputLocation
+	timezone.
 */
 func FormattedDBUnixTimestamp(stamp int) string {
-	return time.Unix(int64(stamp), 0).Format(time.RFC822)
+	return time.Unix(int64(stamp), 0).In(OutputLocation).Format(time.RFC822)
 }
 
 /*
@@ -60,6 +61,26 @@ func NewConfiguredTabWriter(padding int) *tabwriter.Writer {
 		tabwriter.Debug)
 }
 
+/*
+	Does a table (or view) in the database have a given column? Used to gracefully handle
+	columns that are only present in some versions of the FTL database
+*/
+func tableHasColumn(db *sql.DB, table string, column string) bool {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+
+	var name string
+	for rows.Next() {
+		if err := rows.Scan(&name); err == nil && name == column {
+			return true
+		}
+	}
+	return false
+}
+
 // Checks if the filepath to a database is valid and that a connection can be opened
 func validateDatabase(pathToPotentialDB string) bool {
 	if err := doesDatabaseFileExist(pathToPotentialDB); err != nil {
@@ -0,0 +1,415 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Database diff constants
+const (
+	/*
+		The default length of the period of activity compared from each snapshot, ending at the
+		snapshot's most recent query
+	*/
+	DefaultDiffPeriod = time.Hour * 24
+)
+
+// A summary of the period of activity that was compared from a single snapshot
+type SnapshotPeriod struct {
+	// Unix time of the start and end of the compared period
+	Since int64 `json:"since"`
+	Until int64 `json:"until"`
+	// The number of queries, blocked queries, clients and domains inside of the period
+	Queries int `json:"queries"`
+	Blocked int `json:"blocked"`
+	Clients int `json:"clients"`
+	Domains int `json:"domains"`
+}
+
+// A client that appeared or went quiet between two snapshots
+type ClientChange struct {
+	// The client's address
+	Client string `json:"client"`
+	// The client's host name, if it is known
+	Name string `json:"name"`
+	// The number of queries made by the client in each period
+	OldQueries int `json:"old_queries"`
+	NewQueries int `json:"new_queries"`
+	// Unix time of the client's last query in either snapshot
+	LastQuery int64 `json:"last_query"`
+}
+
+// How a single domain's activity changed between two snapshots
+type DomainChange struct {
+	// The domain
+	Domain string `json:"domain"`
+	// The number of times the domain was queried in each period
+	OldQueries int `json:"old_queries"`
+	NewQueries int `json:"new_queries"`
+	// The percentage of the domain's queries that were blocked in each period
+	OldBlockRate float64 `json:"old_block_rate"`
+	NewBlockRate float64 `json:"new_block_rate"`
+}
+
+// The differences between two FTL database snapshots
+type SnapshotDiff struct {
+	// The periods of activity that were compared
+	Old SnapshotPeriod `json:"old"`
+	New SnapshotPeriod `json:"new"`
+	// Clients in the new period that the old snapshot has never seen
+	NewClients []ClientChange `json:"new_clients"`
+	// Clients that were active in the old period, but made no queries in the new period
+	QuietClients []ClientChange `json:"quiet_clients"`
+	// Domains whose query counts changed the most
+	QueryCountChanges []DomainChange `json:"query_count_changes"`
+	// Domains whose block rates changed the most
+	BlockRateChanges []DomainChange `json:"block_rate_changes"`
+	// Domains that weren't blocked in the old period, but were in the new period
+	NewlyBlocked []DomainChange `json:"newly_blocked"`
+	// Domains that were blocked in the old period, but weren't in the new period
+	NewlyUnblocked []DomainChange `json:"newly_unblocked"`
+}
+
+// A client's activity inside of a snapshot's compared period
+type clientActivity struct {
+	name      string
+	queries   int
+	lastQuery int64
+}
+
+// A domain's activity inside of a snapshot's compared period
+type domainActivity struct {
+	queries int
+	blocked int
+}
+
+// The activity read from a single snapshot
+type snapshotActivity struct {
+	period  SnapshotPeriod
+	clients map[string]*clientActivity
+	domains map[string]*domainActivity
+	// every client that the snapshot has ever seen, not just those inside of the period
+	everSeen map[string]bool
+}
+
+/*
+	Compares two FTL database snapshots, i.e. from before and after changing adlists or adding
+	devices to the network.
+
+	FTL keeps months of history, so comparing all time counts would mostly compare the history
+	that both snapshots share. Instead, the period of activity leading up to each snapshot's most
+	recent query is compared. A period of zero compares the snapshots' entire histories.
+
+	The limit controls how many domains are included in each list of domain changes.
+*/
+func DiffSnapshots(oldDB *sql.DB, newDB *sql.DB, period time.Duration, limit int) (*SnapshotDiff, error) {
+	if limit <= 0 {
+		limit = DefaultQueryTableLimit
+	}
+
+	old, err := readSnapshotActivity(oldDB, period)
+	if err != nil {
+		return nil, fmt.Errorf("old snapshot: %s", err.Error())
+	}
+	current, err := readSnapshotActivity(newDB, period)
+	if err != nil {
+		return nil, fmt.Errorf("new snapshot: %s", err.Error())
+	}
+
+	diff := &SnapshotDiff{
+		Old:               old.period,
+		New:               current.period,
+		NewClients:        []ClientChange{},
+		QuietClients:      []ClientChange{},
+		QueryCountChanges: []DomainChange{},
+		NewlyBlocked:      []DomainChange{},
+		NewlyUnblocked:    []DomainChange{},
+	}
+
+	for client, activity := range current.clients {
+		if !old.everSeen[client] {
+			diff.NewClients = append(diff.NewClients, ClientChange{
+				Client:     client,
+				Name:       activity.name,
+				NewQueries: activity.queries,
+				LastQuery:  activity.lastQuery,
+			})
+		}
+	}
+	for client, activity := range old.clients {
+		if _, active := current.clients[client]; !active {
+			diff.QuietClients = append(diff.QuietClients, ClientChange{
+				Client:     client,
+				Name:       activity.name,
+				OldQueries: activity.queries,
+				LastQuery:  activity.lastQuery,
+			})
+		}
+	}
+	sortClientChanges(diff.NewClients)
+	sortClientChanges(diff.QuietClients)
+
+	var changes []DomainChange
+	for domain := range old.domains {
+		changes = append(changes, newDomainChange(domain, old.domains[domain], current.domains[domain]))
+	}
+	for domain := range current.domains {
+		if _, seen := old.domains[domain]; !seen {
+			changes = append(changes, newDomainChange(domain, nil, current.domains[domain]))
+		}
+	}
+
+	// sort by domain first, so that ties are always listed in the same order
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Domain < changes[j].Domain
+	})
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return absInt(changes[i].NewQueries-changes[i].OldQueries) > absInt(changes[j].NewQueries-changes[j].OldQueries)
+	})
+	for _, change := range changes {
+		if len(diff.QueryCountChanges) == limit || change.NewQueries == change.OldQueries {
+			break
+		}
+		diff.QueryCountChanges = append(diff.QueryCountChanges, change)
+	}
+
+	comparable := []DomainChange{}
+	for _, change := range changes {
+		if change.OldQueries >= minimumBlockRateQueries && change.NewQueries >= minimumBlockRateQueries &&
+			change.NewBlockRate != change.OldBlockRate {
+			comparable = append(comparable, change)
+		}
+	}
+	sort.SliceStable(comparable, func(i, j int) bool {
+		return math.Abs(comparable[i].NewBlockRate-comparable[i].OldBlockRate) >
+			math.Abs(comparable[j].NewBlockRate-comparable[j].OldBlockRate)
+	})
+	if len(comparable) > limit {
+		comparable = comparable[:limit]
+	}
+	diff.BlockRateChanges = comparable
+
+	// busiest domains first
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].NewQueries+changes[i].OldQueries > changes[j].NewQueries+changes[j].OldQueries
+	})
+	for _, change := range changes {
+		if change.OldQueries == 0 || change.NewQueries == 0 {
+			continue
+		}
+		if change.OldBlockRate == 0 && change.NewBlockRate > 0 && len(diff.NewlyBlocked) < limit {
+			diff.NewlyBlocked = append(diff.NewlyBlocked, change)
+		}
+		if change.OldBlockRate > 0 && change.NewBlockRate == 0 && len(diff.NewlyUnblocked) < limit {
+			diff.NewlyUnblocked = append(diff.NewlyUnblocked, change)
+		}
+	}
+
+	return diff, nil
+}
+
+// Reads the activity inside of the period leading up to a snapshot's most recent query
+func readSnapshotActivity(db *sql.DB, period time.Duration) (*snapshotActivity, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	activity := &snapshotActivity{
+		clients:  make(map[string]*clientActivity),
+		domains:  make(map[string]*domainActivity),
+		everSeen: make(map[string]bool),
+	}
+
+	var latest sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(timestamp) FROM queries").Scan(&latest); err != nil {
+		return nil, fmt.Errorf("error reading the latest query (schema v%d): %s", schema.Version, err.Error())
+	}
+	activity.period.Until = latest.Int64
+	if period > 0 {
+		activity.period.Since = latest.Int64 - int64(period.Seconds())
+	}
+	since, until := activity.period.Since, activity.period.Until
+
+	names, err := clientNames(db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	clientRows, err := db.Query(`
+		SELECT client, SUM(timestamp BETWEEN ? AND ?), MAX(timestamp)
+		FROM queries
+		GROUP BY client
+	`, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("error in database diff clients query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer clientRows.Close()
+
+	for clientRows.Next() {
+		var client string
+		var stats clientActivity
+		if err := clientRows.Scan(&client, &stats.queries, &stats.lastQuery); err != nil {
+			return nil, fmt.Errorf("error reading client: %s", err.Error())
+		}
+		stats.name = names.Name(client)
+		activity.everSeen[client] = true
+		if stats.queries > 0 {
+			activity.clients[client] = &stats
+			activity.period.Clients++
+		}
+	}
+
+	domainRows, err := db.Query(fmt.Sprintf(`
+		SELECT domain, COUNT(*), SUM(status IN (%s))
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		GROUP BY domain
+	`, blockedStatusSQLList()), since, until)
+	if err != nil {
+		return nil, fmt.Errorf("error in database diff domains query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer domainRows.Close()
+
+	for domainRows.Next() {
+		var domain string
+		var stats domainActivity
+		if err := domainRows.Scan(&domain, &stats.queries, &stats.blocked); err != nil {
+			return nil, fmt.Errorf("error reading domain: %s", err.Error())
+		}
+		activity.domains[domain] = &stats
+		activity.period.Domains++
+		activity.period.Queries += stats.queries
+		activity.period.Blocked += stats.blocked
+	}
+
+	return activity, nil
+}
+
+// Creates the change in a domain's activity between two periods. Either period's activity can be nil
+func newDomainChange(domain string, old *domainActivity, current *domainActivity) DomainChange {
+	change := DomainChange{Domain: domain}
+	if old != nil {
+		change.OldQueries = old.queries
+		change.OldBlockRate = blockRate(old)
+	}
+	if current != nil {
+		change.NewQueries = current.queries
+		change.NewBlockRate = blockRate(current)
+	}
+	return change
+}
+
+// The percentage of a domain's queries that were blocked
+func blockRate(activity *domainActivity) float64 {
+	if activity.queries == 0 {
+		return 0
+	}
+	return float64(activity.blocked) / float64(activity.queries) * 100
+}
+
+// Sorts client changes busiest first
+func sortClientChanges(changes []ClientChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].NewQueries+changes[i].OldQueries != changes[j].NewQueries+changes[j].OldQueries {
+			return changes[i].NewQueries+changes[i].OldQueries > changes[j].NewQueries+changes[j].OldQueries
+		}
+		return changes[i].Client < changes[j].Client
+	})
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// Writes the diff to stdout in a given format. CSV isn't supported, as the diff isn't a single table
+func (diff *SnapshotDiff) Print(format OutputFormat) {
+	if format == JSONOutput {
+		writeJSON(diff)
+		return
+	}
+
+	localisedNumberWriter := message.NewPrinter(language.English)
+
+	for _, snapshot := range []struct {
+		label  string
+		period SnapshotPeriod
+	}{{"Old", diff.Old}, {"New", diff.New}} {
+		color.Yellow(
+			"%s: %s -> %s (%s queries, %s blocked, %d clients, %s domains)",
+			snapshot.label,
+			FormattedDBUnixTimestamp(int(snapshot.period.Since)),
+			FormattedDBUnixTimestamp(int(snapshot.period.Until)),
+			localisedNumberWriter.Sprintf("%d", snapshot.period.Queries),
+			localisedNumberWriter.Sprintf("%d", snapshot.period.Blocked),
+			snapshot.period.Clients,
+			localisedNumberWriter.Sprintf("%d", snapshot.period.Domains))
+	}
+
+	printClientChanges("New clients", diff.NewClients, func(change ClientChange) int { return change.NewQueries })
+	printClientChanges("Clients that went quiet", diff.QuietClients, func(change ClientChange) int { return change.OldQueries })
+
+	printDomainChanges("Biggest changes in query count", diff.QueryCountChanges)
+	printDomainChanges("Biggest changes in block rate", diff.BlockRateChanges)
+	printDomainChanges("Newly blocked domains", diff.NewlyBlocked)
+	printDomainChanges("Newly unblocked domains", diff.NewlyUnblocked)
+}
+
+// Renders a list of client changes under a heading
+func printClientChanges(heading string, changes []ClientChange, queries func(ClientChange) int) {
+	fmt.Println()
+	color.Cyan(heading)
+	if len(changes) == 0 {
+		fmt.Println("None")
+		return
+	}
+
+	var records [][]string
+	for _, change := range changes {
+		records = append(records, []string{
+			change.Client,
+			change.Name,
+			strconv.Itoa(queries(change)),
+			FormattedDBUnixTimestamp(int(change.LastQuery)),
+		})
+	}
+	printRecordsTable([]string{"Client", "DNS", "Queries", "Last query"}, records)
+}
+
+// Renders a list of domain changes under a heading
+func printDomainChanges(heading string, changes []DomainChange) {
+	fmt.Println()
+	color.Cyan(heading)
+	if len(changes) == 0 {
+		fmt.Println("None")
+		return
+	}
+
+	var records [][]string
+	for _, change := range changes {
+		records = append(records, []string{
+			change.Domain,
+			strconv.Itoa(change.OldQueries),
+			strconv.Itoa(change.NewQueries),
+			fmt.Sprintf("%+d", change.NewQueries-change.OldQueries),
+			fmt.Sprintf("%.1f%%", change.OldBlockRate),
+			fmt.Sprintf("%.1f%%", change.NewBlockRate),
+		})
+	}
+	printRecordsTable([]string{"Domain", "Old queries", "New queries", "Change", "Old blocked", "New blocked"}, records)
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/clients"
+)
+
+// Tests for database.DiffSnapshots()
+func TestDiffSnapshots(t *testing.T) {
+	schema := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	}
+
+	// a query for a domain from a client, repeated a number of times, at times ending at until
+	insert := func(count int, status int, domain string, client string, until int) []string {
+		var statements []string
+		for i := 0; i < count; i++ {
+			statements = append(statements, fmt.Sprintf(
+				"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (%d, 1, %d, '%s', '%s')",
+				until-i, status, domain, client))
+		}
+		return statements
+	}
+
+	oldStatements := append([]string{}, schema...)
+	// the old client only queried outside of the compared period, so isn't new in the new snapshot
+	oldStatements = append(oldStatements, insert(1, 2, "example.com", "10.0.0.3", 1000)...)
+	oldStatements = append(oldStatements, insert(10, 2, "example.com", "10.0.0.1", 100000)...)
+	oldStatements = append(oldStatements, insert(6, 2, "tracker.com", "10.0.0.1", 100000)...)
+	oldStatements = append(oldStatements, insert(6, 1, "ads.com", "10.0.0.2", 100000)...)
+
+	newStatements := append([]string{}, schema...)
+	newStatements = append(newStatements, insert(30, 2, "example.com", "10.0.0.1", 200000)...)
+	newStatements = append(newStatements, insert(6, 1, "tracker.com", "10.0.0.1", 200000)...)
+	newStatements = append(newStatements, insert(6, 2, "ads.com", "10.0.0.1", 200000)...)
+	newStatements = append(newStatements, insert(2, 2, "example.com", "10.0.0.3", 200000)...)
+	newStatements = append(newStatements, insert(1, 2, "example.com", "10.0.0.4", 200000)...)
+
+	diff, err := DiffSnapshots(newTestDatabase(t, oldStatements...), newTestDatabase(t, newStatements...), DefaultDiffPeriod, 10)
+	if err != nil {
+		t.Fatalf("@TestDiffSnapshots: database.DiffSnapshots() failed: %s", err)
+	}
+
+	if diff.Old.Queries != 22 || diff.New.Queries != 45 {
+		t.Errorf("@TestDiffSnapshots: expected 22 old and 45 new queries, got %d and %d", diff.Old.Queries, diff.New.Queries)
+	}
+
+	if len(diff.NewClients) != 1 || diff.NewClients[0].Client != "10.0.0.4" {
+		t.Errorf("@TestDiffSnapshots: expected only 10.0.0.4 to be a new client, got %+v", diff.NewClients)
+	}
+	if len(diff.QuietClients) != 1 || diff.QuietClients[0].Client != "10.0.0.2" {
+		t.Errorf("@TestDiffSnapshots: expected only 10.0.0.2 to have gone quiet, got %+v", diff.QuietClients)
+	}
+
+	if len(diff.QueryCountChanges) != 1 || diff.QueryCountChanges[0].Domain != "example.com" ||
+		diff.QueryCountChanges[0].OldQueries != 10 || diff.QueryCountChanges[0].NewQueries != 33 {
+		t.Errorf("@TestDiffSnapshots: unexpected query count changes %+v", diff.QueryCountChanges)
+	}
+
+	if len(diff.NewlyBlocked) != 1 || diff.NewlyBlocked[0].Domain != "tracker.com" {
+		t.Errorf("@TestDiffSnapshots: expected only tracker.com to be newly blocked, got %+v", diff.NewlyBlocked)
+	}
+	if len(diff.NewlyUnblocked) != 1 || diff.NewlyUnblocked[0].Domain != "ads.com" {
+		t.Errorf("@TestDiffSnapshots: expected only ads.com to be newly unblocked, got %+v", diff.NewlyUnblocked)
+	}
+	if len(diff.BlockRateChanges) != 2 {
+		t.Errorf("@TestDiffSnapshots: expected 2 block rate changes, got %+v", diff.BlockRateChanges)
+	}
+}
+
+// Tests that database.DiffSnapshots() labels new and quiet clients with the names from the user's alias file
+func TestDiffSnapshotsAliases(t *testing.T) {
+	schema := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	}
+	oldDB := newTestDatabase(t, append(schema,
+		"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (100000, 1, 2, 'example.com', '10.0.0.2')")...)
+	newDB := newTestDatabase(t, append(schema,
+		"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (200000, 1, 2, 'example.com', '10.0.0.4')")...)
+
+	aliases := clients.NewDirectory()
+	if err := aliases.ReadAliases(strings.NewReader("10.0.0.2 = Old Laptop\n10.0.0.4 = Kitchen Speaker\n")); err != nil {
+		t.Fatal(err)
+	}
+	KnownClientNames = aliases
+	defer func() { KnownClientNames = clients.NewDirectory() }()
+
+	diff, err := DiffSnapshots(oldDB, newDB, DefaultDiffPeriod, 10)
+	if err != nil {
+		t.Fatalf("@TestDiffSnapshotsAliases: database.DiffSnapshots() failed: %s", err)
+	}
+	if len(diff.NewClients) != 1 || diff.NewClients[0].Name != "Kitchen Speaker" {
+		t.Errorf("@TestDiffSnapshotsAliases: new clients weren't labelled with their alias: %+v", diff.NewClients)
+	}
+	if len(diff.QuietClients) != 1 || diff.QuietClients[0].Name != "Old Laptop" {
+		t.Errorf("@TestDiffSnapshotsAliases: quiet clients weren't labelled with their alias: %+v", diff.QuietClients)
+	}
+}
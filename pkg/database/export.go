@@ -0,0 +1,382 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A file format that query history can be exported in
+type ExportFormat string
+
+// Supported export formats
+const (
+	// Comma separated values, with a header row
+	CSVExport ExportFormat = "csv"
+	// Newline delimited JSON, one object per query
+	NDJSONExport ExportFormat = "ndjson"
+	// Apache Parquet, for analysis tools such as DuckDB and pandas
+	ParquetExport ExportFormat = "parquet"
+)
+
+/*
+	The number of queries read from the database and written out at a time. This bounds the
+	memory used by an export, and is the size of each Parquet row group.
+*/
+const DefaultExportChunkSize = 10000
+
+// A single query from the FTL database, with its codes decoded and its client's name joined in
+type ExportedQuery struct {
+	// The query's ID
+	ID int64 `json:"id"`
+	// Unix time of when the query was made
+	Timestamp int64 `json:"timestamp"`
+	// When the query was made, in the OutputLocation timezone
+	Time string `json:"time"`
+	// The query type code, and its name (i.e. 1 = A)
+	Type     int    `json:"type"`
+	TypeName string `json:"type_name"`
+	// The query status code, and its name (i.e. 2 = Forwarded)
+	Status     int    `json:"status"`
+	StatusName string `json:"status_name"`
+	// Was the query blocked?
+	Blocked bool `json:"blocked"`
+	// The domain that was queried
+	Domain string `json:"domain"`
+	// The address of the client that made the query
+	Client string `json:"client"`
+	// The client's host name, if it is known
+	ClientName string `json:"client_name"`
+	// The upstream that the query was forwarded to, if it was forwarded
+	Forward *string `json:"forward"`
+	// How long the reply took in seconds, if it was recorded
+	ReplyTime *float64 `json:"reply_time"`
+}
+
+// Writes chunks of exported queries out in a particular format
+type queryExporter interface {
+	writeChunk(queries []ExportedQuery) error
+	close() error
+}
+
+/*
+	Parses an export format given by the user. If no format is given, it's inferred from the
+	extension of the file being exported to, defaulting to CSV.
+*/
+func ParseExportFormat(format string, path string) (ExportFormat, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".parquet":
+			return ParquetExport, nil
+		case ".ndjson", ".jsonl":
+			return NDJSONExport, nil
+		default:
+			return CSVExport, nil
+		}
+	}
+
+	switch ExportFormat(format) {
+	case CSVExport, NDJSONExport, ParquetExport:
+		return ExportFormat(format), nil
+	case "jsonl":
+		return NDJSONExport, nil
+	}
+	return "", fmt.Errorf("unknown export format '%s' (expected csv, ndjson or parquet)", format)
+}
+
+/*
+	Streams every query inside of a window of time into a writer in a given format, returning
+	the number of queries that were exported.
+
+	Queries are read and written in chunks, so memory usage stays flat no matter how large the
+	database is. After each chunk, progress is called with the number of queries exported so
+	far and the total number of queries being exported.
+*/
+func ExportQueries(
+	db *sql.DB,
+	writer io.Writer,
+	format ExportFormat,
+	window *TimeWindow,
+	chunkSize int,
+	progress func(exported int64, total int64)) (int64, error) {
+
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return 0, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return 0, err
+	}
+
+	if chunkSize <= 0 {
+		chunkSize = DefaultExportChunkSize
+	}
+
+	since, until := window.Bounds()
+
+	var total int64
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM queries WHERE timestamp BETWEEN ? AND ?",
+		since,
+		until).Scan(&total); err != nil {
+		return 0, fmt.Errorf("error counting queries to export (schema v%d): %s", schema.Version, err.Error())
+	}
+
+	exporter, err := newQueryExporter(writer, format)
+	if err != nil {
+		return 0, err
+	}
+
+	names, err := clientNames(db, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.Query(exportQuery(schema), since, until)
+	if err != nil {
+		return 0, fmt.Errorf("error in database export query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	var exported int64
+	chunk := make([]ExportedQuery, 0, chunkSize)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := exporter.writeChunk(chunk); err != nil {
+			return fmt.Errorf("failed to write exported queries: %s", err.Error())
+		}
+		exported += int64(len(chunk))
+		chunk = chunk[:0]
+		if progress != nil {
+			progress(exported, total)
+		}
+		return nil
+	}
+
+	for rows.Next() {
+		var query ExportedQuery
+		var forward sql.NullString
+		var replyTime sql.NullFloat64
+
+		if err := rows.Scan(
+			&query.ID,
+			&query.Timestamp,
+			&query.Type,
+			&query.Status,
+			&query.Domain,
+			&query.Client,
+			&forward,
+			&replyTime); err != nil {
+			return exported, fmt.Errorf("error reading query to export: %s", err.Error())
+		}
+
+		query.Time = time.Unix(query.Timestamp, 0).In(OutputLocation).Format(time.RFC3339)
+		query.TypeName = QueryTypeName(query.Type)
+		query.StatusName = QueryStatusName(query.Status)
+		query.Blocked = IsBlockedStatus(query.Status)
+		query.ClientName = names.Name(query.Client)
+		if forward.Valid && forward.String != "" {
+			query.Forward = &forward.String
+		}
+		if replyTime.Valid {
+			query.ReplyTime = &replyTime.Float64
+		}
+
+		chunk = append(chunk, query)
+		if len(chunk) == chunkSize {
+			if err := flush(); err != nil {
+				return exported, err
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return exported, fmt.Errorf("error reading queries to export: %s", err.Error())
+	}
+	if err := flush(); err != nil {
+		return exported, err
+	}
+
+	if err := exporter.close(); err != nil {
+		return exported, fmt.Errorf("failed to finish export: %s", err.Error())
+	}
+
+	// make sure that progress is reported at least once, even for an empty export
+	if exported == 0 && progress != nil {
+		progress(0, total)
+	}
+
+	return exported, nil
+}
+
+// Builds the query used to export the queries table
+func exportQuery(schema *Schema) string {
+	replyTime := "NULL"
+	if schema.HasReplyTimes {
+		replyTime = "reply_time"
+	}
+
+	return fmt.Sprintf(`
+		SELECT id, timestamp, type, status, domain, client, forward, %s
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY id
+	`, replyTime)
+}
+
+// Creates an exporter that writes queries to a writer in a given format
+func newQueryExporter(writer io.Writer, format ExportFormat) (queryExporter, error) {
+	switch format {
+	case CSVExport:
+		exporter := &csvQueryExporter{writer: csv.NewWriter(writer)}
+		if err := exporter.writer.Write([]string{
+			"id", "timestamp", "time", "type", "type_name", "status", "status_name", "blocked",
+			"domain", "client", "client_name", "forward", "reply_time",
+		}); err != nil {
+			return nil, err
+		}
+		return exporter, nil
+	case NDJSONExport:
+		buffered := bufio.NewWriter(writer)
+		return &ndjsonQueryExporter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case ParquetExport:
+		parquet, err := newParquetWriter(writer, []parquetColumn{
+			{Name: "id", Type: parquetInt64},
+			{Name: "time", Type: parquetTimestamp},
+			{Name: "type", Type: parquetInt64},
+			{Name: "type_name", Type: parquetString},
+			{Name: "status", Type: parquetInt64},
+			{Name: "status_name", Type: parquetString},
+			{Name: "blocked", Type: parquetBoolean},
+			{Name: "domain", Type: parquetString},
+			{Name: "client", Type: parquetString},
+			{Name: "client_name", Type: parquetString, Optional: true},
+			{Name: "forward", Type: parquetString, Optional: true},
+			{Name: "reply_time", Type: parquetDouble, Optional: true},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &parquetQueryExporter{writer: parquet}, nil
+	}
+	return nil, fmt.Errorf("unknown export format '%s'", format)
+}
+
+// Exports queries as CSV
+type csvQueryExporter struct {
+	writer *csv.Writer
+}
+
+func (exporter *csvQueryExporter) writeChunk(queries []ExportedQuery) error {
+	for _, query := range queries {
+		forward, replyTime := "", ""
+		if query.Forward != nil {
+			forward = *query.Forward
+		}
+		if query.ReplyTime != nil {
+			replyTime = strconv.FormatFloat(*query.ReplyTime, 'f', -1, 64)
+		}
+		if err := exporter.writer.Write([]string{
+			strconv.FormatInt(query.ID, 10),
+			strconv.FormatInt(query.Timestamp, 10),
+			query.Time,
+			strconv.Itoa(query.Type),
+			query.TypeName,
+			strconv.Itoa(query.Status),
+			query.StatusName,
+			strconv.FormatBool(query.Blocked),
+			query.Domain,
+			query.Client,
+			query.ClientName,
+			forward,
+			replyTime,
+		}); err != nil {
+			return err
+		}
+	}
+	exporter.writer.Flush()
+	return exporter.writer.Error()
+}
+
+func (exporter *csvQueryExporter) close() error {
+	exporter.writer.Flush()
+	return exporter.writer.Error()
+}
+
+// Exports queries as newline delimited JSON, one object per line
+type ndjsonQueryExporter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (exporter *ndjsonQueryExporter) writeChunk(queries []ExportedQuery) error {
+	for _, query := range queries {
+		if err := exporter.encoder.Encode(query); err != nil {
+			return err
+		}
+	}
+	return exporter.buffered.Flush()
+}
+
+func (exporter *ndjsonQueryExporter) close() error {
+	return exporter.buffered.Flush()
+}
+
+// Exports queries as Parquet, with each chunk written as a row group
+type parquetQueryExporter struct {
+	writer *parquetWriter
+}
+
+func (exporter *parquetQueryExporter) writeChunk(queries []ExportedQuery) error {
+	columns := make([][]interface{}, len(exporter.writer.columns))
+	for i := range columns {
+		columns[i] = make([]interface{}, len(queries))
+	}
+
+	for r, query := range queries {
+		var clientName, forward, replyTime interface{}
+		if query.ClientName != "" {
+			clientName = query.ClientName
+		}
+		if query.Forward != nil {
+			forward = *query.Forward
+		}
+		if query.ReplyTime != nil {
+			replyTime = *query.ReplyTime
+		}
+
+		for c, value := range []interface{}{
+			query.ID,
+			query.Timestamp * 1000,
+			int64(query.Type),
+			query.TypeName,
+			int64(query.Status),
+			query.StatusName,
+			query.Blocked,
+			query.Domain,
+			query.Client,
+			clientName,
+			forward,
+			replyTime,
+		} {
+			columns[c][r] = value
+		}
+	}
+
+	return exporter.writer.WriteRowGroup(columns)
+}
+
+func (exporter *parquetQueryExporter) close() error {
+	return exporter.writer.Close()
+}
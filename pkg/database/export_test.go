@@ -0,0 +1,141 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests for database.ParseExportFormat()
+func TestParseExportFormat(t *testing.T) {
+	expected := map[[2]string]ExportFormat{
+		{"", "queries.csv"}:        CSVExport,
+		{"", "queries.parquet"}:    ParquetExport,
+		{"", "queries.ndjson"}:     NDJSONExport,
+		{"", "queries.JSONL"}:      NDJSONExport,
+		{"", ""}:                   CSVExport,
+		{"parquet", "queries.csv"}: ParquetExport,
+		{" NDJSON ", ""}:           NDJSONExport,
+		{"jsonl", ""}:              NDJSONExport,
+	}
+	for input, format := range expected {
+		result, err := ParseExportFormat(input[0], input[1])
+		if err != nil || result != format {
+			t.Errorf("@TestParseExportFormat: database.ParseExportFormat(%q, %q) returned %q (%v), expected %q",
+				input[0], input[1], result, err, format)
+		}
+	}
+
+	if _, err := ParseExportFormat("xml", ""); err == nil {
+		t.Error("@TestParseExportFormat: database.ParseExportFormat() did not reject an unknown format")
+	}
+}
+
+// Tests for database.ExportQueries()
+func TestExportQueries(t *testing.T) {
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT, additional_info TEXT, reply_time REAL)",
+		"CREATE TABLE network (id INTEGER PRIMARY KEY, hwaddr TEXT)",
+		"CREATE TABLE network_addresses (network_id INTEGER, ip TEXT, name TEXT)",
+		"INSERT INTO network_addresses VALUES (1, '10.0.0.1', 'laptop.lan')",
+		"INSERT INTO queries (timestamp, type, status, domain, client, forward, reply_time) VALUES "+
+			"(100, 1, 2, 'example.com', '10.0.0.1', '1.1.1.1#53', 0.25), "+
+			"(200, 2, 1, 'ads.example.com', '10.0.0.2', NULL, NULL), "+
+			"(300, 1, 3, 'example.com', '10.0.0.1', NULL, NULL)",
+	)
+
+	var progress [][2]int64
+	output := &bytes.Buffer{}
+	exported, err := ExportQueries(db, output, CSVExport, nil, 2, func(exported int64, total int64) {
+		progress = append(progress, [2]int64{exported, total})
+	})
+	if err != nil || exported != 3 {
+		t.Fatalf("@TestExportQueries: database.ExportQueries() exported %d queries (%v), expected 3", exported, err)
+	}
+
+	// two chunks of at most two queries each
+	if len(progress) != 2 || progress[0] != [2]int64{2, 3} || progress[1] != [2]int64{3, 3} {
+		t.Errorf("@TestExportQueries: unexpected progress reports %v", progress)
+	}
+
+	records, err := csv.NewReader(output).ReadAll()
+	if err != nil || len(records) != 4 {
+		t.Fatalf("@TestExportQueries: expected a header and 3 CSV records, got %d (%v)", len(records), err)
+	}
+	first := strings.Join(records[1], ",")
+	if !strings.Contains(first, "A,2,Forwarded,false,example.com,10.0.0.1,laptop.lan,1.1.1.1#53,0.25") {
+		t.Errorf("@TestExportQueries: unexpected first CSV record %q", first)
+	}
+	second := strings.Join(records[2], ",")
+	if !strings.Contains(second, "AAAA,1,Blocked (gravity),true,ads.example.com,10.0.0.2,,,") {
+		t.Errorf("@TestExportQueries: unexpected second CSV record %q", second)
+	}
+
+	output.Reset()
+	if _, err := ExportQueries(db, output, NDJSONExport, &TimeWindow{}, 0, nil); err != nil {
+		t.Fatalf("@TestExportQueries: database.ExportQueries() failed for NDJSON: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("@TestExportQueries: expected 3 lines of NDJSON, got %d", len(lines))
+	}
+	var query ExportedQuery
+	if err := json.Unmarshal([]byte(lines[1]), &query); err != nil {
+		t.Fatalf("@TestExportQueries: failed to decode NDJSON: %s", err)
+	}
+	if query.Domain != "ads.example.com" || !query.Blocked || query.Forward != nil || query.ReplyTime != nil {
+		t.Errorf("@TestExportQueries: unexpected NDJSON query %+v", query)
+	}
+
+	output.Reset()
+	if _, err := ExportQueries(db, output, ParquetExport, nil, 2, nil); err != nil {
+		t.Fatalf("@TestExportQueries: database.ExportQueries() failed for Parquet: %s", err)
+	}
+	parquet, err := readTestParquetFile(output.Bytes())
+	if err != nil {
+		t.Fatalf("@TestExportQueries: failed to decode the Parquet export: %s", err)
+	}
+	if rows, createdBy := parquet.metadata[3], string(parquet.metadata[6].([]byte)); rows != int64(3) || createdBy != "Pi-CLI" {
+		t.Errorf("@TestExportQueries: Parquet footer has %v rows created by %q, expected 3 created by Pi-CLI", rows, createdBy)
+	}
+	if rowGroups := parquet.metadata[4].([]interface{}); len(rowGroups) != 2 {
+		t.Errorf("@TestExportQueries: expected 2 Parquet row groups, got %d", len(rowGroups))
+	}
+
+	// optional columns are marked with a '?'
+	expectedSchema := []string{
+		"id", "time", "type", "type_name", "status", "status_name", "blocked",
+		"domain", "client", "client_name?", "forward?", "reply_time?",
+	}
+	if schema := parquet.schema(); !reflect.DeepEqual(schema, expectedSchema) {
+		t.Errorf("@TestExportQueries: got Parquet schema %v, expected %v", schema, expectedSchema)
+	}
+
+	expectedColumns := map[string][]interface{}{
+		"time":        {int64(100000), int64(200000), int64(300000)},
+		"blocked":     {false, true, false},
+		"domain":      {"example.com", "ads.example.com", "example.com"},
+		"client_name": {"laptop.lan", nil, "laptop.lan"},
+		"forward":     {"1.1.1.1#53", nil, nil},
+		"reply_time":  {0.25, nil, nil},
+	}
+	for name, expected := range expectedColumns {
+		if values := parquet.columns[name]; !reflect.DeepEqual(values, expected) {
+			t.Errorf("@TestExportQueries: Parquet column '%s' holds %v, expected %v", name, values, expected)
+		}
+	}
+}
+
+// Tests for database.encodeParquetLevels()
+func TestEncodeParquetLevels(t *testing.T) {
+	// runs of 2 ones, 1 zero and 3 ones, each encoded as (length << 1) followed by the value
+	encoded := encodeParquetLevels([]bool{true, true, false, true, true, true})
+	if expected := []byte{4, 1, 2, 0, 6, 1}; !bytes.Equal(encoded, expected) {
+		t.Errorf("@TestEncodeParquetLevels: got %v, expected %v", encoded, expected)
+	}
+}
@@ -0,0 +1,295 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Gravity database constants
+const (
+	/*
+		The default location and name used by gravity commands to look for the Pi-Hole's
+		gravity database file
+	*/
+	DefaultGravityFileLocation = "./gravity.db"
+	// Where Pi-Hole keeps its gravity database
+	DefaultRemoteGravityLocation = "/etc/pihole/gravity.db"
+	// Separator used when concatenating values in SQL, chosen as it won't appear in names or addresses
+	gravityListSeparator = "\x1f"
+)
+
+// Returned when a database doesn't look like a Pi-Hole gravity database
+var ErrNotGravityDatabase = errors.New("not a Pi-Hole gravity database (no 'adlist' or 'gravity' table found)")
+
+/*
+	Mapping between adlist status codes and their meanings. Statuses are set each time that
+	gravity is updated (pihole -g)
+*/
+var AdlistStatusNames = map[int]string{
+	0: "Unknown",
+	1: "Downloaded",
+	2: "Unchanged",
+	3: "Unavailable (cached)",
+	4: "Unavailable (no cache)",
+}
+
+// Mapping between domainlist type codes and their meanings
+var DomainlistTypeNames = map[int]string{
+	0: "Exact allow",
+	1: "Exact deny",
+	2: "Regex allow",
+	3: "Regex deny",
+}
+
+// A single adlist from the gravity database
+type Adlist struct {
+	// The adlist's ID
+	ID int `json:"id"`
+	// The URL that the adlist is downloaded from
+	Address string `json:"address"`
+	// Is the adlist enabled?
+	Enabled bool `json:"enabled"`
+	// The result of the last gravity update
+	Status string `json:"status"`
+	// The number of domains that the adlist contributed to gravity
+	Domains int `json:"domains"`
+	// The number of invalid domains that were skipped during the last gravity update
+	InvalidDomains int `json:"invalid_domains"`
+	// Unix time of when the adlist was last updated
+	LastUpdated int `json:"last_updated"`
+	// The groups that the adlist is assigned to
+	Groups []string `json:"groups"`
+	// The user's comment on the adlist
+	Comment string `json:"comment"`
+}
+
+// A single group from the gravity database, and what is assigned to it
+type Group struct {
+	// The group's ID
+	ID int `json:"id"`
+	// The group's name
+	Name string `json:"name"`
+	// Is the group enabled?
+	Enabled bool `json:"enabled"`
+	// The group's description
+	Description string `json:"description"`
+	// The number of adlists assigned to the group
+	Adlists int `json:"adlists"`
+	// The number of domainlist entries assigned to the group
+	DomainlistEntries int `json:"domainlist_entries"`
+	// The addresses of the clients assigned to the group
+	Clients []string `json:"clients"`
+}
+
+/*
+	Extracts all of the adlists in the gravity database, along with how many domains they
+	contribute, the result of their last update and the groups that they're assigned to.
+
+	Older gravity databases don't record the size or status of each adlist, in which case
+	the size is counted from the gravity table instead.
+*/
+func Adlists(db *sql.DB) ([]Adlist, error) {
+	if err := requireGravityDatabase(db); err != nil {
+		return nil, err
+	}
+
+	status, number, invalid := "0", "(SELECT COUNT(*) FROM gravity WHERE adlist_id = a.id)", "0"
+	if tableHasColumn(db, "adlist", "status") {
+		status = "a.status"
+	}
+	if tableHasColumn(db, "adlist", "number") {
+		number = "a.number"
+	}
+	if tableHasColumn(db, "adlist", "invalid_domains") {
+		invalid = "a.invalid_domains"
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT a.id, a.address, a.enabled, %s, %s, %s,
+		       COALESCE(a.date_updated, 0), COALESCE(a.comment, ''),
+		       COALESCE((
+		           SELECT group_concat(g.name, '%s')
+		           FROM adlist_by_group ag
+		           INNER JOIN "group" g ON g.id = ag.group_id
+		           WHERE ag.adlist_id = a.id
+		       ), '')
+		FROM adlist a
+		ORDER BY a.id
+	`, status, number, invalid, gravityListSeparator))
+
+	if err != nil {
+		return nil, fmt.Errorf("error in gravity adlists query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var adlists []Adlist
+	for rows.Next() {
+		var adlist Adlist
+		var statusCode int
+		var groups string
+
+		if err := rows.Scan(
+			&adlist.ID,
+			&adlist.Address,
+			&adlist.Enabled,
+			&statusCode,
+			&adlist.Domains,
+			&adlist.InvalidDomains,
+			&adlist.LastUpdated,
+			&adlist.Comment,
+			&groups); err != nil {
+			return nil, fmt.Errorf("error reading adlist: %s", err.Error())
+		}
+
+		adlist.Status = AdlistStatusNames[statusCode]
+		adlist.Groups = splitGravityList(groups)
+		adlists = append(adlists, adlist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading adlists: %s", err.Error())
+	}
+
+	return adlists, nil
+}
+
+// Writes a list of adlists to stdout in a given format
+func PrintAdlists(adlists []Adlist, format OutputFormat) {
+	var records [][]string
+	for _, adlist := range adlists {
+		lastUpdated := "Never"
+		if adlist.LastUpdated > 0 {
+			lastUpdated = FormattedDBUnixTimestamp(adlist.LastUpdated)
+		}
+		records = append(records, []string{
+			strconv.Itoa(adlist.ID),
+			adlist.Address,
+			enabledString(adlist.Enabled),
+			adlist.Status,
+			strconv.Itoa(adlist.Domains),
+			strconv.Itoa(adlist.InvalidDomains),
+			lastUpdated,
+			strings.Join(adlist.Groups, ", "),
+		})
+	}
+
+	if adlists == nil {
+		adlists = []Adlist{}
+	}
+
+	writeRecords(
+		format,
+		[]string{"ID", "Address", "Enabled", "Status", "Domains", "Invalid", "Last updated", "Groups"},
+		records,
+		adlists)
+}
+
+/*
+	Extracts all of the groups in the gravity database, along with the number of adlists and
+	domainlist entries, and the clients, that are assigned to each of them.
+*/
+func Groups(db *sql.DB) ([]Group, error) {
+	if err := requireGravityDatabase(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT g.id, g.name, g.enabled, COALESCE(g.description, ''),
+		       (SELECT COUNT(*) FROM adlist_by_group WHERE group_id = g.id),
+		       (SELECT COUNT(*) FROM domainlist_by_group WHERE group_id = g.id),
+		       COALESCE((
+		           SELECT group_concat(c.ip, '%s')
+		           FROM client_by_group cg
+		           INNER JOIN client c ON c.id = cg.client_id
+		           WHERE cg.group_id = g.id
+		       ), '')
+		FROM "group" g
+		ORDER BY g.id
+	`, gravityListSeparator))
+
+	if err != nil {
+		return nil, fmt.Errorf("error in gravity groups query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		var clients string
+
+		if err := rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.Enabled,
+			&group.Description,
+			&group.Adlists,
+			&group.DomainlistEntries,
+			&clients); err != nil {
+			return nil, fmt.Errorf("error reading group: %s", err.Error())
+		}
+
+		group.Clients = splitGravityList(clients)
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading groups: %s", err.Error())
+	}
+
+	return groups, nil
+}
+
+// Writes a list of groups to stdout in a given format
+func PrintGroups(groups []Group, format OutputFormat) {
+	var records [][]string
+	for _, group := range groups {
+		clients := strings.Join(group.Clients, ", ")
+		// the default group implicitly contains every client that hasn't been assigned elsewhere
+		if group.ID == 0 {
+			clients = strings.TrimPrefix(clients+", all unassigned clients", ", ")
+		}
+		records = append(records, []string{
+			group.Name,
+			enabledString(group.Enabled),
+			strconv.Itoa(group.Adlists),
+			strconv.Itoa(group.DomainlistEntries),
+			clients,
+			group.Description,
+		})
+	}
+
+	if groups == nil {
+		groups = []Group{}
+	}
+
+	writeRecords(
+		format,
+		[]string{"Group", "Enabled", "Adlists", "Domains", "Clients", "Description"},
+		records,
+		groups)
+}
+
+// Returns an error if the database doesn't look like a gravity database
+func requireGravityDatabase(db *sql.DB) error {
+	if !tableExists(db, "adlist") || !tableExists(db, "gravity") {
+		return ErrNotGravityDatabase
+	}
+	return nil
+}
+
+// Splits a list of values concatenated in SQL using gravityListSeparator
+func splitGravityList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, gravityListSeparator)
+}
+
+// Returns a human readable version of an enabled flag
+func enabledString(enabled bool) string {
+	if enabled {
+		return "Yes"
+	}
+	return "No"
+}
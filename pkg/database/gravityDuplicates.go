@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// How much of an adlist's content is unique to it, and how much is also found in other adlists
+type AdlistOverlap struct {
+	// The adlist's ID
+	ID int `json:"id"`
+	// The URL that the adlist is downloaded from
+	Address string `json:"address"`
+	// The number of domains the adlist contributed to gravity
+	Domains int `json:"domains"`
+	// The number of those domains that no other adlist contains
+	Unique int `json:"unique"`
+	// The number of those domains that at least one other adlist also contains
+	Shared int `json:"shared"`
+}
+
+// A domain that appears in more than one adlist
+type DuplicateDomain struct {
+	// The domain
+	Domain string `json:"domain"`
+	// The IDs of the adlists that contain it
+	Adlists []int `json:"adlists"`
+}
+
+// A report on the domains that are duplicated across adlists
+type GravityDuplicatesReport struct {
+	// The total number of distinct domains in gravity
+	DistinctDomains int `json:"distinct_domains"`
+	// The number of distinct domains that are found in more than one adlist
+	DuplicatedDomains int `json:"duplicated_domains"`
+	// Per adlist overlap
+	Adlists []AdlistOverlap `json:"adlists"`
+	// The domains found in the most adlists
+	TopDuplicates []DuplicateDomain `json:"top_duplicates"`
+}
+
+/*
+	Works out how much the adlists in gravity overlap with each other. An adlist with no
+	unique domains adds nothing that isn't already blocked by another list.
+
+	The limit controls how many of the most duplicated domains are included in the report.
+*/
+func GravityDuplicates(db *sql.DB, limit int) (*GravityDuplicatesReport, error) {
+	if err := requireGravityDatabase(db); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultQueryTableLimit
+	}
+
+	report := &GravityDuplicatesReport{}
+
+	if err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN lists > 1 THEN 1 ELSE 0 END), 0)
+		FROM (SELECT COUNT(DISTINCT adlist_id) AS lists FROM gravity GROUP BY domain)
+	`).Scan(&report.DistinctDomains, &report.DuplicatedDomains); err != nil {
+		return nil, fmt.Errorf("error in gravity duplicates query: %s", err.Error())
+	}
+
+	rows, err := db.Query(`
+		WITH domain_lists AS (
+			SELECT domain, COUNT(DISTINCT adlist_id) AS lists
+			FROM gravity
+			GROUP BY domain
+		)
+		SELECT a.id, a.address, COUNT(g.domain), COALESCE(SUM(CASE WHEN dl.lists = 1 THEN 1 ELSE 0 END), 0)
+		FROM adlist a
+		LEFT JOIN gravity g ON g.adlist_id = a.id
+		LEFT JOIN domain_lists dl ON dl.domain = g.domain
+		GROUP BY a.id
+		ORDER BY a.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error in gravity overlap query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var overlap AdlistOverlap
+		if err := rows.Scan(&overlap.ID, &overlap.Address, &overlap.Domains, &overlap.Unique); err != nil {
+			return nil, fmt.Errorf("error reading adlist overlap: %s", err.Error())
+		}
+		overlap.Shared = overlap.Domains - overlap.Unique
+		report.Adlists = append(report.Adlists, overlap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading adlist overlap: %s", err.Error())
+	}
+
+	duplicateRows, err := db.Query(fmt.Sprintf(`
+		SELECT domain, group_concat(DISTINCT adlist_id)
+		FROM gravity
+		GROUP BY domain
+		HAVING COUNT(DISTINCT adlist_id) > 1
+		ORDER BY COUNT(DISTINCT adlist_id) DESC, domain
+		LIMIT %d
+	`, limit))
+	if err != nil {
+		return nil, fmt.Errorf("error in gravity duplicate domains query: %s", err.Error())
+	}
+	defer duplicateRows.Close()
+
+	for duplicateRows.Next() {
+		var duplicate DuplicateDomain
+		var adlists string
+		if err := duplicateRows.Scan(&duplicate.Domain, &adlists); err != nil {
+			return nil, fmt.Errorf("error reading duplicate domain: %s", err.Error())
+		}
+		for _, id := range strings.Split(adlists, ",") {
+			if parsed, err := strconv.Atoi(id); err == nil {
+				duplicate.Adlists = append(duplicate.Adlists, parsed)
+			}
+		}
+		report.TopDuplicates = append(report.TopDuplicates, duplicate)
+	}
+	if err := duplicateRows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading duplicate domains: %s", err.Error())
+	}
+
+	return report, nil
+}
+
+// Writes the report to stdout in a given format
+func (report *GravityDuplicatesReport) Print(format OutputFormat) {
+	var records [][]string
+	for _, overlap := range report.Adlists {
+		records = append(records, []string{
+			strconv.Itoa(overlap.ID),
+			overlap.Address,
+			strconv.Itoa(overlap.Domains),
+			strconv.Itoa(overlap.Unique),
+			strconv.Itoa(overlap.Shared),
+		})
+	}
+	header := []string{"ID", "Address", "Domains", "Unique", "Shared"}
+
+	switch format {
+	case JSONOutput:
+		writeJSON(report)
+	case CSVOutput:
+		writeCSV(header, records)
+	default:
+		localisedNumberWriter := message.NewPrinter(language.English)
+
+		color.Yellow(
+			"%s of %s distinct domains appear in more than one adlist\n\n",
+			localisedNumberWriter.Sprintf("%d", report.DuplicatedDomains),
+			localisedNumberWriter.Sprintf("%d", report.DistinctDomains))
+
+		printRecordsTable(header, records)
+
+		for _, overlap := range report.Adlists {
+			if overlap.Domains > 0 && overlap.Unique == 0 {
+				color.Yellow(
+					"Adlist %d adds no domains that aren't already in other adlists: %s",
+					overlap.ID,
+					overlap.Address)
+			}
+		}
+
+		if len(report.TopDuplicates) > 0 {
+			fmt.Println()
+			fmt.Println("Most duplicated domains")
+			var duplicates [][]string
+			for _, duplicate := range report.TopDuplicates {
+				ids := make([]string, len(duplicate.Adlists))
+				for i, id := range duplicate.Adlists {
+					ids[i] = strconv.Itoa(id)
+				}
+				duplicates = append(duplicates, []string{
+					duplicate.Domain,
+					strconv.Itoa(len(duplicate.Adlists)),
+					strings.Join(ids, ", "),
+				})
+			}
+			printRecordsTable([]string{"Domain", "Adlists", "Adlist IDs"}, duplicates)
+		}
+	}
+}
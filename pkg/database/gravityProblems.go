@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Matches a valid domain name (as used by exact domainlist entries)
+var validDomainPattern = regexp.MustCompile(
+	`^([a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?\.)*[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?\.?$`)
+
+// Pi-Hole specific options that can be appended to regex entries (i.e. ";querytype=AAAA")
+var regexOptionPattern = regexp.MustCompile(`;(querytype|invert|reply)(=[^;]*)?`)
+
+// An entry in the gravity database that is disabled, invalid, or otherwise not doing anything
+type GravityProblem struct {
+	// What kind of entry has the problem (adlist, domain, group or client)
+	Kind string `json:"kind"`
+	// The ID of the entry
+	ID int `json:"id"`
+	// The entry itself (address, domain, name etc...)
+	Entry string `json:"entry"`
+	// What the problem is
+	Problem string `json:"problem"`
+}
+
+/*
+	Looks for entries in the gravity database that are disabled, invalid, or are otherwise
+	not doing anything. This includes:
+		- disabled adlists, domainlist entries and groups
+		- adlists that failed to download, contained invalid domains or are empty
+		- adlists and domainlist entries that aren't assigned to any group
+		- exact domainlist entries that aren't valid domains
+		- regex domainlist entries that don't compile
+
+	Regexes are checked with Go's regex engine, which is close to (but not exactly the same
+	as) the POSIX engine used by FTL, so a failure here means the regex is likely invalid.
+*/
+func GravityProblems(db *sql.DB) ([]GravityProblem, error) {
+	adlists, err := Adlists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []GravityProblem
+	addProblem := func(kind string, id int, entry string, problem string) {
+		problems = append(problems, GravityProblem{Kind: kind, ID: id, Entry: entry, Problem: problem})
+	}
+
+	for _, adlist := range adlists {
+		if !adlist.Enabled {
+			addProblem("adlist", adlist.ID, adlist.Address, "Disabled")
+			continue
+		}
+		switch adlist.Status {
+		case AdlistStatusNames[3]:
+			addProblem("adlist", adlist.ID, adlist.Address, "Download failed, using a cached copy")
+		case AdlistStatusNames[4]:
+			addProblem("adlist", adlist.ID, adlist.Address, "Download failed, no cached copy available")
+		}
+		if adlist.InvalidDomains > 0 {
+			addProblem("adlist", adlist.ID, adlist.Address, fmt.Sprintf("%d invalid domains skipped", adlist.InvalidDomains))
+		}
+		if adlist.Domains == 0 {
+			addProblem("adlist", adlist.ID, adlist.Address, "Contains no domains")
+		}
+		if len(adlist.Groups) == 0 {
+			addProblem("adlist", adlist.ID, adlist.Address, "Not assigned to any group")
+		}
+	}
+
+	if tableExists(db, "domainlist") {
+		rows, err := db.Query(`
+			SELECT d.id, d.type, d.domain, d.enabled,
+			       (SELECT COUNT(*) FROM domainlist_by_group WHERE domainlist_id = d.id)
+			FROM domainlist d
+			ORDER BY d.id
+		`)
+		if err != nil {
+			return nil, fmt.Errorf("error in gravity domainlist query: %s", err.Error())
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id, domainType, groups int
+			var domain string
+			var enabled bool
+			if err := rows.Scan(&id, &domainType, &domain, &enabled, &groups); err != nil {
+				return nil, fmt.Errorf("error reading domainlist entry: %s", err.Error())
+			}
+
+			kind := strings.ToLower(DomainlistTypeNames[domainType])
+			if !enabled {
+				addProblem(kind, id, domain, "Disabled")
+				continue
+			}
+			if groups == 0 {
+				addProblem(kind, id, domain, "Not assigned to any group")
+			}
+			if domainType == 0 || domainType == 1 {
+				if !IsValidDomain(domain) {
+					addProblem(kind, id, domain, "Not a valid domain")
+				}
+			} else if _, err := regexp.Compile(regexOptionPattern.ReplaceAllString(domain, "")); err != nil {
+				addProblem(kind, id, domain, fmt.Sprintf("Regex does not compile: %s", err.Error()))
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading domainlist entries: %s", err.Error())
+		}
+	}
+
+	if tableExists(db, "group") {
+		groups, err := Groups(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if !group.Enabled {
+				addProblem("group", group.ID, group.Name, "Disabled")
+			} else if group.ID != 0 && len(group.Clients) == 0 {
+				addProblem("group", group.ID, group.Name, "No clients assigned, group has no effect")
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// Writes a list of problems to stdout in a given format
+func PrintGravityProblems(problems []GravityProblem, format OutputFormat) {
+	if len(problems) == 0 && format == TextOutput {
+		color.Green("No problems found")
+		return
+	}
+
+	var records [][]string
+	for _, problem := range problems {
+		records = append(records, []string{
+			problem.Kind,
+			strconv.Itoa(problem.ID),
+			problem.Entry,
+			problem.Problem,
+		})
+	}
+
+	if problems == nil {
+		problems = []GravityProblem{}
+	}
+
+	writeRecords(format, []string{"Kind", "ID", "Entry", "Problem"}, records, problems)
+}
+
+// Is a string a valid domain name?
+func IsValidDomain(domain string) bool {
+	return len(domain) > 0 && len(domain) <= 253 && validDomainPattern.MatchString(strings.ToLower(domain))
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Creates a small gravity database with adlists, domainlist entries, groups and clients
+func newTestGravityDatabase(t *testing.T) *sql.DB {
+	return newTestDatabase(t,
+		"CREATE TABLE adlist (id INTEGER PRIMARY KEY, address TEXT, enabled BOOLEAN, date_updated INTEGER, comment TEXT, number INTEGER, invalid_domains INTEGER, status INTEGER)",
+		"CREATE TABLE gravity (domain TEXT, adlist_id INTEGER)",
+		`CREATE TABLE "group" (id INTEGER PRIMARY KEY, enabled BOOLEAN, name TEXT, description TEXT)`,
+		"CREATE TABLE adlist_by_group (adlist_id INTEGER, group_id INTEGER)",
+		"CREATE TABLE domainlist (id INTEGER PRIMARY KEY, type INTEGER, domain TEXT, enabled BOOLEAN)",
+		"CREATE TABLE domainlist_by_group (domainlist_id INTEGER, group_id INTEGER)",
+		"CREATE TABLE client (id INTEGER PRIMARY KEY, ip TEXT)",
+		"CREATE TABLE client_by_group (client_id INTEGER, group_id INTEGER)",
+
+		// adlist 2 failed to download and skipped invalid domains, 3 is disabled and 4 is empty and unassigned
+		`INSERT INTO adlist VALUES
+			(1, 'https://one', 1, 1700000000, 'main', 3, 0, 1),
+			(2, 'https://two', 1, 1700000000, NULL, 2, 5, 3),
+			(3, 'https://three', 0, NULL, NULL, 0, 0, 2),
+			(4, 'https://four', 1, NULL, NULL, 0, 0, 4)`,
+		"INSERT INTO gravity VALUES ('a.com', 1), ('b.com', 1), ('c.com', 1), ('a.com', 2), ('b.com', 2)",
+		`INSERT INTO "group" VALUES (0, 1, 'Default', NULL), (1, 1, 'kids', 'Kids devices'), (2, 0, 'old', NULL), (3, 1, 'empty', NULL)`,
+		"INSERT INTO adlist_by_group VALUES (1, 0), (2, 0), (2, 1), (3, 0)",
+		"INSERT INTO client VALUES (1, '192.168.1.10'), (2, '192.168.1.11')",
+		"INSERT INTO client_by_group VALUES (1, 1), (2, 1)",
+		`INSERT INTO domainlist VALUES
+			(1, 0, 'good.com', 1),
+			(2, 1, 'not a domain', 1),
+			(3, 3, '(unclosed', 1),
+			(4, 3, '^ads\.;querytype=AAAA', 1),
+			(5, 0, 'disabled.com', 0),
+			(6, 1, 'orphan.com', 1)`,
+		"INSERT INTO domainlist_by_group VALUES (1, 0), (2, 0), (3, 0), (4, 1), (5, 0)",
+	)
+}
+
+// Tests for database.Adlists()
+func TestAdlists(t *testing.T) {
+	if _, err := Adlists(newTestDatabase(t, "CREATE TABLE a (b)")); !errors.Is(err, ErrNotGravityDatabase) {
+		t.Error("@TestAdlists: database.Adlists() did not reject a database without gravity tables")
+	}
+
+	adlists, err := Adlists(newTestGravityDatabase(t))
+	if err != nil {
+		t.Fatalf("@TestAdlists: database.Adlists() failed: %s", err)
+	}
+	for _, adlist := range adlists {
+		sort.Strings(adlist.Groups)
+	}
+
+	expected := []Adlist{
+		{ID: 1, Address: "https://one", Enabled: true, Status: "Downloaded", Domains: 3, LastUpdated: 1700000000, Groups: []string{"Default"}, Comment: "main"},
+		{ID: 2, Address: "https://two", Enabled: true, Status: "Unavailable (cached)", Domains: 2, InvalidDomains: 5, LastUpdated: 1700000000, Groups: []string{"Default", "kids"}},
+		{ID: 3, Address: "https://three", Enabled: false, Status: "Unchanged", Groups: []string{"Default"}},
+		{ID: 4, Address: "https://four", Enabled: true, Status: "Unavailable (no cache)", Groups: []string{}},
+	}
+	if !reflect.DeepEqual(adlists, expected) {
+		t.Errorf("@TestAdlists: got %+v, expected %+v", adlists, expected)
+	}
+}
+
+// Tests for database.Adlists() counting domains from the gravity table in older databases
+func TestAdlistsWithoutCounts(t *testing.T) {
+	db := newTestDatabase(t,
+		"CREATE TABLE adlist (id INTEGER PRIMARY KEY, address TEXT, enabled BOOLEAN, date_updated INTEGER, comment TEXT)",
+		"CREATE TABLE gravity (domain TEXT, adlist_id INTEGER)",
+		`CREATE TABLE "group" (id INTEGER PRIMARY KEY, enabled BOOLEAN, name TEXT, description TEXT)`,
+		"CREATE TABLE adlist_by_group (adlist_id INTEGER, group_id INTEGER)",
+		"INSERT INTO adlist VALUES (1, 'https://one', 1, NULL, NULL)",
+		"INSERT INTO gravity VALUES ('a.com', 1), ('b.com', 1)",
+	)
+
+	adlists, err := Adlists(db)
+	if err != nil {
+		t.Fatalf("@TestAdlistsWithoutCounts: database.Adlists() failed: %s", err)
+	}
+	if len(adlists) != 1 || adlists[0].Domains != 2 || adlists[0].Status != "Unknown" {
+		t.Errorf("@TestAdlistsWithoutCounts: unexpected adlists %+v", adlists)
+	}
+}
+
+// Tests for database.Groups()
+func TestGroups(t *testing.T) {
+	groups, err := Groups(newTestGravityDatabase(t))
+	if err != nil {
+		t.Fatalf("@TestGroups: database.Groups() failed: %s", err)
+	}
+	for _, group := range groups {
+		sort.Strings(group.Clients)
+	}
+
+	expected := []Group{
+		{ID: 0, Name: "Default", Enabled: true, Adlists: 3, DomainlistEntries: 4, Clients: []string{}},
+		{ID: 1, Name: "kids", Enabled: true, Description: "Kids devices", Adlists: 1, DomainlistEntries: 1, Clients: []string{"192.168.1.10", "192.168.1.11"}},
+		{ID: 2, Name: "old", Enabled: false, Clients: []string{}},
+		{ID: 3, Name: "empty", Enabled: true, Clients: []string{}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("@TestGroups: got %+v, expected %+v", groups, expected)
+	}
+}
+
+// Tests for database.GravityDuplicates()
+func TestGravityDuplicates(t *testing.T) {
+	report, err := GravityDuplicates(newTestGravityDatabase(t), 10)
+	if err != nil {
+		t.Fatalf("@TestGravityDuplicates: database.GravityDuplicates() failed: %s", err)
+	}
+
+	if report.DistinctDomains != 3 || report.DuplicatedDomains != 2 {
+		t.Errorf(
+			"@TestGravityDuplicates: expected 2 of 3 domains to be duplicated, got %d of %d",
+			report.DuplicatedDomains,
+			report.DistinctDomains)
+	}
+
+	expectedOverlap := []AdlistOverlap{
+		{ID: 1, Address: "https://one", Domains: 3, Unique: 1, Shared: 2},
+		{ID: 2, Address: "https://two", Domains: 2, Unique: 0, Shared: 2},
+		{ID: 3, Address: "https://three"},
+		{ID: 4, Address: "https://four"},
+	}
+	if !reflect.DeepEqual(report.Adlists, expectedOverlap) {
+		t.Errorf("@TestGravityDuplicates: got overlap %+v, expected %+v", report.Adlists, expectedOverlap)
+	}
+
+	for _, duplicate := range report.TopDuplicates {
+		sort.Ints(duplicate.Adlists)
+	}
+	expectedDuplicates := []DuplicateDomain{
+		{Domain: "a.com", Adlists: []int{1, 2}},
+		{Domain: "b.com", Adlists: []int{1, 2}},
+	}
+	if !reflect.DeepEqual(report.TopDuplicates, expectedDuplicates) {
+		t.Errorf("@TestGravityDuplicates: got duplicates %+v, expected %+v", report.TopDuplicates, expectedDuplicates)
+	}
+
+	// the limit applies to the most duplicated domains
+	if report, _ := GravityDuplicates(newTestGravityDatabase(t), 1); len(report.TopDuplicates) != 1 {
+		t.Errorf("@TestGravityDuplicates: a limit of 1 gave %d duplicates", len(report.TopDuplicates))
+	}
+}
+
+// Tests for database.GravityProblems()
+func TestGravityProblems(t *testing.T) {
+	problems, err := GravityProblems(newTestGravityDatabase(t))
+	if err != nil {
+		t.Fatalf("@TestGravityProblems: database.GravityProblems() failed: %s", err)
+	}
+
+	var found []string
+	for _, problem := range problems {
+		// the compile error itself comes from Go's regex engine
+		description := strings.SplitN(problem.Problem, ":", 2)[0]
+		found = append(found, problem.Kind+" "+problem.Entry+": "+description)
+	}
+	expected := []string{
+		"adlist https://two: Download failed, using a cached copy",
+		"adlist https://two: 5 invalid domains skipped",
+		"adlist https://three: Disabled",
+		"adlist https://four: Download failed, no cached copy available",
+		"adlist https://four: Contains no domains",
+		"adlist https://four: Not assigned to any group",
+		"exact deny not a domain: Not a valid domain",
+		"regex deny (unclosed: Regex does not compile",
+		"exact allow disabled.com: Disabled",
+		"exact deny orphan.com: Not assigned to any group",
+		"group old: Disabled",
+		"group empty: No clients assigned, group has no effect",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("@TestGravityProblems: got problems\n%s\nexpected\n%s", strings.Join(found, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// Tests for database.IsValidDomain()
+func TestIsValidDomain(t *testing.T) {
+	tests := map[string]bool{
+		"example.com":                    true,
+		"EXAMPLE.com":                    true,
+		"sub_domain.example.com.":        true,
+		"localhost":                      true,
+		"":                               false,
+		"not a domain":                   false,
+		"-leading.example.com":           false,
+		"trailing-.example.com":          false,
+		"double..dot.com":                false,
+		strings.Repeat("a", 64) + ".com": false,
+	}
+	for domain, expected := range tests {
+		if IsValidDomain(domain) != expected {
+			t.Errorf("@TestIsValidDomain: database.IsValidDomain(%q) should be %t", domain, expected)
+		}
+	}
+}
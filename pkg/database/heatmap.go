@@ -0,0 +1,242 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+/*
+	The size (in seconds) of the buckets that query timestamps are grouped into before being
+	placed into the heatmap. 15 minutes is the smallest offset used by any timezone, so this
+	keeps bucketing correct for timezones that aren't a whole number of hours from UTC.
+*/
+const heatmapBucketSeconds = 900
+
+/*
+	256 colour palette codes used to shade heatmap cells, running from cold to hot.
+	Paired with heatmapGlyphs so that intensity is still visible without colour.
+*/
+var heatmapPalette = []int{240, 28, 34, 40, 226, 214, 208, 196}
+
+// Glyphs used to render heatmap cells, in order of intensity
+var heatmapGlyphs = []string{"·", "░", "░", "▒", "▒", "▓", "▓", "█"}
+
+// Weekdays in the order that they are displayed (Monday first)
+var heatmapWeekdays = []time.Weekday{
+	time.Monday,
+	time.Tuesday,
+	time.Wednesday,
+	time.Thursday,
+	time.Friday,
+	time.Saturday,
+	time.Sunday,
+}
+
+// Query volume aggregated into a weekday/hour grid. Indexed as [weekday][hour], with Monday as 0
+type Heatmap struct {
+	// Total number of queries seen in each cell
+	Total [7][24]int
+	// Number of blocked queries seen in each cell
+	Blocked [7][24]int
+	// The window of time that the heatmap covers
+	Window *TimeWindow
+}
+
+// A single cell of a heatmap, used for CSV and JSON output
+type heatmapCell struct {
+	Weekday string `json:"weekday"`
+	Hour    int    `json:"hour"`
+	Total   int    `json:"total"`
+	Blocked int    `json:"blocked"`
+}
+
+/*
+	Aggregates the queries table into a weekday/hour heatmap. Weekdays and hours are
+	calculated in the OutputLocation timezone.
+
+	Optional filters can be given to only include queries from a single client (matched exactly
+	against the client's address, or its name) or queries for domains containing a given word.
+*/
+func QueryHeatmap(db *sql.DB, window *TimeWindow, clientFilter string, domainFilter string) (*Heatmap, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	since, until := window.Bounds()
+
+	conditions := []string{"timestamp BETWEEN ? AND ?"}
+	args := []interface{}{since, until}
+
+	if clientFilter != "" {
+		names, err := clientNames(db, schema)
+		if err != nil {
+			return nil, err
+		}
+		// the filter can be an address, or the name of one or more clients
+		addresses := append([]string{clientFilter}, names.Addresses(clientFilter)...)
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(addresses)), ", ")
+		conditions = append(conditions, fmt.Sprintf("client IN (%s)", placeholders))
+		for _, address := range addresses {
+			args = append(args, address)
+		}
+	}
+	if domainFilter != "" {
+		conditions = append(conditions, "domain LIKE ?")
+		args = append(args, "%"+domainFilter+"%")
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT timestamp / %d, COUNT(*), SUM(CASE WHEN status IN (%s) THEN 1 ELSE 0 END)
+		FROM queries
+		WHERE %s
+		GROUP BY timestamp / %d
+	`, heatmapBucketSeconds, blockedStatusSQLList(), strings.Join(conditions, " AND "), heatmapBucketSeconds),
+		args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("error in database heatmap query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	heatmap := &Heatmap{Window: window}
+
+	var bucket int64
+	var total int
+	var blocked int
+
+	for rows.Next() {
+		if err := rows.Scan(&bucket, &total, &blocked); err != nil {
+			return nil, fmt.Errorf("error reading heatmap bucket: %s", err.Error())
+		}
+
+		bucketTime := time.Unix(bucket*heatmapBucketSeconds, 0).In(OutputLocation)
+		// shift Go's Sunday-first weekdays so that Monday is 0
+		day := (int(bucketTime.Weekday()) + 6) % 7
+
+		heatmap.Total[day][bucketTime.Hour()] += total
+		heatmap.Blocked[day][bucketTime.Hour()] += blocked
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading heatmap buckets: %s", err.Error())
+	}
+
+	return heatmap, nil
+}
+
+// Writes the heatmap to stdout in a given format
+func (heatmap *Heatmap) Print(format OutputFormat) {
+	switch format {
+	case JSONOutput:
+		writeJSON(struct {
+			Window string        `json:"window"`
+			Cells  []heatmapCell `json:"cells"`
+		}{
+			Window: heatmap.Window.String(),
+			Cells:  heatmap.cells(),
+		})
+	case CSVOutput:
+		var records [][]string
+		for _, cell := range heatmap.cells() {
+			records = append(records, []string{
+				cell.Weekday,
+				strconv.Itoa(cell.Hour),
+				strconv.Itoa(cell.Total),
+				strconv.Itoa(cell.Blocked),
+			})
+		}
+		writeCSV([]string{"weekday", "hour", "total", "blocked"}, records)
+	default:
+		color.Yellow("Window: %s \n\n", heatmap.Window)
+		heatmap.printGrid("Total queries", &heatmap.Total)
+		fmt.Println()
+		heatmap.printGrid("Blocked queries", &heatmap.Blocked)
+	}
+}
+
+// Flattens the heatmap into a list of cells, Monday 00:00 first
+func (heatmap *Heatmap) cells() []heatmapCell {
+	var cells []heatmapCell
+	for day, weekday := range heatmapWeekdays {
+		for hour := 0; hour < 24; hour++ {
+			cells = append(cells, heatmapCell{
+				Weekday: weekday.String(),
+				Hour:    hour,
+				Total:   heatmap.Total[day][hour],
+				Blocked: heatmap.Blocked[day][hour],
+			})
+		}
+	}
+	return cells
+}
+
+/*
+	Renders a single grid to the terminal, with each cell shaded relative to the busiest
+	cell in the grid. Each row is followed by the total for that weekday.
+*/
+func (heatmap *Heatmap) printGrid(title string, grid *[7][24]int) {
+	localisedNumberWriter := message.NewPrinter(language.English)
+
+	highest := 0
+	busiestDay, busiestHour := 0, 0
+	for day := range grid {
+		for hour, count := range grid[day] {
+			if count > highest {
+				highest = count
+				busiestDay, busiestHour = day, hour
+			}
+		}
+	}
+
+	fmt.Println(title)
+
+	// hour headers
+	fmt.Print("     ")
+	for hour := 0; hour < 24; hour++ {
+		fmt.Printf("%02d ", hour)
+	}
+	fmt.Println()
+
+	for day, weekday := range heatmapWeekdays {
+		fmt.Printf("%s  ", weekday.String()[:3])
+		dayTotal := 0
+		for _, count := range grid[day] {
+			level := heatmapLevel(count, highest)
+			cell := color.New(38, 5, color.Attribute(heatmapPalette[level]))
+			fmt.Printf("%s ", cell.Sprint(strings.Repeat(heatmapGlyphs[level], 2)))
+			dayTotal += count
+		}
+		fmt.Printf(" %s\n", localisedNumberWriter.Sprintf("%d", dayTotal))
+	}
+
+	if highest == 0 {
+		color.Red("0 results in database")
+		return
+	}
+
+	fmt.Printf(
+		"Busiest: %s %02d:00 (%s)\n",
+		heatmapWeekdays[busiestDay],
+		busiestHour,
+		localisedNumberWriter.Sprintf("%d", highest))
+}
+
+// Returns an index into the heatmap palette for a count, relative to the maximum count
+func heatmapLevel(count int, highest int) int {
+	if count == 0 || highest == 0 {
+		return 0
+	}
+	levels := len(heatmapPalette) - 1
+	return 1 + int(math.Floor(float64(count)/float64(highest)*float64(levels-1)+0.5))
+}
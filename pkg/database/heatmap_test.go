@@ -0,0 +1,68 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests for database.QueryHeatmap()
+func TestQueryHeatmap(t *testing.T) {
+	// half an hour offsets check that buckets aren't split on whole UTC hours
+	OutputLocation = time.FixedZone("UTC+05:30", 5*60*60+30*60)
+	defer func() { OutputLocation = time.UTC }()
+
+	// 1704067200 is Monday 2024-01-01 00:00 UTC, 05:30 in OutputLocation
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 4)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+		"CREATE TABLE network (id INTEGER PRIMARY KEY, ip TEXT, hwaddr TEXT, interface TEXT, name TEXT, firstSeen INTEGER, lastQuery INTEGER, numQueries INTEGER)",
+		"INSERT INTO network VALUES (1, '192.168.1.10', 'aa:bb:cc:dd:ee:ff', 'eth0', 'laptop', 0, 0, 0)",
+		`INSERT INTO queries VALUES
+			(1, 1704067200, 1, 1, 'ads.example.com', '192.168.1.10', NULL),
+			(2, 1704067260, 1, 2, 'example.com', '192.168.1.10', '8.8.8.8'),
+			(3, 1704068999, 1, 2, 'example.com', '192.168.1.11', '8.8.8.8'),
+			(4, 1704069000, 1, 1, 'ads.tracker.net', '192.168.1.11', NULL),
+			(5, 1704657600, 1, 2, 'example.com', '192.168.1.10', '8.8.8.8'),
+			(6, 1704542400, 1, 5, 'tracker.net', '192.168.1.10', NULL),
+			(7, 1701475200, 1, 2, 'example.com', '192.168.1.10', '8.8.8.8')`,
+	)
+
+	window, err := NewTimeWindow("2024-01-01", "2024-01-08 12:00", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type cell struct{ day, hour, total, blocked int }
+	tests := []struct {
+		clientFilter string
+		domainFilter string
+		expected     []cell
+	}{
+		// Monday 05:30-06:00 and 06:00, Sunday 20:00 UTC is Monday 01:30, and Saturday 17:30
+		{"", "", []cell{{0, 5, 3, 1}, {0, 6, 1, 1}, {0, 1, 1, 0}, {5, 17, 1, 1}}},
+		{"192.168.1.11", "", []cell{{0, 5, 1, 0}, {0, 6, 1, 1}}},
+		{"laptop", "", []cell{{0, 5, 2, 1}, {0, 1, 1, 0}, {5, 17, 1, 1}}},
+		{"", "tracker", []cell{{0, 6, 1, 1}, {5, 17, 1, 1}}},
+	}
+
+	for _, test := range tests {
+		heatmap, err := QueryHeatmap(db, window, test.clientFilter, test.domainFilter)
+		if err != nil {
+			t.Fatalf("@TestQueryHeatmap: database.QueryHeatmap() failed: %s", err)
+		}
+
+		var expected Heatmap
+		for _, cell := range test.expected {
+			expected.Total[cell.day][cell.hour] = cell.total
+			expected.Blocked[cell.day][cell.hour] = cell.blocked
+		}
+		if heatmap.Total != expected.Total || heatmap.Blocked != expected.Blocked {
+			t.Errorf(
+				"@TestQueryHeatmap: client '%s' and domain '%s' gave unexpected cells %v",
+				test.clientFilter,
+				test.domainFilter,
+				heatmap.cells())
+		}
+	}
+}
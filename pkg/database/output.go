@@ -0,0 +1,142 @@
+package database
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// A format that a database command can write its results in
+type OutputFormat string
+
+// Supported output formats
+const (
+	// Human readable tables, with colour where the terminal supports it
+	TextOutput OutputFormat = "text"
+	// Comma separated values, with a header row
+	CSVOutput OutputFormat = "csv"
+	// Indented JSON
+	JSONOutput OutputFormat = "json"
+)
+
+/*
+	Parses an output format given by the user. An empty string defaults to text output
+*/
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(strings.TrimSpace(format))) {
+	case "", TextOutput:
+		return TextOutput, nil
+	case CSVOutput:
+		return CSVOutput, nil
+	case JSONOutput:
+		return JSONOutput, nil
+	}
+	return "", fmt.Errorf("unknown output format '%s' (expected text, csv or json)", format)
+}
+
+// Writes a value to stdout as indented JSON
+func writeJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Fatalf("Failed to write JSON output: %s", err.Error())
+	}
+}
+
+// Writes a header row and a set of records to stdout as CSV
+func writeCSV(header []string, records [][]string) {
+	writer := csv.NewWriter(os.Stdout)
+	_ = writer.Write(header)
+	_ = writer.WriteAll(records)
+	if err := writer.Error(); err != nil {
+		log.Fatalf("Failed to write CSV output: %s", err.Error())
+	}
+}
+
+/*
+	Writes a set of records to stdout in a given format. Text output is rendered as a numbered
+	table, CSV output as a header row followed by the records, and JSON output is the given
+	value (which should hold the same data as the records, but with proper types)
+*/
+func writeRecords(format OutputFormat, header []string, records [][]string, jsonValue interface{}) {
+	switch format {
+	case JSONOutput:
+		writeJSON(jsonValue)
+	case CSVOutput:
+		writeCSV(header, records)
+	default:
+		printRecordsTable(header, records)
+	}
+}
+
+// Renders a set of records as a numbered table
+func printRecordsTable(header []string, records [][]string) {
+	table := newRecordsTable(header, 0)
+	for _, record := range records {
+		table.write(record)
+	}
+	table.finish()
+}
+
+/*
+	A numbered table that records are written to one at a time. The tab writer has to hold on
+	to rows until it is flushed to line their columns up, so a table can be flushed every so
+	many rows to bound its memory use, at the cost of each block being aligned on its own.
+*/
+type recordsTable struct {
+	tabWriter *tabwriter.Writer
+	// How many rows are written between flushes, or 0 to only flush once all rows are written
+	flushEvery int
+	rows       int
+}
+
+// Creates a numbered table and writes its column headers
+func newRecordsTable(header []string, flushEvery int) *recordsTable {
+	table := &recordsTable{tabWriter: NewConfiguredTabWriter(1), flushEvery: flushEvery}
+
+	columns := []interface{}{"#\t"}
+	separator := []interface{}{"\t"}
+	for _, column := range header {
+		columns = append(columns, column+"\t")
+		separator = append(separator, "\t")
+	}
+
+	// insert column headers
+	_, _ = fmt.Fprintln(table.tabWriter, columns...)
+	// insert blank line separator
+	_, _ = fmt.Fprintln(table.tabWriter, separator...)
+	return table
+}
+
+// Writes a single record as the table's next row
+func (table *recordsTable) write(record []string) {
+	table.rows++
+	row := []interface{}{fmt.Sprintf("%d\t", table.rows)}
+	for _, value := range record {
+		row = append(row, value+"\t")
+	}
+	_, _ = fmt.Fprintln(table.tabWriter, row...)
+
+	if table.flushEvery > 0 && table.rows%table.flushEvery == 0 {
+		_ = table.tabWriter.Flush()
+	}
+}
+
+// Flushes the rest of the table and prints how many rows it had
+func (table *recordsTable) finish() {
+	if err := table.tabWriter.Flush(); err != nil {
+		return
+	}
+
+	if table.rows == 0 {
+		color.Red("0 results in database")
+	} else {
+		color.Yellow("\n%d row(s)", table.rows)
+	}
+}
@@ -0,0 +1,430 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+	A minimal Apache Parquet writer, supporting just enough of the format to export flat tables:
+	a flat schema of required or optional columns, PLAIN encoded and uncompressed, with a single
+	data page per column per row group. Row groups are written as they're given, so memory usage
+	is bound by the size of a row group rather than by the size of the whole table.
+	https://parquet.apache.org/docs/file-format/
+*/
+
+// The magic bytes at the start and end of every Parquet file
+var parquetMagic = []byte("PAR1")
+
+// The types of column that the Parquet writer supports
+type parquetColumnType int
+
+const (
+	parquetInt64 parquetColumnType = iota
+	parquetDouble
+	parquetBoolean
+	// A UTF-8 string
+	parquetString
+	// Milliseconds since the Unix epoch
+	parquetTimestamp
+)
+
+// Parquet physical types, encodings and other enums used in file metadata
+const (
+	parquetTypeBoolean   = 0
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetRepetitionRequired = 0
+	parquetRepetitionOptional = 1
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecUncompressed = 0
+	parquetPageTypeData      = 0
+)
+
+// A single column in a Parquet file
+type parquetColumn struct {
+	// The column's name
+	Name string
+	// The type of the column's values
+	Type parquetColumnType
+	// Can the column's values be null?
+	Optional bool
+}
+
+// The metadata of a column chunk that has been written, kept for the file's footer
+type parquetColumnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// The metadata of a row group that has been written, kept for the file's footer
+type parquetRowGroup struct {
+	columns []parquetColumnChunk
+	size    int64
+	numRows int64
+}
+
+// Writes a Parquet file to an underlying writer, one row group at a time
+type parquetWriter struct {
+	writer    io.Writer
+	offset    int64
+	columns   []parquetColumn
+	rowGroups []parquetRowGroup
+	numRows   int64
+}
+
+// Creates a new Parquet writer, writing the file's leading magic bytes
+func newParquetWriter(writer io.Writer, columns []parquetColumn) (*parquetWriter, error) {
+	parquet := &parquetWriter{writer: writer, columns: columns}
+	if err := parquet.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return parquet, nil
+}
+
+/*
+	Writes a row group. Values are given column by column, so values[c][r] is the value of
+	column c in row r. Null values are given as nil, and are only allowed in optional columns.
+*/
+func (parquet *parquetWriter) WriteRowGroup(values [][]interface{}) error {
+	if len(values) != len(parquet.columns) {
+		return fmt.Errorf("expected values for %d parquet columns, got %d", len(parquet.columns), len(values))
+	}
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil
+	}
+
+	rowGroup := parquetRowGroup{numRows: int64(len(values[0]))}
+	for i, column := range parquet.columns {
+		page, err := encodeParquetPage(column, values[i])
+		if err != nil {
+			return err
+		}
+
+		header := &thriftWriter{}
+		header.i32Field(1, parquetPageTypeData)
+		header.i32Field(2, int32(len(page)))
+		header.i32Field(3, int32(len(page)))
+		header.structField(5, func() {
+			header.i32Field(1, int32(len(values[i])))
+			header.i32Field(2, parquetEncodingPlain)
+			header.i32Field(3, parquetEncodingRLE)
+			header.i32Field(4, parquetEncodingRLE)
+		})
+		header.stop()
+
+		chunk := parquetColumnChunk{offset: parquet.offset, numValues: int64(len(values[i]))}
+		if err := parquet.write(header.Bytes()); err != nil {
+			return err
+		}
+		if err := parquet.write(page); err != nil {
+			return err
+		}
+		chunk.size = parquet.offset - chunk.offset
+
+		rowGroup.columns = append(rowGroup.columns, chunk)
+		rowGroup.size += chunk.size
+	}
+
+	parquet.rowGroups = append(parquet.rowGroups, rowGroup)
+	parquet.numRows += rowGroup.numRows
+	return nil
+}
+
+// Writes the file's footer. The underlying writer is not closed
+func (parquet *parquetWriter) Close() error {
+	footer := &thriftWriter{}
+	footer.i32Field(1, 1)
+	footer.listField(2, thriftStruct, len(parquet.columns)+1, func(i int) {
+		if i == 0 {
+			footer.binaryField(4, []byte("schema"))
+			footer.i32Field(5, int32(len(parquet.columns)))
+		} else {
+			column := parquet.columns[i-1]
+			footer.i32Field(1, column.physicalType())
+			repetition := int32(parquetRepetitionRequired)
+			if column.Optional {
+				repetition = parquetRepetitionOptional
+			}
+			footer.i32Field(3, repetition)
+			footer.binaryField(4, []byte(column.Name))
+			switch column.Type {
+			case parquetString:
+				footer.i32Field(6, parquetConvertedUTF8)
+			case parquetTimestamp:
+				footer.i32Field(6, parquetConvertedTimestampMillis)
+			}
+		}
+		footer.stop()
+	})
+	footer.i64Field(3, parquet.numRows)
+	footer.listField(4, thriftStruct, len(parquet.rowGroups), func(i int) {
+		rowGroup := parquet.rowGroups[i]
+		footer.listField(1, thriftStruct, len(rowGroup.columns), func(c int) {
+			chunk, column := rowGroup.columns[c], parquet.columns[c]
+			footer.i64Field(2, chunk.offset)
+			footer.structField(3, func() {
+				footer.i32Field(1, column.physicalType())
+				footer.listField(2, thriftI32, 2, func(e int) {
+					footer.i32([]int32{parquetEncodingPlain, parquetEncodingRLE}[e])
+				})
+				footer.listField(3, thriftBinary, 1, func(int) {
+					footer.binary([]byte(column.Name))
+				})
+				footer.i32Field(4, parquetCodecUncompressed)
+				footer.i64Field(5, chunk.numValues)
+				footer.i64Field(6, chunk.size)
+				footer.i64Field(7, chunk.size)
+				footer.i64Field(9, chunk.offset)
+			})
+			footer.stop()
+		})
+		footer.i64Field(2, rowGroup.size)
+		footer.i64Field(3, rowGroup.numRows)
+		footer.stop()
+	})
+	footer.binaryField(6, []byte("Pi-CLI"))
+	footer.stop()
+
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(footer.Len()))
+
+	for _, part := range [][]byte{footer.Bytes(), length, parquetMagic} {
+		if err := parquet.write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes to the underlying writer, keeping track of the current offset into the file
+func (parquet *parquetWriter) write(data []byte) error {
+	n, err := parquet.writer.Write(data)
+	parquet.offset += int64(n)
+	return err
+}
+
+// The Parquet physical type used to store a column's values
+func (column parquetColumn) physicalType() int32 {
+	switch column.Type {
+	case parquetDouble:
+		return parquetTypeDouble
+	case parquetBoolean:
+		return parquetTypeBoolean
+	case parquetString:
+		return parquetTypeByteArray
+	default:
+		return parquetTypeInt64
+	}
+}
+
+/*
+	Encodes a column's values as the body of a data page. Optional columns are prefixed with
+	their definition levels (1 for a value, 0 for null), and only non-null values are stored.
+*/
+func encodeParquetPage(column parquetColumn, values []interface{}) ([]byte, error) {
+	page := &bytes.Buffer{}
+
+	if column.Optional {
+		levels := make([]bool, len(values))
+		for i, value := range values {
+			levels[i] = value != nil
+		}
+		encoded := encodeParquetLevels(levels)
+		_ = binary.Write(page, binary.LittleEndian, uint32(len(encoded)))
+		page.Write(encoded)
+	}
+
+	var booleans []bool
+	for _, value := range values {
+		if value == nil {
+			if !column.Optional {
+				return nil, fmt.Errorf("parquet column '%s' is not optional, but contains a null value", column.Name)
+			}
+			continue
+		}
+
+		switch column.Type {
+		case parquetInt64, parquetTimestamp:
+			v, ok := value.(int64)
+			if !ok {
+				return nil, parquetTypeError(column, value)
+			}
+			_ = binary.Write(page, binary.LittleEndian, v)
+		case parquetDouble:
+			v, ok := value.(float64)
+			if !ok {
+				return nil, parquetTypeError(column, value)
+			}
+			_ = binary.Write(page, binary.LittleEndian, math.Float64bits(v))
+		case parquetString:
+			v, ok := value.(string)
+			if !ok {
+				return nil, parquetTypeError(column, value)
+			}
+			_ = binary.Write(page, binary.LittleEndian, uint32(len(v)))
+			page.WriteString(v)
+		case parquetBoolean:
+			v, ok := value.(bool)
+			if !ok {
+				return nil, parquetTypeError(column, value)
+			}
+			booleans = append(booleans, v)
+		}
+	}
+
+	// booleans are bit packed, least significant bit first
+	if column.Type == parquetBoolean {
+		packed := make([]byte, (len(booleans)+7)/8)
+		for i, v := range booleans {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(packed)
+	}
+
+	return page.Bytes(), nil
+}
+
+// Encodes definition levels (with a bit width of 1) as runs of the RLE/bit packing hybrid encoding
+func encodeParquetLevels(levels []bool) []byte {
+	encoded := &bytes.Buffer{}
+	for start := 0; start < len(levels); {
+		end := start
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		writeUvarint(encoded, uint64(end-start)<<1)
+		if levels[start] {
+			encoded.WriteByte(1)
+		} else {
+			encoded.WriteByte(0)
+		}
+		start = end
+	}
+	return encoded.Bytes()
+}
+
+func parquetTypeError(column parquetColumn, value interface{}) error {
+	return fmt.Errorf("parquet column '%s' cannot hold a value of type %T", column.Name, value)
+}
+
+/*
+	Parquet's file metadata is serialised with Thrift's compact protocol. This writer supports
+	just the parts of the protocol that Parquet's metadata uses.
+	https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+*/
+
+// Thrift compact protocol type identifiers
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Serialises structs using Thrift's compact protocol
+type thriftWriter struct {
+	bytes.Buffer
+	// The ID of the last field written in each struct that is currently open
+	lastFieldIDs []int16
+}
+
+// Writes a field header, encoding the field ID as a delta from the last one where possible
+func (thrift *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	if len(thrift.lastFieldIDs) == 0 {
+		thrift.lastFieldIDs = append(thrift.lastFieldIDs, 0)
+	}
+	last := &thrift.lastFieldIDs[len(thrift.lastFieldIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		thrift.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		thrift.WriteByte(fieldType)
+		writeUvarint(&thrift.Buffer, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (thrift *thriftWriter) i32Field(id int16, value int32) {
+	thrift.fieldHeader(id, thriftI32)
+	thrift.i32(value)
+}
+
+func (thrift *thriftWriter) i64Field(id int16, value int64) {
+	thrift.fieldHeader(id, thriftI64)
+	writeUvarint(&thrift.Buffer, zigzag(value))
+}
+
+func (thrift *thriftWriter) binaryField(id int16, value []byte) {
+	thrift.fieldHeader(id, thriftBinary)
+	thrift.binary(value)
+}
+
+// Writes a struct field, with its contents written by a callback
+func (thrift *thriftWriter) structField(id int16, contents func()) {
+	thrift.fieldHeader(id, thriftStruct)
+	thrift.lastFieldIDs = append(thrift.lastFieldIDs, 0)
+	contents()
+	thrift.stop()
+}
+
+/*
+	Writes a list field, with each element written by a callback. Struct elements are opened
+	before the callback, and must be ended with stop()
+*/
+func (thrift *thriftWriter) listField(id int16, elementType byte, size int, element func(i int)) {
+	thrift.fieldHeader(id, thriftList)
+	if size < 15 {
+		thrift.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		thrift.WriteByte(0xf0 | elementType)
+		writeUvarint(&thrift.Buffer, uint64(size))
+	}
+	for i := 0; i < size; i++ {
+		if elementType == thriftStruct {
+			thrift.lastFieldIDs = append(thrift.lastFieldIDs, 0)
+		}
+		element(i)
+	}
+}
+
+func (thrift *thriftWriter) i32(value int32) {
+	writeUvarint(&thrift.Buffer, zigzag(int64(value)))
+}
+
+func (thrift *thriftWriter) binary(value []byte) {
+	writeUvarint(&thrift.Buffer, uint64(len(value)))
+	thrift.Write(value)
+}
+
+// Ends the struct that is currently open
+func (thrift *thriftWriter) stop() {
+	thrift.WriteByte(0)
+	if len(thrift.lastFieldIDs) > 0 {
+		thrift.lastFieldIDs = thrift.lastFieldIDs[:len(thrift.lastFieldIDs)-1]
+	}
+}
+
+// Zigzag encodes a signed integer, so that small negative numbers are also small varints
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buffer.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+/*
+	Just enough of a Parquet reader to check what the writer produces: the footer is decoded with
+	a generic Thrift compact protocol reader, and the data pages of each column are decoded back
+	into values, with nil for nulls.
+*/
+
+// A decoded Parquet file
+type testParquetFile struct {
+	// The file's FileMetaData, keyed by Thrift field ID
+	metadata map[int16]interface{}
+	// Each column's values across all row groups, keyed by column name
+	columns map[string][]interface{}
+}
+
+// Decodes a Parquet file written by the Parquet writer
+func readTestParquetFile(file []byte) (*testParquetFile, error) {
+	if len(file) < 12 || !bytes.HasPrefix(file, parquetMagic) || !bytes.HasSuffix(file, parquetMagic) {
+		return nil, errors.New("missing the Parquet magic bytes")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footerLength > len(file)-12 {
+		return nil, fmt.Errorf("footer length %d is longer than the file", footerLength)
+	}
+	footer := &thriftReader{data: file[len(file)-8-footerLength : len(file)-8]}
+	metadata, err := footer.structValue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the footer: %s", err)
+	}
+	if footer.offset != len(footer.data) {
+		return nil, fmt.Errorf("%d bytes left over after the footer", len(footer.data)-footer.offset)
+	}
+
+	parsed := &testParquetFile{metadata: metadata, columns: map[string][]interface{}{}}
+	rowGroups, _ := metadata[4].([]interface{})
+	for _, rowGroup := range rowGroups {
+		chunks, _ := rowGroup.(map[int16]interface{})[1].([]interface{})
+		for _, chunk := range chunks {
+			chunkMetadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			name := string(chunkMetadata[3].([]interface{})[0].([]byte))
+			values, err := readTestParquetPage(file, chunkMetadata, parsed.optional(name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read column '%s': %s", name, err)
+			}
+			parsed.columns[name] = append(parsed.columns[name], values...)
+		}
+	}
+	return parsed, nil
+}
+
+// The schema's column names (after the root element), with '?' appended to optional ones
+func (file *testParquetFile) schema() []string {
+	var columns []string
+	elements, _ := file.metadata[2].([]interface{})
+	for i, element := range elements {
+		fields := element.(map[int16]interface{})
+		if i == 0 {
+			continue
+		}
+		name := string(fields[4].([]byte))
+		if fields[3] == int64(parquetRepetitionOptional) {
+			name += "?"
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func (file *testParquetFile) optional(name string) bool {
+	for _, column := range file.schema() {
+		if column == name+"?" {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes the single data page of a column chunk
+func readTestParquetPage(file []byte, chunkMetadata map[int16]interface{}, optional bool) ([]interface{}, error) {
+	offset, physicalType := int(chunkMetadata[9].(int64)), chunkMetadata[1].(int64)
+	header := &thriftReader{data: file, offset: offset}
+	pageHeader, err := header.structValue()
+	if err != nil {
+		return nil, err
+	}
+	pageSize := int(pageHeader[3].(int64))
+	numValues := int(pageHeader[5].(map[int16]interface{})[1].(int64))
+	if numValues != int(chunkMetadata[5].(int64)) {
+		return nil, fmt.Errorf("page has %d values, column chunk has %d", numValues, chunkMetadata[5])
+	}
+	page := bytes.NewReader(file[header.offset : header.offset+pageSize])
+
+	// every value is defined unless the column is optional
+	defined := make([]bool, numValues)
+	for i := range defined {
+		defined[i] = true
+	}
+	if optional {
+		var levelsLength uint32
+		if err := binary.Read(page, binary.LittleEndian, &levelsLength); err != nil {
+			return nil, err
+		}
+		levels := make([]byte, levelsLength)
+		if _, err := page.Read(levels); err != nil {
+			return nil, err
+		}
+		if defined, err = decodeTestParquetLevels(levels, numValues); err != nil {
+			return nil, err
+		}
+	}
+
+	var values []interface{}
+	var booleans byte
+	booleanIndex := 0
+	for _, isDefined := range defined {
+		if !isDefined {
+			values = append(values, nil)
+			continue
+		}
+		switch physicalType {
+		case parquetTypeInt64:
+			var v int64
+			err = binary.Read(page, binary.LittleEndian, &v)
+			values = append(values, v)
+		case parquetTypeDouble:
+			var v uint64
+			err = binary.Read(page, binary.LittleEndian, &v)
+			values = append(values, math.Float64frombits(v))
+		case parquetTypeByteArray:
+			var length uint32
+			if err = binary.Read(page, binary.LittleEndian, &length); err == nil {
+				v := make([]byte, length)
+				_, err = page.Read(v)
+				values = append(values, string(v))
+			}
+		case parquetTypeBoolean:
+			if booleanIndex%8 == 0 {
+				booleans, err = page.ReadByte()
+			}
+			values = append(values, booleans&(1<<(booleanIndex%8)) != 0)
+			booleanIndex++
+		default:
+			return nil, fmt.Errorf("unexpected physical type %d", physicalType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if page.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes left over in the page", page.Len())
+	}
+	return values, nil
+}
+
+// Decodes definition levels written as RLE runs, with a bit width of 1
+func decodeTestParquetLevels(encoded []byte, count int) ([]bool, error) {
+	levels := &thriftReader{data: encoded}
+	var defined []bool
+	for levels.offset < len(encoded) {
+		header, err := levels.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if header&1 != 0 {
+			return nil, errors.New("bit packed definition levels are not supported")
+		}
+		if levels.offset >= len(encoded) {
+			return nil, errors.New("definition level run is missing its value")
+		}
+		value := encoded[levels.offset] == 1
+		levels.offset++
+		for i := uint64(0); i < header>>1; i++ {
+			defined = append(defined, value)
+		}
+	}
+	if len(defined) != count {
+		return nil, fmt.Errorf("got %d definition levels, expected %d", len(defined), count)
+	}
+	return defined, nil
+}
+
+// Decodes Thrift's compact protocol, giving structs as maps of field IDs to values
+type thriftReader struct {
+	data   []byte
+	offset int
+}
+
+func (thrift *thriftReader) uvarint() (uint64, error) {
+	value, n := binary.Uvarint(thrift.data[thrift.offset:])
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid varint at offset %d", thrift.offset)
+	}
+	thrift.offset += n
+	return value, nil
+}
+
+func (thrift *thriftReader) byte() (byte, error) {
+	if thrift.offset >= len(thrift.data) {
+		return 0, errors.New("unexpected end of data")
+	}
+	thrift.offset++
+	return thrift.data[thrift.offset-1], nil
+}
+
+func (thrift *thriftReader) structValue() (map[int16]interface{}, error) {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		header, err := thrift.byte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			encoded, err := thrift.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(unzigzag(encoded))
+		}
+		fieldType := header & 0x0f
+		switch fieldType {
+		// booleans are held in the field's type
+		case 1, 2:
+			fields[id] = fieldType == 1
+		default:
+			if fields[id], err = thrift.value(fieldType); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (thrift *thriftReader) value(valueType byte) (interface{}, error) {
+	switch valueType {
+	case thriftI32, thriftI64:
+		encoded, err := thrift.uvarint()
+		return unzigzag(encoded), err
+	case thriftBinary:
+		length, err := thrift.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(thrift.data)-thrift.offset) < length {
+			return nil, errors.New("binary value is longer than the data")
+		}
+		thrift.offset += int(length)
+		return thrift.data[thrift.offset-int(length) : thrift.offset], nil
+	case thriftStruct:
+		return thrift.structValue()
+	case thriftList:
+		header, err := thrift.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = thrift.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		list := make([]interface{}, 0, size)
+		for i := uint64(0); i < size; i++ {
+			element, err := thrift.value(header & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, element)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported thrift type %d at offset %d", valueType, thrift.offset)
+}
+
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
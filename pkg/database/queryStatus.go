@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+	Mapping between the status codes stored in the FTL database's `queries` table and
+	their meanings. https://docs.pi-hole.net/database/ftl/#supported-status-types
+*/
+var QueryStatusNames = map[int]string{
+	0:  "Unknown",
+	1:  "Blocked (gravity)",
+	2:  "Forwarded",
+	3:  "Cached",
+	4:  "Blocked (regex)",
+	5:  "Blocked (exact)",
+	6:  "Blocked (upstream, known blocking IP)",
+	7:  "Blocked (upstream, NULL)",
+	8:  "Blocked (upstream, NXDOMAIN with RA)",
+	9:  "Blocked (gravity, CNAME)",
+	10: "Blocked (regex, CNAME)",
+	11: "Blocked (exact, CNAME)",
+	12: "Retried",
+	13: "Retried (ignored)",
+	14: "Already forwarded",
+	15: "Blocked (database busy)",
+	16: "Blocked (special domain)",
+	17: "Cached (stale)",
+	18: "Blocked (upstream, EDE 15)",
+}
+
+/*
+	The number of queries needed before a block rate is compared with another, so that a block
+	rate made from one or two queries (which can only be 0%, 50% or 100%) isn't treated as a change
+*/
+const minimumBlockRateQueries = 5
+
+// The status codes that denote a query that was blocked by the Pi-Hole or by its upstream
+var BlockedQueryStatuses = []int{1, 4, 5, 6, 7, 8, 9, 10, 11, 15, 16, 18}
+
+// Returns the name of a query status code
+func QueryStatusName(status int) string {
+	if name, ok := QueryStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%d)", status)
+}
+
+// Does a status code denote a blocked query?
+func IsBlockedStatus(status int) bool {
+	for _, blocked := range BlockedQueryStatuses {
+		if status == blocked {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns the blocked statuses as a comma separated list that can be placed directly into
+	an SQL "status IN (...)" clause. The list is made up of constant integers so is safe to
+	be formatted into the query string.
+*/
+func blockedStatusSQLList() string {
+	statuses := make([]string, len(BlockedQueryStatuses))
+	for i, status := range BlockedQueryStatuses {
+		statuses[i] = fmt.Sprintf("%d", status)
+	}
+	return strings.Join(statuses, ",")
+}
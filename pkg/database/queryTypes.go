@@ -0,0 +1,40 @@
+package database
+
+import "fmt"
+
+/*
+	Mapping between the query type codes stored in the FTL database's `queries` table and
+	the DNS record types that they represent. https://docs.pi-hole.net/database/ftl/#supported-query-types
+*/
+var QueryTypeNames = map[int]string{
+	1:  "A",
+	2:  "AAAA",
+	3:  "ANY",
+	4:  "SRV",
+	5:  "SOA",
+	6:  "PTR",
+	7:  "TXT",
+	8:  "NAPTR",
+	9:  "MX",
+	10: "DS",
+	11: "RRSIG",
+	12: "DNSKEY",
+	13: "NS",
+	14: "OTHER",
+	15: "SVCB",
+	16: "HTTPS",
+}
+
+/*
+	Returns the name of a query type code. FTL stores types that it has no name for as
+	100 + the raw record type, these are returned in the form "TYPE<n>"
+*/
+func QueryTypeName(queryType int) string {
+	if name, ok := QueryTypeNames[queryType]; ok {
+		return name
+	}
+	if queryType > 100 {
+		return fmt.Sprintf("TYPE%d", queryType-100)
+	}
+	return fmt.Sprintf("Unknown (%d)", queryType)
+}
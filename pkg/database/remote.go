@@ -0,0 +1,269 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Remote database constants
+const (
+	// Where Pi-Hole keeps its FTL database
+	DefaultRemoteDatabaseLocation = "/etc/pihole/pihole-FTL.db"
+	// How old a cached snapshot can be before a new one is pulled
+	DefaultSnapshotMaxAge = time.Minute * 15
+	// The name of the directory (inside of the user's cache directory) that snapshots are kept in
+	SnapshotCacheDirectoryName = "picli"
+)
+
+/*
+	The SSH client binary used to pull snapshots. The system's client is used (rather than an
+	SSH library) so that the user's existing SSH config, keys, agent and jump hosts all just work.
+*/
+var SSHCommand = "ssh"
+
+// Every SQLite database file starts with this header
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// A Pi-Hole FTL database on a remote machine that can be reached over SSH
+type RemoteDatabase struct {
+	// The SSH destination, i.e. "pi@192.168.1.2" or a host alias from the user's SSH config
+	Destination string
+	// The path to the database on the remote machine
+	Path string
+}
+
+// Metadata stored alongside each cached snapshot
+type snapshotMetadata struct {
+	// The SSH destination that the snapshot was pulled from
+	Destination string `json:"destination"`
+	// The path to the database on the remote machine
+	Path string `json:"path"`
+	// When the snapshot was taken
+	TakenAt time.Time `json:"taken_at"`
+}
+
+/*
+	Parses a remote database in the form "[user@]host[:path]". If no path is given, the
+	given default path is assumed.
+*/
+func ParseRemoteDatabase(remote string, defaultPath string) (*RemoteDatabase, error) {
+	remote = strings.TrimSpace(remote)
+	destination, path := remote, defaultPath
+
+	/*
+		Split on the first colon after the host, ignoring colons inside of a bracketed IPv6
+		address (i.e. "pi@[fe80::1]:/etc/pihole/pihole-FTL.db")
+	*/
+	hostStart := strings.LastIndex(remote, "@") + 1
+	searchFrom := hostStart
+	if strings.HasPrefix(remote[hostStart:], "[") {
+		if closing := strings.Index(remote[hostStart:], "]"); closing != -1 {
+			searchFrom = hostStart + closing
+		}
+	}
+	if colon := strings.Index(remote[searchFrom:], ":"); colon != -1 {
+		destination = remote[:searchFrom+colon]
+		if remotePath := remote[searchFrom+colon+1:]; remotePath != "" {
+			path = remotePath
+		}
+	}
+
+	destination = strings.Replace(strings.Replace(destination, "[", "", 1), "]", "", 1)
+
+	if destination == "" || strings.HasSuffix(destination, "@") || strings.HasPrefix(destination, "-") {
+		return nil, fmt.Errorf("'%s' is not a valid remote, expected [user@]host[:path]", remote)
+	}
+
+	return &RemoteDatabase{Destination: destination, Path: path}, nil
+}
+
+/*
+	Returns another database file on the same remote, in the same directory as this one (i.e.
+	the gravity database that sits alongside the FTL database). Remote paths are always
+	slash separated, whatever the local OS.
+*/
+func (remote *RemoteDatabase) Sibling(fileName string) *RemoteDatabase {
+	return &RemoteDatabase{Destination: remote.Destination, Path: path.Join(path.Dir(remote.Path), fileName)}
+}
+
+/*
+	Returns the path to a local snapshot of the remote database. If a cached snapshot exists
+	and is younger than maxAge, it is reused. Otherwise (or if refresh is true) a new snapshot
+	is pulled over SSH.
+*/
+func (remote *RemoteDatabase) Snapshot(maxAge time.Duration, refresh bool) (string, error) {
+	cacheDirectory, err := snapshotCacheDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	snapshotPath := filepath.Join(cacheDirectory, remote.cacheKey()+".db")
+	metadataPath := snapshotPath + ".json"
+
+	if !refresh {
+		if metadata, err := readSnapshotMetadata(metadataPath); err == nil {
+			if age := time.Since(metadata.TakenAt); age < maxAge {
+				if _, err := os.Stat(snapshotPath); err == nil {
+					color.Yellow(
+						"Using cached snapshot of %s:%s taken %s ago (use --refresh to pull a new one)",
+						remote.Destination,
+						remote.Path,
+						age.Round(time.Second))
+					return snapshotPath, nil
+				}
+			}
+		}
+	}
+
+	color.Yellow("Pulling a snapshot of %s:%s...", remote.Destination, remote.Path)
+
+	// write to a temporary file first, so a failed transfer never replaces a good snapshot
+	temporary, err := os.CreateTemp(cacheDirectory, "snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temporary.Name())
+
+	takenAt := time.Now()
+	if err := remote.pull(temporary); err != nil {
+		_ = temporary.Close()
+		return "", err
+	}
+	if err := temporary.Close(); err != nil {
+		return "", err
+	}
+
+	if err := validateSnapshot(temporary.Name()); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(temporary.Name(), snapshotPath); err != nil {
+		return "", err
+	}
+
+	metadata, _ := json.MarshalIndent(snapshotMetadata{
+		Destination: remote.Destination,
+		Path:        remote.Path,
+		TakenAt:     takenAt,
+	}, "", "\t")
+	if err := os.WriteFile(metadataPath, metadata, 0600); err != nil {
+		return "", err
+	}
+
+	color.Green("Snapshot saved to %s", snapshotPath)
+	return snapshotPath, nil
+}
+
+/*
+	Takes a consistent snapshot of the database on the remote machine and streams it into
+	a writer. Copying the database file directly could catch FTL part way through a write,
+	so SQLite's online backup (via the sqlite3 shell's .backup command) is used to create a
+	consistent copy in a temporary file first. Pi-Hole bundles an sqlite3 shell inside of the
+	pihole-FTL binary, which is used if sqlite3 itself isn't installed.
+*/
+func (remote *RemoteDatabase) pull(destination io.Writer) error {
+	/*
+		The snapshot holds the whole DNS history, so the temporary file is created by mktemp
+		(an unpredictable name, so nothing can be put in its place beforehand) and is only
+		readable by the user that's logged in. mktemp's names are safe to use unquoted in the
+		.backup command.
+	*/
+	script := fmt.Sprintf(`set -e
+umask 077
+tmp=$(mktemp /tmp/picli-snapshot.XXXXXX)
+trap 'rm -f "$tmp"' EXIT
+if command -v sqlite3 >/dev/null 2>&1; then
+	sqlite3 -readonly %[1]s ".backup $tmp"
+else
+	pihole-FTL sqlite3 -readonly %[1]s ".backup $tmp"
+fi
+cat "$tmp"`,
+		shellQuote(remote.Path))
+
+	var stderr bytes.Buffer
+
+	command := exec.Command(SSHCommand, remote.Destination, script)
+	command.Stdin = os.Stdin
+	command.Stdout = destination
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("failed to pull a snapshot from %s: %s", remote.Destination, message)
+	}
+	return nil
+}
+
+// A filesystem safe name for the remote's cached snapshot, unique to the destination and path
+func (remote *RemoteDatabase) cacheKey() string {
+	hash := sha256.Sum256([]byte(remote.Destination + ":" + remote.Path))
+	safeDestination := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, remote.Destination)
+	return fmt.Sprintf("%s-%s", safeDestination, hex.EncodeToString(hash[:])[:12])
+}
+
+// Returns (and creates if needed) the directory that snapshots are cached in
+func snapshotCacheDirectory() (string, error) {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	directory := filepath.Join(userCache, SnapshotCacheDirectoryName, "snapshots")
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+	return directory, nil
+}
+
+// Reads the metadata stored alongside a cached snapshot
+func readSnapshotMetadata(path string) (*snapshotMetadata, error) {
+	byteArr, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &snapshotMetadata{}
+	if err := json.Unmarshal(byteArr, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// Checks that a pulled snapshot is actually an SQLite database
+func validateSnapshot(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(file, header); err != nil || !bytes.Equal(header, sqliteHeader) {
+		return errors.New("the pulled snapshot is not an SQLite database")
+	}
+	return nil
+}
+
+// Quotes a string so that it is passed as a single argument by a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Tests for database.ParseRemoteDatabase()
+func TestParseRemoteDatabase(t *testing.T) {
+	valid := map[string]RemoteDatabase{
+		"pi@192.168.1.2":                  {Destination: "pi@192.168.1.2", Path: DefaultRemoteDatabaseLocation},
+		"pihole":                          {Destination: "pihole", Path: DefaultRemoteDatabaseLocation},
+		"pi@pihole:":                      {Destination: "pi@pihole", Path: DefaultRemoteDatabaseLocation},
+		"pi@pihole:/srv/pihole-FTL.db":    {Destination: "pi@pihole", Path: "/srv/pihole-FTL.db"},
+		"pi@[fe80::1]:/srv/pihole-FTL.db": {Destination: "pi@fe80::1", Path: "/srv/pihole-FTL.db"},
+		"pi@[fe80::1]":                    {Destination: "pi@fe80::1", Path: DefaultRemoteDatabaseLocation},
+	}
+	for input, expected := range valid {
+		remote, err := ParseRemoteDatabase(input, DefaultRemoteDatabaseLocation)
+		if err != nil {
+			t.Errorf("@TestParseRemoteDatabase: database.ParseRemoteDatabase() failed to parse '%s': %s", input, err)
+			continue
+		}
+		if *remote != expected {
+			t.Errorf("@TestParseRemoteDatabase: database.ParseRemoteDatabase() parsed '%s' as %+v, expected %+v", input, *remote, expected)
+		}
+	}
+
+	for _, input := range []string{"", "pi@", ":/srv/pihole-FTL.db", "-oProxyCommand=x"} {
+		if _, err := ParseRemoteDatabase(input, DefaultRemoteDatabaseLocation); err == nil {
+			t.Errorf("@TestParseRemoteDatabase: database.ParseRemoteDatabase() accepted invalid remote '%s'", input)
+		}
+	}
+}
+
+// Tests for database.RemoteDatabase.Sibling()
+func TestRemoteDatabaseSibling(t *testing.T) {
+	tests := map[string]string{
+		"pi@pihole":                           DefaultRemoteGravityLocation,
+		"pi@pihole:/srv/pihole/pihole-FTL.db": "/srv/pihole/gravity.db",
+		"pi@pihole:pihole-FTL.db":             "gravity.db",
+	}
+	for input, expected := range tests {
+		remote, err := ParseRemoteDatabase(input, DefaultRemoteDatabaseLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sibling := remote.Sibling("gravity.db")
+		if sibling.Destination != remote.Destination || sibling.Path != expected {
+			t.Errorf("@TestRemoteDatabaseSibling: '%s' gave %+v, expected the path %s", input, *sibling, expected)
+		}
+	}
+}
+
+/*
+	Tests for database.RemoteDatabase.Snapshot(). Rather than needing an SSH server, SSH is
+	swapped out for a script that runs the remote command locally.
+*/
+func TestRemoteDatabaseSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake SSH client requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is required to take snapshots")
+	}
+
+	directory := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(directory, "cache"))
+	t.Setenv("HOME", directory)
+
+	fakeSSH := filepath.Join(directory, "ssh")
+	if err := os.WriteFile(fakeSSH, []byte("#!/bin/sh\nshift\nexec sh -c \"$1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous string) { SSHCommand = previous }(SSHCommand)
+	SSHCommand = fakeSSH
+
+	remotePath := filepath.Join(directory, "pihole-FTL.db")
+	db := newTestDatabase(t)
+	if _, err := db.Exec("VACUUM INTO ?", remotePath); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &RemoteDatabase{Destination: "pi@pihole", Path: remotePath}
+
+	snapshot, err := remote.Snapshot(time.Minute, false)
+	if err != nil {
+		t.Fatalf("@TestRemoteDatabaseSnapshot: database.RemoteDatabase.Snapshot() failed: %s", err)
+	}
+	if err := validateSnapshot(snapshot); err != nil {
+		t.Errorf("@TestRemoteDatabaseSnapshot: database.RemoteDatabase.Snapshot() produced an invalid snapshot: %s", err)
+	}
+
+	// a fresh snapshot should be reused, even if the remote has since gone away
+	SSHCommand = filepath.Join(directory, "missing")
+	if cached, err := remote.Snapshot(time.Minute, false); err != nil || cached != snapshot {
+		t.Errorf("@TestRemoteDatabaseSnapshot: database.RemoteDatabase.Snapshot() did not reuse the cached snapshot: %v", err)
+	}
+
+	// and a refresh should always go to the remote
+	if _, err := remote.Snapshot(time.Minute, true); err == nil {
+		t.Error("@TestRemoteDatabaseSnapshot: database.RemoteDatabase.Snapshot() did not pull a new snapshot when refreshing")
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	FTL database schema versions that change the way that Pi-CLI needs to query the database.
+	https://docs.pi-hole.net/database/ftl/
+*/
+const (
+	// The network table was added, holding a row for each device seen on the network
+	SchemaVersionNetworkTable = 2
+	// Queries were moved to query_storage, with domains and clients normalised into lookup tables
+	SchemaVersionQueryStorage = 10
+	// The newest schema version that Pi-CLI has been tested against
+	LatestKnownSchemaVersion = 21
+)
+
+// Returned when a database doesn't look like a Pi-Hole FTL database at all
+var ErrNotFTLDatabase = errors.New("not a Pi-Hole FTL database (no 'ftl' table found)")
+
+// Returned when an FTL database's schema can't be used by a particular command
+type UnsupportedSchemaError struct {
+	// The schema version of the database
+	Version int
+	// Why the schema isn't supported
+	Reason string
+}
+
+func (err *UnsupportedSchemaError) Error() string {
+	return fmt.Sprintf("unsupported schema v%d: %s", err.Version, err.Reason)
+}
+
+/*
+	Describes the layout of an FTL database. The version is read from the `ftl` table, but as
+	the exact version that introduced some features varies between FTL releases, the presence of
+	tables and columns is also probed directly rather than relying on the version alone.
+*/
+type Schema struct {
+	// The schema version stored in the ftl table
+	Version int
+	// Is there a queries table (or view)?
+	HasQueries bool
+	// Are queries stored in query_storage with domain_by_id & client_by_id lookup tables?
+	HasQueryStorage bool
+	// Is there a network table?
+	HasNetwork bool
+	// Is there a network_addresses table?
+	HasNetworkAddresses bool
+	// Do host names live in network_addresses (rather than network)?
+	HasAddressNames bool
+	// Does the network table hold host names? (before they moved to network_addresses)
+	HasNetworkNames bool
+	// Does the network table hold addresses? (before they moved to network_addresses)
+	HasNetworkIPs bool
+	// Are reply times recorded for each query?
+	HasReplyTimes bool
+}
+
+// Reads the schema version from the ftl table and probes for the features that Pi-CLI uses
+func DetectSchema(db *sql.DB) (*Schema, error) {
+	if !tableExists(db, "ftl") {
+		return nil, ErrNotFTLDatabase
+	}
+
+	var rawVersion string
+	if err := db.QueryRow("SELECT value FROM ftl WHERE id = 0").Scan(&rawVersion); err != nil {
+		return nil, fmt.Errorf("unable to read the database schema version: %s", err.Error())
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(rawVersion))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the database schema version: '%s' is not a number", rawVersion)
+	}
+
+	schema := &Schema{
+		Version:             version,
+		HasQueries:          tableExists(db, "queries"),
+		HasQueryStorage:     tableExists(db, "query_storage") && tableExists(db, "domain_by_id"),
+		HasNetwork:          tableExists(db, "network"),
+		HasNetworkAddresses: tableExists(db, "network_addresses"),
+		HasAddressNames:     tableHasColumn(db, "network_addresses", "name"),
+		HasNetworkNames:     tableHasColumn(db, "network", "name"),
+		HasNetworkIPs:       tableHasColumn(db, "network", "ip"),
+		HasReplyTimes:       tableHasColumn(db, "queries", "reply_time"),
+	}
+
+	return schema, nil
+}
+
+// Returns an error if the schema doesn't contain the queries table (or view)
+func (schema *Schema) RequireQueries() error {
+	if !schema.HasQueries {
+		return schema.unsupported("no queries table found")
+	}
+	return nil
+}
+
+// Returns an error if the schema doesn't contain the network table
+func (schema *Schema) RequireNetwork() error {
+	if !schema.HasNetwork {
+		return schema.unsupported(
+			fmt.Sprintf("client data requires the network table, added in schema v%d", SchemaVersionNetworkTable))
+	}
+	return nil
+}
+
+/*
+	Returns a query selecting the host name (as "name") of each client address (as "ip") that
+	FTL has found one for. If the schema doesn't record host names, the query returns no rows
+*/
+func (schema *Schema) clientNamesQuery() string {
+	if schema.HasNetworkAddresses && schema.HasAddressNames {
+		return "SELECT ip, MAX(name) AS name FROM network_addresses WHERE name IS NOT NULL GROUP BY ip"
+	} else if schema.HasNetworkNames && schema.HasNetworkIPs {
+		return "SELECT ip, MAX(name) AS name FROM network WHERE name IS NOT NULL GROUP BY ip"
+	}
+	return "SELECT NULL AS ip, NULL AS name WHERE 0"
+}
+
+// Creates an UnsupportedSchemaError, noting if the version is newer than Pi-CLI knows about
+func (schema *Schema) unsupported(reason string) error {
+	if schema.Version > LatestKnownSchemaVersion {
+		reason += fmt.Sprintf(
+			" (this database is newer than the latest schema known to Pi-CLI, v%d)",
+			LatestKnownSchemaVersion)
+	}
+	return &UnsupportedSchemaError{Version: schema.Version, Reason: reason}
+}
+
+// Does a table or view exist in the database?
+func tableExists(db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type IN ('table', 'view') AND name = ?",
+		name).Scan(&count)
+	return err == nil && count > 0
+}
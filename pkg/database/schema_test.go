@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a throwaway database from a set of statements
+func newTestDatabase(t *testing.T, statements ...string) *sql.DB {
+	db, err := sql.Open(DBDriverName, filepath.Join(t.TempDir(), "pihole-FTL.db"))
+	if err != nil {
+		t.Fatalf("failed to create test database: %s", err)
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("failed to set up test database: %s", err)
+		}
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// Tests for database.DetectSchema()
+func TestDetectSchema(t *testing.T) {
+	if _, err := DetectSchema(newTestDatabase(t, "CREATE TABLE a (b)")); !errors.Is(err, ErrNotFTLDatabase) {
+		t.Error("@TestDetectSchema: database.DetectSchema() did not reject a database without an ftl table")
+	}
+
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 4)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+		"CREATE TABLE network (id INTEGER PRIMARY KEY, ip TEXT, hwaddr TEXT, interface TEXT, name TEXT, firstSeen INTEGER, lastQuery INTEGER, numQueries INTEGER)",
+	)
+
+	schema, err := DetectSchema(db)
+	if err != nil {
+		t.Fatalf("@TestDetectSchema: database.DetectSchema() failed: %s", err)
+	}
+	if schema.Version != 4 || !schema.HasQueries || !schema.HasNetwork || schema.HasNetworkAddresses {
+		t.Errorf("@TestDetectSchema: database.DetectSchema() detected an unexpected schema: %+v", schema)
+	}
+
+	// older schemas keep names and addresses in the network table
+	query, err := clientSummaryQuery(schema, true)
+	if err != nil {
+		t.Fatalf("@TestDetectSchema: database.clientSummaryQuery() failed: %s", err)
+	}
+	if !strings.Contains(query, "q.client = n.ip") || !strings.Contains(query, "n.name") {
+		t.Error("@TestDetectSchema: database.clientSummaryQuery() did not select the pre network_addresses variant")
+	}
+	if _, err := db.Query(query, 0, 1); err != nil {
+		t.Errorf("@TestDetectSchema: the selected client summary query failed to run: %s", err)
+	}
+}
+
+// Tests that schemas without the tables a command needs are rejected with an UnsupportedSchemaError
+func TestUnsupportedSchema(t *testing.T) {
+	db := newTestDatabase(t,
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 1)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	)
+
+	err := ClientSummary(db, nil)
+
+	var unsupported *UnsupportedSchemaError
+	if !errors.As(err, &unsupported) || unsupported.Version != 1 {
+		t.Errorf("@TestUnsupportedSchema: database.ClientSummary() returned %v, expected an unsupported schema v1 error", err)
+	}
+}
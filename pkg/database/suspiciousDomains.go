@@ -0,0 +1,308 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// The default number of suspicious domains listed for each client
+const DefaultSuspiciousDomainsPerClient = 5
+
+// A registrable domain that a client queried suspicious looking domains underneath
+type SuspiciousDomain struct {
+	// The highest scoring domain that the client queried underneath the registrable domain
+	Domain string `json:"domain"`
+	// The registrable domain (i.e. example.com for a.b.example.com)
+	RegistrableDomain string `json:"registrable_domain"`
+	// The number of unique domains that the client queried underneath the registrable domain
+	ClientSubdomains int `json:"client_subdomains"`
+	// The number of queries that the client made underneath the registrable domain
+	Queries int `json:"queries"`
+	// Unix times of the client's first and last queries underneath the registrable domain
+	FirstSeen int64 `json:"first_seen"`
+	LastSeen  int64 `json:"last_seen"`
+	// The traits that the domain was scored on, and its score
+	domains.Suspicion
+}
+
+// A client and the most suspicious domains it queried
+type SuspiciousClient struct {
+	// The client's address
+	Client string `json:"client"`
+	// The client's host name, if it is known
+	Name string `json:"name"`
+	// The client's most suspicious domains, highest scoring first
+	Domains []SuspiciousDomain `json:"domains"`
+	// The total number of suspicious registrable domains the client queried, which can be more than are listed
+	Total int `json:"total"`
+}
+
+// The result of scoring every domain queried inside of a window of time
+type SuspiciousDomainsReport struct {
+	// The score at or above which a domain is reported
+	Threshold float64 `json:"threshold"`
+	// Clients that queried suspicious domains, the client with the highest scoring domain first
+	Clients []SuspiciousClient `json:"clients"`
+	// The window of time that the report covers
+	Window *TimeWindow `json:"-"`
+}
+
+// A client's queries for the domains underneath a single registrable domain
+type registrableActivity struct {
+	queries   int
+	firstSeen int64
+	lastSeen  int64
+	domains   []string
+}
+
+/*
+	Looks for domains that are typical of DNS tunnelling and malware using domain generation
+	algorithms. Every domain queried inside of the window is scored on the entropy and length of
+	its labels, the number of unique subdomains seen underneath its registrable domain (across
+	all clients) and the rate at which the client queried that registrable domain.
+
+	Domains are grouped by client and registrable domain, as a tunnel will generate a new
+	subdomain for almost every query. The highest scoring domain of each group is reported if it
+	scores at least threshold, and up to limit groups are listed for each client.
+*/
+func SuspiciousDomains(db *sql.DB, window *TimeWindow, threshold float64, limit int) (*SuspiciousDomainsReport, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	if threshold <= 0 {
+		threshold = domains.SuspicionThreshold
+	}
+	if limit <= 0 {
+		limit = DefaultSuspiciousDomainsPerClient
+	}
+
+	since, until := window.Bounds()
+
+	names, err := clientNames(db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT client, domain, COUNT(*), MIN(timestamp), MAX(timestamp)
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		GROUP BY client, domain
+	`, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("error in database suspicious domains query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	// unique subdomains of each registrable domain, across all clients
+	subdomains := make(map[string]map[string]bool)
+	// each client's activity, keyed by client and then by registrable domain
+	activity := make(map[string]map[string]*registrableActivity)
+	// the span of time that the queries cover, which query rates are calculated over
+	var earliest, latest int64
+
+	for rows.Next() {
+		var client, domain string
+		var queries int
+		var firstSeen, lastSeen int64
+		if err := rows.Scan(&client, &domain, &queries, &firstSeen, &lastSeen); err != nil {
+			return nil, fmt.Errorf("error reading queried domain: %s", err.Error())
+		}
+
+		domain = domains.Normalise(domain)
+		registrable := domains.RegistrableDomain(domain)
+		if subdomains[registrable] == nil {
+			subdomains[registrable] = make(map[string]bool)
+		}
+		if domain != registrable {
+			subdomains[registrable][domain] = true
+		}
+
+		if activity[client] == nil {
+			activity[client] = make(map[string]*registrableActivity)
+		}
+		group := activity[client][registrable]
+		if group == nil {
+			group = &registrableActivity{firstSeen: firstSeen, lastSeen: lastSeen}
+			activity[client][registrable] = group
+		}
+		group.queries += queries
+		group.domains = append(group.domains, domain)
+		if firstSeen < group.firstSeen {
+			group.firstSeen = firstSeen
+		}
+		if lastSeen > group.lastSeen {
+			group.lastSeen = lastSeen
+		}
+
+		if earliest == 0 || firstSeen < earliest {
+			earliest = firstSeen
+		}
+		if lastSeen > latest {
+			latest = lastSeen
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading queried domains: %s", err.Error())
+	}
+
+	// rates are per hour, and anything less than an hour's worth of queries is treated as an hour
+	hours := float64(latest-earliest) / 3600
+	if hours < 1 {
+		hours = 1
+	}
+
+	report := &SuspiciousDomainsReport{Threshold: threshold, Clients: []SuspiciousClient{}, Window: window}
+	for client, groups := range activity {
+		suspiciousClient := SuspiciousClient{Client: client, Name: names.Name(client), Domains: []SuspiciousDomain{}}
+
+		for registrable, group := range groups {
+			suspicious := SuspiciousDomain{
+				RegistrableDomain: registrable,
+				ClientSubdomains:  len(group.domains),
+				Queries:           group.queries,
+				FirstSeen:         group.firstSeen,
+				LastSeen:          group.lastSeen,
+			}
+			for _, domain := range group.domains {
+				suspicion := domains.Assess(domain, len(subdomains[registrable]), float64(group.queries)/hours)
+				if suspicious.Domain == "" || suspicion.Score > suspicious.Score ||
+					(suspicion.Score == suspicious.Score && domain < suspicious.Domain) {
+					suspicious.Domain = domain
+					suspicious.Suspicion = suspicion
+				}
+			}
+			if suspicious.Score >= threshold {
+				suspiciousClient.Domains = append(suspiciousClient.Domains, suspicious)
+			}
+		}
+
+		if len(suspiciousClient.Domains) == 0 {
+			continue
+		}
+		sortSuspiciousDomains(suspiciousClient.Domains)
+		suspiciousClient.Total = len(suspiciousClient.Domains)
+		if len(suspiciousClient.Domains) > limit {
+			suspiciousClient.Domains = suspiciousClient.Domains[:limit]
+		}
+		report.Clients = append(report.Clients, suspiciousClient)
+	}
+
+	sort.Slice(report.Clients, func(i, j int) bool {
+		if report.Clients[i].Domains[0].Score != report.Clients[j].Domains[0].Score {
+			return report.Clients[i].Domains[0].Score > report.Clients[j].Domains[0].Score
+		}
+		return report.Clients[i].Client < report.Clients[j].Client
+	})
+
+	return report, nil
+}
+
+// Sorts suspicious domains by score, highest first
+func sortSuspiciousDomains(suspicious []SuspiciousDomain) {
+	sort.Slice(suspicious, func(i, j int) bool {
+		if suspicious[i].Score != suspicious[j].Score {
+			return suspicious[i].Score > suspicious[j].Score
+		}
+		return suspicious[i].RegistrableDomain < suspicious[j].RegistrableDomain
+	})
+}
+
+// Writes the report to stdout in a given format
+func (report *SuspiciousDomainsReport) Print(format OutputFormat) {
+	switch format {
+	case JSONOutput:
+		writeJSON(struct {
+			Window string `json:"window"`
+			*SuspiciousDomainsReport
+		}{
+			Window:                  report.Window.String(),
+			SuspiciousDomainsReport: report,
+		})
+	case CSVOutput:
+		var records [][]string
+		for _, client := range report.Clients {
+			for _, suspicious := range client.Domains {
+				records = append(records, []string{
+					client.Client,
+					client.Name,
+					suspicious.Domain,
+					suspicious.RegistrableDomain,
+					strconv.FormatFloat(suspicious.Score, 'f', 1, 64),
+					strconv.FormatFloat(suspicious.Entropy, 'f', 2, 64),
+					strconv.Itoa(suspicious.LongestLabel),
+					strconv.Itoa(suspicious.Subdomains),
+					strconv.Itoa(suspicious.ClientSubdomains),
+					strconv.Itoa(suspicious.Queries),
+					strconv.FormatFloat(suspicious.QueriesPerHour, 'f', 2, 64),
+					strconv.FormatInt(suspicious.FirstSeen, 10),
+					strconv.FormatInt(suspicious.LastSeen, 10),
+				})
+			}
+		}
+		writeCSV([]string{
+			"client", "name", "domain", "registrable_domain", "score", "entropy", "longest_label",
+			"subdomains", "client_subdomains", "queries", "queries_per_hour", "first_seen", "last_seen",
+		}, records)
+	default:
+		report.printTables()
+	}
+}
+
+// Renders the report as a table for each client
+func (report *SuspiciousDomainsReport) printTables() {
+	localisedNumberWriter := message.NewPrinter(language.English)
+
+	color.Yellow("Window: %s", report.Window)
+	color.Yellow("Threshold: a score of %.0f out of 100", report.Threshold)
+
+	if len(report.Clients) == 0 {
+		fmt.Println()
+		color.Green("No suspicious domains found")
+		return
+	}
+
+	for _, client := range report.Clients {
+		fmt.Println()
+		if client.Name != "" {
+			color.Cyan("%s (%s)", client.Client, client.Name)
+		} else {
+			color.Cyan(client.Client)
+		}
+
+		var records [][]string
+		for _, suspicious := range client.Domains {
+			records = append(records, []string{
+				suspicious.Domain,
+				strconv.FormatFloat(suspicious.Score, 'f', 1, 64),
+				strconv.FormatFloat(suspicious.Entropy, 'f', 2, 64),
+				strconv.Itoa(suspicious.LongestLabel),
+				localisedNumberWriter.Sprintf("%d", suspicious.Subdomains),
+				localisedNumberWriter.Sprintf("%d", suspicious.Queries),
+				localisedNumberWriter.Sprintf("%.1f", suspicious.QueriesPerHour),
+				FormattedDBUnixTimestamp(int(suspicious.LastSeen)),
+			})
+		}
+		printRecordsTable(
+			[]string{"Domain", "Score", "Entropy", "Longest label", "Subdomains", "Queries", "Queries/hr", "Last seen"},
+			records)
+
+		if client.Total > len(client.Domains) {
+			color.Yellow(
+				"%d more not shown (use --limit to show more)",
+				client.Total-len(client.Domains))
+		}
+	}
+}
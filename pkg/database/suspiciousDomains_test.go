@@ -0,0 +1,65 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Tests for database.SuspiciousDomains()
+func TestSuspiciousDomains(t *testing.T) {
+	statements := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 9)",
+		"CREATE TABLE queries (id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT)",
+	}
+	insert := func(timestamp int, domain string, client string) {
+		statements = append(statements, fmt.Sprintf(
+			"INSERT INTO queries (timestamp, type, status, domain, client) VALUES (%d, 16, 2, '%s', '%s')",
+			timestamp, domain, client))
+	}
+
+	// random looking 24 character labels, as a tunnel would use to send data out
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	seed := 1
+	randomLabel := func() string {
+		label := make([]byte, 24)
+		for i := range label {
+			seed = (seed*1103515245 + 12345) % 2147483648
+			label[i] = alphabet[(seed/65536)%len(alphabet)]
+		}
+		return string(label)
+	}
+
+	// an hour of tunnelling alongside normal browsing
+	for i := 0; i < 200; i++ {
+		insert(1000+i*18, randomLabel()+".t.evil.io", "10.0.0.1")
+		insert(1000+i*18, "www.example.com", "10.0.0.1")
+		insert(1000+i*18, "www.example.com", "10.0.0.2")
+	}
+	insert(1000, "mail.example.co.uk", "10.0.0.2")
+
+	report, err := SuspiciousDomains(newTestDatabase(t, statements...), nil, 0, 0)
+	if err != nil {
+		t.Fatalf("@TestSuspiciousDomains: database.SuspiciousDomains() failed: %s", err)
+	}
+
+	if len(report.Clients) != 1 || report.Clients[0].Client != "10.0.0.1" {
+		t.Fatalf("@TestSuspiciousDomains: expected only 10.0.0.1 to have suspicious domains, got %+v", report.Clients)
+	}
+	suspicious := report.Clients[0].Domains
+	if len(suspicious) != 1 || suspicious[0].RegistrableDomain != "evil.io" || report.Clients[0].Total != 1 {
+		t.Fatalf("@TestSuspiciousDomains: expected only evil.io to be suspicious, got %+v", suspicious)
+	}
+	if suspicious[0].Subdomains != 200 || suspicious[0].ClientSubdomains != 200 || suspicious[0].Queries != 200 {
+		t.Errorf("@TestSuspiciousDomains: unexpected counts for evil.io %+v", suspicious[0])
+	}
+	if suspicious[0].Score < report.Threshold || suspicious[0].LongestLabel != 24 {
+		t.Errorf("@TestSuspiciousDomains: unexpected score for evil.io %+v", suspicious[0])
+	}
+
+	// nothing scores 100, so nothing is listed with the highest possible threshold
+	report, err = SuspiciousDomains(newTestDatabase(t, statements...), nil, 100, 0)
+	if err != nil || len(report.Clients) != 0 {
+		t.Errorf("@TestSuspiciousDomains: expected no clients with a threshold of 100, got %+v (%v)", report, err)
+	}
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	The location that timestamps are both parsed in and outputted in. Defaults to the
+	system's local timezone, but can be changed by the user (i.e. when analysing a database
+	pulled from a Pi-Hole in a different timezone)
+*/
+var OutputLocation = time.Local
+
+/*
+	Layouts accepted when parsing absolute times given by the user. These are tried in order,
+	and are parsed in the OutputLocation timezone unless the layout itself carries an offset
+*/
+var timeArgumentLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+/*
+	Relative duration units supported on top of the ones understood by time.ParseDuration.
+	Note that 'm' is always minutes, there is no month unit as months vary in length.
+*/
+var relativeDurationUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': time.Hour * 24,
+	'w': time.Hour * 24 * 7,
+}
+
+/*
+	A window of time that database queries can be constrained to using the `timestamp`
+	column. Either bound can be left as the zero time.Time, denoting that side of the window
+	as unbounded. A nil *TimeWindow is valid and is equivalent to a fully unbounded window.
+*/
+type TimeWindow struct {
+	// The start of the window (inclusive)
+	Since time.Time
+	// The end of the window (inclusive)
+	Until time.Time
+}
+
+/*
+	Creates a new TimeWindow from the raw values of the --since, --until and --last flags.
+	Any of them can be empty. --last is shorthand for "--since <duration> ago" and as such
+	cannot be combined with --since.
+*/
+func NewTimeWindow(since string, until string, last string, now time.Time) (*TimeWindow, error) {
+	window := &TimeWindow{}
+
+	if last != "" && since != "" {
+		return nil, errors.New("--last and --since cannot be used together")
+	}
+
+	if last != "" {
+		duration, err := ParseRelativeDuration(last)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --last value: %s", err.Error())
+		}
+		window.Since = now.Add(-duration)
+	}
+
+	if since != "" {
+		parsed, err := ParseTimeArgument(since, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --since value: %s", err.Error())
+		}
+		window.Since = parsed
+	}
+
+	if until != "" {
+		parsed, err := ParseTimeArgument(until, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --until value: %s", err.Error())
+		}
+		window.Until = parsed
+	}
+
+	if !window.Since.IsZero() && !window.Until.IsZero() && window.Since.After(window.Until) {
+		return nil, errors.New("the start of the time window is after its end")
+	}
+
+	return window, nil
+}
+
+/*
+	Parses a relative duration such as "90s", "15m", "12h", "7d", "2w" or a combination
+	of them like "1d12h". Anything understood by time.ParseDuration is also accepted.
+*/
+func ParseRelativeDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration < 0 {
+			return 0, fmt.Errorf("'%s' is negative", value)
+		}
+		return duration, nil
+	}
+
+	var total time.Duration
+	remaining := value
+	for len(remaining) > 0 {
+		// consume the leading number
+		end := 0
+		for end < len(remaining) && (remaining[end] >= '0' && remaining[end] <= '9' || remaining[end] == '.') {
+			end++
+		}
+		if end == 0 || end == len(remaining) {
+			return 0, fmt.Errorf("'%s' is not a valid duration (e.g. 30m, 12h, 7d, 2w)", value)
+		}
+
+		amount, err := strconv.ParseFloat(remaining[:end], 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid duration (e.g. 30m, 12h, 7d, 2w)", value)
+		}
+
+		// and then its unit
+		unit, ok := relativeDurationUnits[remaining[end]]
+		if !ok {
+			return 0, fmt.Errorf("unknown unit '%c' in duration '%s'", remaining[end], value)
+		}
+
+		total += time.Duration(amount * float64(unit))
+		remaining = remaining[end+1:]
+	}
+
+	return total, nil
+}
+
+/*
+	Parses a point in time given by the user. This can either be:
+		- a relative duration, which is taken to mean that long before now (e.g. "7d")
+		- the word "now"
+		- a Unix timestamp (e.g. "1612548060")
+		- an absolute date or date & time (e.g. "2021-02-05", "2021-02-05 18:01", RFC3339)
+*/
+func ParseTimeArgument(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.EqualFold(value, "now") {
+		return now, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).In(OutputLocation), nil
+	}
+
+	if duration, err := ParseRelativeDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	for _, layout := range timeArgumentLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, OutputLocation); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf(
+		"'%s' is not a recognised time. Use a duration (7d), a date (2006-01-02) or a date & time (2006-01-02 15:04)",
+		value)
+}
+
+/*
+	Sets the location used for parsing and outputting timestamps. An empty name leaves
+	the current location unchanged.
+*/
+func SetOutputLocation(name string) error {
+	if name == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown timezone '%s'", name)
+	}
+	OutputLocation = location
+	return nil
+}
+
+/*
+	Returns the Unix time bounds of the window, ready to be plugged into an SQL query
+	in the form "timestamp BETWEEN ? AND ?". Unbounded sides are widened to cover every
+	possible row.
+*/
+func (window *TimeWindow) Bounds() (int64, int64) {
+	var since int64 = 0
+	var until int64 = math.MaxInt64
+
+	if window == nil {
+		return since, until
+	}
+	if !window.Since.IsZero() {
+		since = window.Since.Unix()
+	}
+	if !window.Until.IsZero() {
+		until = window.Until.Unix()
+	}
+	return since, until
+}
+
+// Is the window unbounded on both sides? I.e., will it match every row?
+func (window *TimeWindow) IsUnbounded() bool {
+	return window == nil || (window.Since.IsZero() && window.Until.IsZero())
+}
+
+// Returns a human readable version of the window, using the OutputLocation timezone
+func (window *TimeWindow) String() string {
+	if window.IsUnbounded() {
+		return "all time"
+	}
+
+	since := "beginning of database"
+	until := "now"
+	if !window.Since.IsZero() {
+		since = FormattedDBUnixTimestamp(int(window.Since.Unix()))
+	}
+	if !window.Until.IsZero() {
+		until = FormattedDBUnixTimestamp(int(window.Until.Unix()))
+	}
+	return fmt.Sprintf("%s -> %s", since, until)
+}
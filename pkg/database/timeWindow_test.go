@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests for database.ParseRelativeDuration()
+func TestParseRelativeDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"90s":   time.Second * 90,
+		"15m":   time.Minute * 15,
+		"12h":   time.Hour * 12,
+		"7d":    time.Hour * 24 * 7,
+		"2w":    time.Hour * 24 * 14,
+		"1d12h": time.Hour * 36,
+		"1.5h":  time.Minute * 90,
+	}
+	for input, expected := range valid {
+		duration, err := ParseRelativeDuration(input)
+		if err != nil {
+			t.Errorf("@TestParseRelativeDuration: database.ParseRelativeDuration() failed to parse '%s': %s", input, err)
+		}
+		if duration != expected {
+			t.Errorf("@TestParseRelativeDuration: database.ParseRelativeDuration() parsed '%s' as %s, expected %s", input, duration, expected)
+		}
+	}
+
+	for _, input := range []string{"", "7", "d", "7y", "-7d", "seven days"} {
+		if _, err := ParseRelativeDuration(input); err == nil {
+			t.Errorf("@TestParseRelativeDuration: database.ParseRelativeDuration() accepted invalid duration '%s'", input)
+		}
+	}
+}
+
+// Tests for database.NewTimeWindow()
+func TestNewTimeWindow(t *testing.T) {
+	OutputLocation = time.UTC
+	now := time.Date(2021, 2, 12, 18, 0, 0, 0, time.UTC)
+
+	window, err := NewTimeWindow("", "", "7d", now)
+	if err != nil {
+		t.Errorf("@TestNewTimeWindow: database.NewTimeWindow() failed with --last: %s", err)
+	}
+	if !window.Since.Equal(now.Add(-time.Hour*24*7)) || !window.Until.IsZero() {
+		t.Error("@TestNewTimeWindow: database.NewTimeWindow() did not produce the expected window for --last 7d")
+	}
+
+	window, err = NewTimeWindow("2021-02-05", "2021-02-05 18:01", "", now)
+	if err != nil {
+		t.Errorf("@TestNewTimeWindow: database.NewTimeWindow() failed with --since and --until: %s", err)
+	}
+	since, until := window.Bounds()
+	if since != 1612483200 || until != 1612548060 {
+		t.Errorf("@TestNewTimeWindow: database.NewTimeWindow() produced unexpected bounds %d -> %d", since, until)
+	}
+
+	if _, err := NewTimeWindow("1d", "", "7d", now); err == nil {
+		t.Error("@TestNewTimeWindow: database.NewTimeWindow() accepted both --since and --last")
+	}
+
+	if _, err := NewTimeWindow("1d", "7d", "", now); err == nil {
+		t.Error("@TestNewTimeWindow: database.NewTimeWindow() accepted a window that ends before it starts")
+	}
+
+	var unbounded *TimeWindow
+	if !unbounded.IsUnbounded() {
+		t.Error("@TestNewTimeWindow: a nil *TimeWindow should be unbounded")
+	}
+}
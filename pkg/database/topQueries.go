@@ -3,10 +3,10 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
 	"github.com/fatih/color"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
-	"log"
 	"math"
 )
 
@@ -19,16 +19,28 @@ import (
 	those belonging to a certain domain, or those that contain a certain word.
 
 	This query is also parameterised on a limit, the user can choose how many top queries
-	they want returned (i.e. top 10, top 20 etc...).
+	they want returned (i.e. top 10, top 20 etc...), and on a time window that constrains
+	which queries are counted.
+
+	Domains can also be grouped, i.e. rolled up to their registrable domain so that
+	a.cdn.example.com and b.cdn.example.com are counted together as example.com. The limit
+	then applies to the number of groups.
 
 	This database dump includes:
 		- The domain
 		- The number of queries that have been sent for that domain
 		- A total sum of all of the occurrences
 */
-func TopQueries(db *sql.DB, limit int64, domainFilter string) {
+func TopQueries(db *sql.DB, limit int64, domainFilter string, window *TimeWindow, grouping domains.Grouping) error {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return err
+	}
+
 	var rows *sql.Rows
-	var err error
 
 	/*
 		If any <0 integer is given, default to the max int64 value to essentially remove the limit.
@@ -44,66 +56,84 @@ func TopQueries(db *sql.DB, limit int64, domainFilter string) {
 		color.Yellow("Limit: %d", limit)
 	}
 
-	color.Yellow("Filter: '%s' \n\n", domainFilter)
+	color.Yellow("Filter: '%s'", domainFilter)
+	grouped := grouping == domains.RegistrableDomainGrouping
+	if grouped {
+		color.Yellow("Grouping: registrable domain (eTLD+1)")
+	}
+	color.Yellow("Window: %s \n\n", window)
+
+	since, until := window.Bounds()
+
+	// when grouping, every domain is needed as the limit applies to the groups
+	queryLimit := limit
+	if grouped {
+		queryLimit = math.MaxInt64
+	}
 
 	// if filter has been provided, we want to plug it into the SQL query
 	if domainFilter == "" {
-		rows, err = db.Query(`
-		SELECT domain, COUNT(domain)
-		FROM queries
-		GROUP BY domain
-		ORDER BY COUNT(domain) DESC
-		LIMIT ?
-	`, limit)
+		rows, err = db.Query(topQueriesQuery(schema, false), since, until, queryLimit)
 	} else {
 		sqlFilter := "%" + domainFilter + "%"
-
-		rows, err = db.Query(`
-		SELECT domain, COUNT(domain)
-		FROM queries
-		WHERE queries.domain LIKE ?
-		GROUP BY domain
-		ORDER BY COUNT(domain) DESC
-		LIMIT ?
-	`, sqlFilter, limit)
+		rows, err = db.Query(topQueriesQuery(schema, true), since, until, sqlFilter, queryLimit)
 	}
 
 	if err != nil {
-		log.Fatalf("Error in database top queries query: %s", err.Error())
+		return fmt.Errorf("error in database top queries query (schema v%d): %s", schema.Version, err.Error())
 	}
+	defer rows.Close()
 
-	var domain string
-	var occurrence int
+	var counts []domains.DomainCount
+	for rows.Next() {
+		var count domains.DomainCount
+		_ = rows.Scan(&count.Domain, &count.Count)
+		counts = append(counts, count)
+	}
+
+	groups := grouping.Group(counts)
+	if int64(len(groups)) > limit {
+		groups = groups[:limit]
+	}
 
 	var occurrenceSum uint64
 
 	tabWriter := NewConfiguredTabWriter(1)
 	localisedNumberWriter := message.NewPrinter(language.English)
 
+	// grouped domains have an extra column, for the number of domains in each group
+	header := []interface{}{"#\t", "Domain\t", "Occurrences\t"}
+	separator := []interface{}{"\t", "\t", "\t"}
+	if grouped {
+		header = append(header, "Domains\t")
+		separator = append(separator, "\t")
+	}
+
 	// insert column headers
-	_, _ = fmt.Fprintln(tabWriter, "#\t", "Domain\t", "Occurrences\t")
+	_, _ = fmt.Fprintln(tabWriter, header...)
 	// insert blank line separator
-	_, _ = fmt.Fprintln(tabWriter, "\t", "\t", "\t")
+	_, _ = fmt.Fprintln(tabWriter, separator...)
 
 	// used to count the rows as they're outputted
 	var row int64 = 1
 
-	for rows.Next() {
-		_ = rows.Scan(&domain, &occurrence)
-
-		occurrenceSum = occurrenceSum + uint64(occurrence)
+	for _, group := range groups {
+		occurrenceSum = occurrenceSum + uint64(group.Count)
 
-		_, _ = fmt.Fprintln(
-			tabWriter,
+		columns := []interface{}{
 			fmt.Sprintf("%d\t", row),
-			fmt.Sprintf("%s\t", domain),
-			localisedNumberWriter.Sprintf("%d\t", occurrence),
-		)
+			fmt.Sprintf("%s\t", group.Domain),
+			localisedNumberWriter.Sprintf("%d\t", group.Count),
+		}
+		if grouped {
+			columns = append(columns, localisedNumberWriter.Sprintf("%d\t", len(group.Members)))
+		}
+		_, _ = fmt.Fprintln(tabWriter, columns...)
 		row++
 	}
 
 	// insert blank line separator
-	_, _ = fmt.Fprintln(tabWriter, "\t", "\t", "\t")
+	_, _ = fmt.Fprintln(tabWriter, separator...)
 	// insert column headers
 	_, _ = fmt.Fprintln(tabWriter, "\t", "\t", "Total\t")
 
@@ -119,7 +149,46 @@ func TopQueries(db *sql.DB, limit int64, domainFilter string) {
 		color.Red("0 results in database")
 	}
 
-	if err := tabWriter.Flush(); err != nil {
-		return
+	return tabWriter.Flush()
+}
+
+/*
+	Selects the top queries query to use for a given schema. Newer databases store queries in
+	query_storage, with domains normalised into domain_by_id. The queries view resolves each
+	domain individually, so grouping on the domain ID and resolving it afterwards is much
+	faster on large databases.
+
+	The query takes the since and until bounds, the filter (if filtered) and the limit as arguments.
+*/
+func topQueriesQuery(schema *Schema, filtered bool) string {
+	if schema.Version >= SchemaVersionQueryStorage && schema.HasQueryStorage {
+		filter := ""
+		if filtered {
+			filter = "AND d.domain LIKE ?"
+		}
+		return fmt.Sprintf(`
+		SELECT d.domain, COUNT(*)
+		FROM query_storage q
+		INNER JOIN domain_by_id d ON d.id = q.domain
+		WHERE q.timestamp BETWEEN ? AND ?
+		%s
+		GROUP BY q.domain
+		ORDER BY COUNT(*) DESC
+		LIMIT ?
+	`, filter)
+	}
+
+	filter := ""
+	if filtered {
+		filter = "AND queries.domain LIKE ?"
 	}
+	return fmt.Sprintf(`
+		SELECT domain, COUNT(domain)
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		%s
+		GROUP BY domain
+		ORDER BY COUNT(domain) DESC
+		LIMIT ?
+	`, filter)
 }
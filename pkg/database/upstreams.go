@@ -0,0 +1,241 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Performance statistics for a single upstream DNS resolver
+type UpstreamStats struct {
+	// The upstream's address, as stored by FTL (e.g. "1.1.1.1#53")
+	Upstream string `json:"upstream"`
+	// The number of queries forwarded to this upstream
+	Queries int `json:"queries"`
+	// The percentage of all forwarded queries that went to this upstream
+	Share float64 `json:"share"`
+	// The number of queries that have a recorded reply time
+	ReplyTimes int `json:"reply_times"`
+	// Median reply time in milliseconds
+	P50 float64 `json:"p50_ms"`
+	// 95th percentile reply time in milliseconds
+	P95 float64 `json:"p95_ms"`
+	// 99th percentile reply time in milliseconds
+	P99 float64 `json:"p99_ms"`
+}
+
+// Statistics for all upstreams seen inside of a window of time
+type UpstreamReport struct {
+	// Per upstream statistics, busiest first
+	Upstreams []UpstreamStats
+	// Total number of forwarded queries inside of the window
+	TotalForwarded int
+	// Does the database record reply times? (older FTL versions do not)
+	HasReplyTimes bool
+	// The window of time that the report covers
+	Window *TimeWindow
+}
+
+/*
+	Builds a report on each of the upstream resolvers that queries have been forwarded to,
+	including their share of the forwarded traffic and the distribution of their reply times.
+
+	Percentiles are calculated here rather than in SQL as SQLite does not provide percentile
+	functions. Reply times are streamed one upstream at a time, so memory usage is bound by the
+	busiest upstream rather than by the size of the database.
+*/
+func Upstreams(db *sql.DB, window *TimeWindow) (*UpstreamReport, error) {
+	schema, err := DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	since, until := window.Bounds()
+
+	report := &UpstreamReport{
+		Window:        window,
+		HasReplyTimes: schema.HasReplyTimes,
+	}
+
+	replyTimeColumn := "NULL"
+	if report.HasReplyTimes {
+		replyTimeColumn = "reply_time"
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT forward, %s
+		FROM queries
+		WHERE timestamp BETWEEN ? AND ?
+		AND forward IS NOT NULL AND forward != ''
+		ORDER BY forward, 2
+	`, replyTimeColumn), since, until)
+
+	if err != nil {
+		return nil, fmt.Errorf("error in database upstreams query (schema v%d): %s", schema.Version, err.Error())
+	}
+	defer rows.Close()
+
+	var forward string
+	var replyTime sql.NullFloat64
+
+	var current *UpstreamStats
+	var replyTimes []float64
+
+	// finish off the stats for the upstream currently being read
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.ReplyTimes = len(replyTimes)
+		if current.ReplyTimes > 0 {
+			current.P50 = percentile(replyTimes, 50) * 1000
+			current.P95 = percentile(replyTimes, 95) * 1000
+			current.P99 = percentile(replyTimes, 99) * 1000
+		}
+		report.Upstreams = append(report.Upstreams, *current)
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(&forward, &replyTime); err != nil {
+			return nil, fmt.Errorf("error reading upstream reply time: %s", err.Error())
+		}
+
+		if current == nil || current.Upstream != forward {
+			flush()
+			current = &UpstreamStats{Upstream: forward}
+			replyTimes = replyTimes[:0]
+		}
+
+		current.Queries++
+		report.TotalForwarded++
+		if replyTime.Valid {
+			replyTimes = append(replyTimes, replyTime.Float64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading upstream reply times: %s", err.Error())
+	}
+	flush()
+
+	for i := range report.Upstreams {
+		report.Upstreams[i].Share = float64(report.Upstreams[i].Queries) / float64(report.TotalForwarded) * 100
+	}
+
+	// busiest upstreams first
+	sort.SliceStable(report.Upstreams, func(i, j int) bool {
+		return report.Upstreams[i].Queries > report.Upstreams[j].Queries
+	})
+
+	return report, nil
+}
+
+// Writes the report to stdout in a given format
+func (report *UpstreamReport) Print(format OutputFormat) {
+	switch format {
+	case JSONOutput:
+		writeJSON(struct {
+			Window         string          `json:"window"`
+			TotalForwarded int             `json:"total_forwarded"`
+			HasReplyTimes  bool            `json:"has_reply_times"`
+			Upstreams      []UpstreamStats `json:"upstreams"`
+		}{
+			Window:         report.Window.String(),
+			TotalForwarded: report.TotalForwarded,
+			HasReplyTimes:  report.HasReplyTimes,
+			Upstreams:      report.Upstreams,
+		})
+	case CSVOutput:
+		var records [][]string
+		for _, upstream := range report.Upstreams {
+			records = append(records, []string{
+				upstream.Upstream,
+				strconv.Itoa(upstream.Queries),
+				strconv.FormatFloat(upstream.Share, 'f', 2, 64),
+				formattedReplyTime(upstream, upstream.P50),
+				formattedReplyTime(upstream, upstream.P95),
+				formattedReplyTime(upstream, upstream.P99),
+			})
+		}
+		writeCSV([]string{"upstream", "queries", "share", "p50_ms", "p95_ms", "p99_ms"}, records)
+	default:
+		report.printTable()
+	}
+}
+
+// Renders the report as a table
+func (report *UpstreamReport) printTable() {
+	color.Yellow("Window: %s \n\n", report.Window)
+
+	tabWriter := NewConfiguredTabWriter(1)
+	localisedNumberWriter := message.NewPrinter(language.English)
+
+	// insert column headers
+	_, _ = fmt.Fprintln(
+		tabWriter,
+		"#\t",
+		"Upstream\t",
+		"Queries\t",
+		"Share\t",
+		"p50 (ms)\t",
+		"p95 (ms)\t",
+		"p99 (ms)\t")
+
+	// insert blank line separator
+	_, _ = fmt.Fprintln(tabWriter, "\t", "\t", "\t", "\t", "\t", "\t", "\t")
+
+	for i, upstream := range report.Upstreams {
+		_, _ = fmt.Fprintln(
+			tabWriter,
+			fmt.Sprintf("%d\t", i+1),
+			fmt.Sprintf("%s\t", upstream.Upstream),
+			localisedNumberWriter.Sprintf("%d\t", upstream.Queries),
+			fmt.Sprintf("%.2f%%\t", upstream.Share),
+			fmt.Sprintf("%s\t", formattedReplyTime(upstream, upstream.P50)),
+			fmt.Sprintf("%s\t", formattedReplyTime(upstream, upstream.P95)),
+			fmt.Sprintf("%s\t", formattedReplyTime(upstream, upstream.P99)))
+	}
+
+	if len(report.Upstreams) == 0 {
+		color.Red("0 results in database")
+	}
+
+	if err := tabWriter.Flush(); err != nil {
+		return
+	}
+
+	if !report.HasReplyTimes {
+		color.Yellow("\nThis database does not record reply times, update FTL to see reply time percentiles")
+	}
+}
+
+// Formats a reply time for display, or returns a placeholder if no reply times were recorded
+func formattedReplyTime(upstream UpstreamStats, ms float64) string {
+	if upstream.ReplyTimes == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(ms, 'f', 2, 64)
+}
+
+/*
+	Returns the given percentile of an already sorted slice of values using the nearest rank
+	method. Returns zero if the slice is empty.
+*/
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
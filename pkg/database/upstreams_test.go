@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Tests for database.percentile()
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	expected := map[float64]float64{
+		0:   1,
+		50:  5,
+		95:  10,
+		99:  10,
+		100: 10,
+	}
+	for p, value := range expected {
+		if result := percentile(sorted, p); result != value {
+			t.Errorf("@TestPercentile: database.percentile() returned %f for p%.0f, expected %f", result, p, value)
+		}
+	}
+
+	if percentile([]float64{}, 50) != 0 {
+		t.Error("@TestPercentile: database.percentile() should return zero for an empty slice")
+	}
+}
+
+/*
+Creates a database with 20 queries forwarded to 8.8.8.8 (replying in 1ms to 20ms), 6 to
+1.1.1.1 (replying in 10ms to 50ms, and once with no reply time), a blocked query and a
+forwarded query from well before the others. Without reply times, the reply_time column
+is left out of the queries table altogether, as it is in older FTL databases.
+*/
+func newTestUpstreamsDatabase(t *testing.T, withReplyTimes bool) *sql.DB {
+	columns := "id INTEGER PRIMARY KEY, timestamp INTEGER, type INTEGER, status INTEGER, domain TEXT, client TEXT, forward TEXT"
+	if withReplyTimes {
+		columns += ", reply_time REAL"
+	}
+	statements := []string{
+		"CREATE TABLE ftl (id INTEGER PRIMARY KEY NOT NULL, value BLOB NOT NULL)",
+		"INSERT INTO ftl VALUES (0, 10)",
+		fmt.Sprintf("CREATE TABLE queries (%s)", columns),
+	}
+
+	insert := func(timestamp int, status int, forward string, replyTime string) {
+		statement := fmt.Sprintf(
+			"INSERT INTO queries VALUES (NULL, %d, 1, %d, 'example.com', '192.168.1.10', %s", timestamp, status, forward)
+		if withReplyTimes {
+			statement += ", " + replyTime
+		}
+		statements = append(statements, statement+")")
+	}
+	for i := 1; i <= 20; i++ {
+		insert(1700000000+i, 2, "'8.8.8.8#53'", fmt.Sprintf("%f", float64(i)/1000))
+	}
+	for i := 1; i <= 5; i++ {
+		insert(1700000100+i, 2, "'1.1.1.1#53'", fmt.Sprintf("%f", float64(i*10)/1000))
+	}
+	insert(1700000200, 2, "'1.1.1.1#53'", "NULL")
+	insert(1700000300, 1, "NULL", "NULL")
+	insert(1600000000, 2, "'9.9.9.9#53'", "0.5")
+
+	return newTestDatabase(t, statements...)
+}
+
+// Tests for database.Upstreams()
+func TestUpstreams(t *testing.T) {
+	OutputLocation = time.UTC
+	window, err := NewTimeWindow("2023-11-14", "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Upstreams(newTestUpstreamsDatabase(t, true), window)
+	if err != nil {
+		t.Fatalf("@TestUpstreams: database.Upstreams() failed: %s", err)
+	}
+	if !report.HasReplyTimes || report.TotalForwarded != 26 || len(report.Upstreams) != 2 {
+		t.Fatalf("@TestUpstreams: unexpected report %+v", report)
+	}
+
+	expected := []UpstreamStats{
+		{Upstream: "8.8.8.8#53", Queries: 20, Share: 20.0 / 26 * 100, ReplyTimes: 20, P50: 10, P95: 19, P99: 20},
+		{Upstream: "1.1.1.1#53", Queries: 6, Share: 6.0 / 26 * 100, ReplyTimes: 5, P50: 30, P95: 50, P99: 50},
+	}
+	for i, upstream := range report.Upstreams {
+		want := expected[i]
+		if upstream.Upstream != want.Upstream ||
+			upstream.Queries != want.Queries ||
+			upstream.ReplyTimes != want.ReplyTimes ||
+			math.Abs(upstream.Share-want.Share) > 1e-9 ||
+			math.Abs(upstream.P50-want.P50) > 1e-9 ||
+			math.Abs(upstream.P95-want.P95) > 1e-9 ||
+			math.Abs(upstream.P99-want.P99) > 1e-9 {
+			t.Errorf("@TestUpstreams: got %+v, expected %+v", upstream, want)
+		}
+	}
+
+	// the older query is only included once the window reaches back to it
+	everything, _ := NewTimeWindow("", "", "", time.Now())
+	if report, err := Upstreams(newTestUpstreamsDatabase(t, true), everything); err != nil || report.TotalForwarded != 27 {
+		t.Errorf("@TestUpstreams: an unbounded window gave %+v (%v)", report, err)
+	}
+}
+
+// Tests for database.Upstreams() with a database that doesn't record reply times
+func TestUpstreamsWithoutReplyTimes(t *testing.T) {
+	OutputLocation = time.UTC
+	window, err := NewTimeWindow("2023-11-14", "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Upstreams(newTestUpstreamsDatabase(t, false), window)
+	if err != nil {
+		t.Fatalf("@TestUpstreamsWithoutReplyTimes: database.Upstreams() failed: %s", err)
+	}
+	if report.HasReplyTimes || report.TotalForwarded != 26 || len(report.Upstreams) != 2 {
+		t.Fatalf("@TestUpstreamsWithoutReplyTimes: unexpected report %+v", report)
+	}
+	for _, upstream := range report.Upstreams {
+		if upstream.ReplyTimes != 0 || upstream.P50 != 0 || upstream.P95 != 0 || upstream.P99 != 0 {
+			t.Errorf("@TestUpstreamsWithoutReplyTimes: %s has reply times %+v", upstream.Upstream, upstream)
+		}
+	}
+	if report.Upstreams[0].Queries != 20 || report.Upstreams[1].Queries != 6 {
+		t.Errorf("@TestUpstreamsWithoutReplyTimes: unexpected query counts %+v", report.Upstreams)
+	}
+}
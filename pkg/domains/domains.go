@@ -0,0 +1,40 @@
+package domains
+
+import (
+	"strings"
+)
+
+// Normalises a domain for comparison, lower casing it and removing any trailing dot
+func Normalise(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+/*
+	Returns the registrable part of a domain, i.e. the part that an organisation registers and
+	controls everything beneath (example.com for www.example.com, example.co.uk for
+	mail.example.co.uk), also known as eTLD+1. Domains that are already registrable, or that are
+	themselves a public suffix, are returned as they are.
+*/
+func RegistrableDomain(domain string) string {
+	domain = Normalise(domain)
+	suffix := PublicSuffix(domain)
+	if domain == suffix || !strings.HasSuffix(domain, "."+suffix) {
+		return domain
+	}
+
+	labels := strings.Split(strings.TrimSuffix(domain, "."+suffix), ".")
+	return labels[len(labels)-1] + "." + suffix
+}
+
+/*
+	Returns the labels of a domain that sit underneath its registrable domain, i.e. [mail eu]
+	for mail.eu.example.com. Domains that are registrable have no subdomain labels.
+*/
+func SubdomainLabels(domain string) []string {
+	domain = Normalise(domain)
+	registrable := RegistrableDomain(domain)
+	if domain == registrable {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(domain, "."+registrable), ".")
+}
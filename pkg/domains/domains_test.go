@@ -0,0 +1,73 @@
+package domains
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests for domains.RegistrableDomain()
+func TestRegistrableDomain(t *testing.T) {
+	expected := map[string]string{
+		"www.example.com":         "example.com",
+		"a.b.c.example.com":       "example.com",
+		"example.com":             "example.com",
+		"Mail.Example.co.uk.":     "example.co.uk",
+		"example.co.uk":           "example.co.uk",
+		"co.uk":                   "co.uk",
+		"www.example.co":          "example.co",
+		"localhost":               "localhost",
+		"x7kq2p9.tunnel.evil.io":  "evil.io",
+		"user.github.io":          "user.github.io",
+		"a.b.example.ck":          "b.example.ck",
+		"a.www.ck":                "www.ck",
+		"a.example.xn--55qx5d.cn": "example.xn--55qx5d.cn",
+		"host.unknowntld":         "host.unknowntld",
+	}
+	for domain, registrable := range expected {
+		if result := RegistrableDomain(domain); result != registrable {
+			t.Errorf("@TestRegistrableDomain: domains.RegistrableDomain(%q) returned %q, expected %q", domain, result, registrable)
+		}
+	}
+}
+
+// Tests for domains.SubdomainLabels()
+func TestSubdomainLabels(t *testing.T) {
+	if labels := SubdomainLabels("mail.eu.example.com"); !reflect.DeepEqual(labels, []string{"mail", "eu"}) {
+		t.Errorf("@TestSubdomainLabels: unexpected labels %v", labels)
+	}
+	if labels := SubdomainLabels("example.com"); labels != nil {
+		t.Errorf("@TestSubdomainLabels: expected no labels for a registrable domain, got %v", labels)
+	}
+}
+
+// Tests for domains.PublicSuffix()
+func TestPublicSuffix(t *testing.T) {
+	expected := map[string]string{
+		"www.example.com":    "com",
+		"mail.example.co.uk": "co.uk",
+		"a.b.example.ck":     "example.ck",
+		"a.www.ck":           "ck",
+		"printer.unknowntld": "unknowntld",
+		"pi.hole":            "hole",
+	}
+	for domain, suffix := range expected {
+		if result := PublicSuffix(domain); result != suffix {
+			t.Errorf("@TestPublicSuffix: domains.PublicSuffix(%q) returned %q, expected %q", domain, result, suffix)
+		}
+	}
+}
+
+// Tests for domains.punycode()
+func TestPunycode(t *testing.T) {
+	expected := map[string]string{
+		"münchen": "mnchen-3ya",
+		"公司":      "55qx5d",
+		"网络":      "io0a7i",
+		"bücher":  "bcher-kva",
+	}
+	for label, encoded := range expected {
+		if result := punycode(label); result != encoded {
+			t.Errorf("@TestPunycode: domains.punycode(%q) returned %q, expected %q", label, result, encoded)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package domains
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A way of grouping domains together in top lists
+type Grouping string
+
+// Supported groupings
+const (
+	// Every domain is listed on its own
+	NoGrouping Grouping = "none"
+	// Domains are rolled up to their registrable domain (eTLD+1), i.e. a.cdn.example.com to example.com
+	RegistrableDomainGrouping Grouping = "etld1"
+)
+
+/*
+	Parses a grouping given by the user. An empty string defaults to no grouping, and eTLD+1
+	grouping can also be given as "etld+1" or "registrable"
+*/
+func ParseGrouping(grouping string) (Grouping, error) {
+	switch strings.ToLower(strings.TrimSpace(grouping)) {
+	case "", string(NoGrouping), "domain":
+		return NoGrouping, nil
+	case string(RegistrableDomainGrouping), "etld+1", "registrable":
+		return RegistrableDomainGrouping, nil
+	}
+	return "", fmt.Errorf("unknown grouping '%s' (expected none or etld1)", grouping)
+}
+
+// A domain and the number of times that it was queried
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// A group of domains, and the total number of times that they were queried
+type DomainGroup struct {
+	// The domain that the group's members were rolled up to
+	Domain string `json:"domain"`
+	// The total count of the group's members
+	Count int `json:"count"`
+	// The domains in the group, most queried first
+	Members []DomainCount `json:"members"`
+}
+
+// Returns the domain that a domain is rolled up to under this grouping
+func (grouping Grouping) Key(domain string) string {
+	if grouping == RegistrableDomainGrouping {
+		return RegistrableDomain(domain)
+	}
+	return domain
+}
+
+/*
+	Groups a set of domain counts, returning the groups most queried first. Without grouping,
+	each domain is put into a group of its own.
+*/
+func (grouping Grouping) Group(counts []DomainCount) []DomainGroup {
+	var groups []DomainGroup
+	indexes := make(map[string]int)
+
+	for _, count := range counts {
+		key := grouping.Key(count.Domain)
+		index, exists := indexes[key]
+		if !exists {
+			index = len(groups)
+			indexes[key] = index
+			groups = append(groups, DomainGroup{Domain: key})
+		}
+		groups[index].Count += count.Count
+		groups[index].Members = append(groups[index].Members, count)
+	}
+
+	for _, group := range groups {
+		sortDomainCounts(group.Members)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Domain < groups[j].Domain
+	})
+	return groups
+}
+
+// Sorts domain counts, most queried first
+func sortDomainCounts(counts []DomainCount) {
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Domain < counts[j].Domain
+	})
+}
@@ -0,0 +1,50 @@
+package domains
+
+import (
+	"testing"
+)
+
+// Tests for domains.ParseGrouping()
+func TestParseGrouping(t *testing.T) {
+	expected := map[string]Grouping{
+		"":         NoGrouping,
+		"none":     NoGrouping,
+		"ETLD1":    RegistrableDomainGrouping,
+		" etld+1 ": RegistrableDomainGrouping,
+	}
+	for input, grouping := range expected {
+		if result, err := ParseGrouping(input); err != nil || result != grouping {
+			t.Errorf("@TestParseGrouping: domains.ParseGrouping(%q) returned %q (%v), expected %q", input, result, err, grouping)
+		}
+	}
+	if _, err := ParseGrouping("tld"); err == nil {
+		t.Error("@TestParseGrouping: domains.ParseGrouping() did not reject an unknown grouping")
+	}
+}
+
+// Tests for domains.Grouping.Group()
+func TestGroup(t *testing.T) {
+	counts := []DomainCount{
+		{Domain: "a.cdn.example.com", Count: 5},
+		{Domain: "b.cdn.example.com", Count: 7},
+		{Domain: "example.org", Count: 10},
+		{Domain: "bbc.co.uk", Count: 1},
+		{Domain: "www.bbc.co.uk", Count: 2},
+	}
+
+	groups := RegistrableDomainGrouping.Group(counts)
+	if len(groups) != 3 {
+		t.Fatalf("@TestGroup: expected 3 groups, got %+v", groups)
+	}
+	if groups[0].Domain != "example.com" || groups[0].Count != 12 || len(groups[0].Members) != 2 ||
+		groups[0].Members[0].Domain != "b.cdn.example.com" {
+		t.Errorf("@TestGroup: unexpected first group %+v", groups[0])
+	}
+	if groups[1].Domain != "example.org" || groups[2].Domain != "bbc.co.uk" || groups[2].Count != 3 {
+		t.Errorf("@TestGroup: unexpected groups %+v", groups)
+	}
+
+	if ungrouped := NoGrouping.Group(counts); len(ungrouped) != len(counts) || ungrouped[0].Domain != "example.org" {
+		t.Errorf("@TestGroup: expected each domain in a group of its own, got %+v", ungrouped)
+	}
+}
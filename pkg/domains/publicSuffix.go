@@ -0,0 +1,191 @@
+package domains
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+/*
+	A copy of the Public Suffix List (https://publicsuffix.org/list/), embedded so that domains
+	can be grouped without network access. It includes both the ICANN and the private sections
+	of the list, so hosting platforms such as github.io give each of their users their own
+	registrable domain.
+*/
+//go:embed public_suffix_list.dat
+var publicSuffixList string
+
+// The kinds of rule found in the Public Suffix List, as flags as a domain can have more than one
+const (
+	// i.e. co.uk - the domain is a public suffix
+	normalRule = 1 << iota
+	// i.e. *.ck - every child of the domain is a public suffix
+	wildcardRule
+	// i.e. !www.ck - the domain is not a public suffix, even though a wildcard rule says otherwise
+	exceptionRule
+)
+
+var (
+	// The parsed Public Suffix List, keyed by the (ASCII) domain that each rule applies to
+	publicSuffixRules map[string]int
+	// Makes sure that the list is only parsed once, and only when it's first needed
+	parsePublicSuffixRulesOnce sync.Once
+)
+
+// Parses the embedded Public Suffix List
+func parsePublicSuffixRules() {
+	publicSuffixRules = make(map[string]int)
+	for _, line := range strings.Split(publicSuffixList, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		rule, kind := fields[0], normalRule
+		if strings.HasPrefix(rule, "!") {
+			rule, kind = rule[1:], exceptionRule
+		} else if strings.HasPrefix(rule, "*.") {
+			rule, kind = rule[2:], wildcardRule
+		}
+		// queries are logged with internationalised labels in their ASCII (punycode) form
+		publicSuffixRules[toASCII(strings.ToLower(rule))] |= kind
+	}
+}
+
+/*
+	Returns the public suffix of a domain, i.e. the part of it that anyone can register domains
+	underneath (com for www.example.com, co.uk for mail.example.co.uk). Domains that aren't
+	covered by the list are treated as having their last label as their public suffix.
+*/
+func PublicSuffix(domain string) string {
+	parsePublicSuffixRulesOnce.Do(parsePublicSuffixRules)
+
+	domain = Normalise(domain)
+	labels := strings.Split(domain, ".")
+
+	// the longest matching rule wins, so check the longest candidate suffixes first
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if publicSuffixRules[candidate]&exceptionRule != 0 {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if publicSuffixRules[candidate]&normalRule != 0 {
+			return candidate
+		}
+		if i+1 < len(labels) && publicSuffixRules[strings.Join(labels[i+1:], ".")]&wildcardRule != 0 {
+			return candidate
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// Converts each internationalised label of a domain to its ASCII (punycode) form
+func toASCII(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		for _, char := range label {
+			if char >= 0x80 {
+				labels[i] = "xn--" + punycode(label)
+				break
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Parameters of the punycode encoding, from RFC 3492
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// Encodes a label using punycode (RFC 3492), without the xn-- prefix
+func punycode(label string) string {
+	runes := []rune(label)
+
+	var output []byte
+	for _, char := range runes {
+		if char < 0x80 {
+			output = append(output, byte(char))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for handled < len(runes) {
+		// the smallest code point that hasn't been handled yet
+		next := rune(0x7fffffff)
+		for _, char := range runes {
+			if char >= n && char < next {
+				next = char
+			}
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+
+		for _, char := range runes {
+			if char < n {
+				delta++
+			}
+			if char != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			output = append(output, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+
+	return string(output)
+}
+
+// Adapts the bias after each code point is encoded
+func punycodeAdapt(delta int, points int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+// Returns the character used to encode a punycode digit
+func punycodeDigit(digit int) byte {
+	if digit < 26 {
+		return byte('a' + digit)
+	}
+	return byte('0' + digit - 26)
+}
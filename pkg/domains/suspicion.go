@@ -0,0 +1,153 @@
+package domains
+
+import (
+	"math"
+	"strings"
+)
+
+/*
+	The score (out of 100) at or above which a domain is considered suspicious. Domains used for
+	DNS tunnelling and algorithmically generated domains (DGAs) tend to have long, random looking
+	labels, a large number of unique subdomains and a high query rate, whereas everyday domains
+	rarely have more than one or two of these traits.
+*/
+const SuspicionThreshold = 50.0
+
+// How much each trait contributes to a domain's suspicion score
+const (
+	entropyWeight     = 0.35
+	lengthWeight      = 0.25
+	cardinalityWeight = 0.25
+	queryRateWeight   = 0.15
+)
+
+// The traits of a domain that it is scored on, and the resulting score
+type Suspicion struct {
+	// Shannon entropy (in bits per character) of the domain's longest label
+	Entropy float64 `json:"entropy"`
+	// The length of the domain's longest label
+	LongestLabel int `json:"longest_label"`
+	// The length of the whole domain
+	Length int `json:"length"`
+	// The number of unique subdomains seen underneath the domain's registrable domain
+	Subdomains int `json:"subdomains"`
+	// How many queries an hour are made for the domain's registrable domain
+	QueriesPerHour float64 `json:"queries_per_hour"`
+	// The domain's suspicion score, out of 100
+	Score float64 `json:"score"`
+}
+
+/*
+	Scores a domain on the entropy and length of its labels, the number of unique subdomains seen
+	underneath its registrable domain, and the rate at which its registrable domain is queried.
+	Reverse lookups (*.arpa) and single label host names are never suspicious.
+*/
+func Assess(domain string, subdomains int, queriesPerHour float64) Suspicion {
+	suspicion := lexicalTraits(domain)
+	suspicion.Subdomains = subdomains
+	suspicion.QueriesPerHour = queriesPerHour
+	if suspicion.LongestLabel == 0 {
+		return suspicion
+	}
+
+	suspicion.Score = 100 * (entropyWeight*entropyScore(suspicion.Entropy) +
+		lengthWeight*lengthScore(suspicion.LongestLabel, suspicion.Length) +
+		cardinalityWeight*logScale(float64(subdomains)) +
+		queryRateWeight*logScale(queriesPerHour))
+	return suspicion
+}
+
+/*
+	Scores a domain on the entropy and length of its labels alone, for when there is no history to
+	count its subdomains and query rate from (i.e. a single query in the live query log). The
+	score is scaled so that it's still out of 100.
+*/
+func LexicalScore(domain string) float64 {
+	suspicion := lexicalTraits(domain)
+	if suspicion.LongestLabel == 0 {
+		return 0
+	}
+	return 100 * (entropyWeight*entropyScore(suspicion.Entropy) +
+		lengthWeight*lengthScore(suspicion.LongestLabel, suspicion.Length)) /
+		(entropyWeight + lengthWeight)
+}
+
+// Does a domain look suspicious based on its labels alone?
+func IsLexicallySuspicious(domain string) bool {
+	return LexicalScore(domain) >= SuspicionThreshold
+}
+
+// Calculates the Shannon entropy of a label, in bits per character
+func LabelEntropy(label string) float64 {
+	if label == "" {
+		return 0
+	}
+
+	counts := make(map[rune]float64)
+	var total float64
+	for _, char := range label {
+		counts[char]++
+		total++
+	}
+
+	var entropy float64
+	for _, count := range counts {
+		probability := count / total
+		entropy -= probability * math.Log2(probability)
+	}
+	return entropy
+}
+
+/*
+	Finds the entropy and length of a domain's longest label (ignoring the suffix that it's
+	registered under, as that is never random), along with the domain's overall length
+*/
+func lexicalTraits(domain string) Suspicion {
+	domain = Normalise(domain)
+	suspicion := Suspicion{Length: len(domain)}
+	if !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".arpa") {
+		return suspicion
+	}
+
+	registrable := RegistrableDomain(domain)
+	labels := append(SubdomainLabels(domain), strings.Split(registrable, ".")[0])
+
+	longest := ""
+	for _, label := range labels {
+		if len(label) > len(longest) {
+			longest = label
+		}
+	}
+	suspicion.LongestLabel = len(longest)
+	suspicion.Entropy = LabelEntropy(longest)
+	return suspicion
+}
+
+/*
+	Maps a label's entropy onto 0-1. Dictionary words and brand names sit at around 3 bits per
+	character or below, whereas random strings of a dozen or more characters approach 4.
+*/
+func entropyScore(entropy float64) float64 {
+	return clamp(entropy - 3)
+}
+
+/*
+	Maps the length of a domain's longest label and of the domain as a whole onto 0-1. Labels can
+	be up to 63 characters long, and tunnelling tools tend to fill them as far as they can.
+*/
+func lengthScore(longestLabel int, length int) float64 {
+	return math.Max(clamp(float64(longestLabel-12)/38), clamp(float64(length-50)/100))
+}
+
+// Maps a count or rate onto 0-1 logarithmically, with 1 or less scoring 0 and 1000 or more scoring 1
+func logScale(value float64) float64 {
+	if value <= 1 {
+		return 0
+	}
+	return clamp(math.Log10(value) / 3)
+}
+
+// Clamps a value to 0-1
+func clamp(value float64) float64 {
+	return math.Min(math.Max(value, 0), 1)
+}
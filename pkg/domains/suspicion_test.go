@@ -0,0 +1,50 @@
+package domains
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests for domains.LabelEntropy()
+func TestLabelEntropy(t *testing.T) {
+	expected := map[string]float64{
+		"":         0,
+		"aaaa":     0,
+		"ab":       1,
+		"abcd":     2,
+		"abcdefgh": 3,
+	}
+	for label, entropy := range expected {
+		if result := LabelEntropy(label); math.Abs(result-entropy) > 1e-9 {
+			t.Errorf("@TestLabelEntropy: domains.LabelEntropy(%q) returned %f, expected %f", label, result, entropy)
+		}
+	}
+}
+
+// Tests for domains.Assess() and domains.LexicalScore()
+func TestAssess(t *testing.T) {
+	tunnel := "x7kq2p9zv0abc1def.tunnel.evil.io"
+	for _, domain := range []string{"www.google.com", "googleusercontent.com", "connectivity-check.ubuntu.com"} {
+		if IsLexicallySuspicious(domain) {
+			t.Errorf("@TestAssess: %s was lexically suspicious (score %.1f)", domain, LexicalScore(domain))
+		}
+	}
+	if !IsLexicallySuspicious(tunnel) {
+		t.Errorf("@TestAssess: %s was not lexically suspicious (score %.1f)", tunnel, LexicalScore(tunnel))
+	}
+
+	// the number of subdomains and the query rate both add to the score
+	quiet := Assess(tunnel, 1, 1)
+	busy := Assess(tunnel, 500, 100)
+	if quiet.LongestLabel != 17 || busy.Score <= quiet.Score || busy.Score < SuspicionThreshold {
+		t.Errorf("@TestAssess: unexpected assessments %+v and %+v", quiet, busy)
+	}
+	if busy.Score > 100 {
+		t.Errorf("@TestAssess: score %.1f is above 100", busy.Score)
+	}
+
+	// reverse lookups are never suspicious
+	if reverse := Assess("4.3.2.1.in-addr.arpa", 5000, 1000); reverse.Score != 0 {
+		t.Errorf("@TestAssess: reverse lookup scored %.1f", reverse.Score)
+	}
+}
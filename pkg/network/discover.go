@@ -0,0 +1,487 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+// Defaults used when looking for Pi-Holes on the local network
+const (
+	// How many hosts are probed at once
+	DefaultDiscoveryWorkers = 128
+	// How long each probe waits for a response
+	DefaultDiscoveryProbeTimeout = time.Second
+	// How long to listen for mDNS responses
+	DefaultMDNSListenTime = time.Second * 2
+	/*
+		The largest subnet that is scanned, as a prefix length. The subnet of an interface with a
+		larger one (i.e. a /16) is narrowed to the /24 around its own address.
+	*/
+	MaxDiscoveryPrefix = 24
+)
+
+// Ports that Pi-Holes are usually served on
+var DefaultDiscoveryPorts = []int{80, 443, 8080}
+
+// Names that Pi-Holes are commonly known by. pi.hole is resolved by a Pi-Hole for clients using it for DNS
+var piHoleHostNames = []string{"pi.hole"}
+
+// Names that Pi-Holes are commonly announced as over mDNS (i.e. by Avahi on Raspberry Pi OS)
+var piHoleMDNSNames = []string{"pihole.local", "pi-hole.local", "pi.hole.local"}
+
+// A Pi-Hole found on the local network
+type DiscoveredPiHole struct {
+	// The base URL of its web interface
+	URL string
+	// Its address, for sorting
+	IP net.IP
+	// The version that it reported, i.e. "v5.18.2". Empty if it wasn't given out
+	Version string
+	/*
+		Does it serve the API that Pi-CLI uses (/admin/api.php)? Pi-Hole v6 replaced it with a new
+		API under /api/
+	*/
+	Supported bool
+}
+
+// Describes a Pi-Hole for a pick-list
+func (piHole DiscoveredPiHole) String() string {
+	version := piHole.Version
+	if version == "" {
+		version = "unknown version"
+	}
+	if !piHole.Supported {
+		return fmt.Sprintf("%s (Pi-Hole %s, whose API isn't supported by Pi-CLI yet)", piHole.URL, version)
+	}
+	return fmt.Sprintf("%s (Pi-Hole %s)", piHole.URL, version)
+}
+
+// Options controlling where to look for Pi-Holes
+type DiscoveryOptions struct {
+	// Subnets to scan. Defaults to those of the machine's network interfaces
+	Subnets []*net.IPNet
+	// Ports to probe on each host. Defaults to DefaultDiscoveryPorts
+	Ports []int
+	// How many hosts are probed at once. Defaults to DefaultDiscoveryWorkers
+	Workers int
+	// How long each probe waits for a response. Defaults to DefaultDiscoveryProbeTimeout
+	ProbeTimeout time.Duration
+	// Should Pi-Holes announced over mDNS be looked for as well?
+	MDNS bool
+}
+
+/*
+	Looks for Pi-Holes on the local network by probing every host in its subnets for the Pi-Hole's
+	API, along with any hosts called pi.hole (and, if enabled, announced over mDNS). Returns the
+	Pi-Holes found, sorted by address.
+
+	Probes go straight to each host, ignoring any proxy or SSH tunnel, and don't verify HTTPS
+	certificates, as Pi-Holes with self-signed ones should still be found. The URL that's picked is
+	then validated with the configured TLS options in the same way as one typed in.
+*/
+func DiscoverPiHoles(ctx context.Context, options DiscoveryOptions) ([]DiscoveredPiHole, error) {
+	if options.Subnets == nil {
+		subnets, err := LocalSubnets()
+		if err != nil {
+			return nil, err
+		}
+		options.Subnets = subnets
+	}
+	if options.Ports == nil {
+		options.Ports = DefaultDiscoveryPorts
+	}
+	if options.Workers < 1 {
+		options.Workers = DefaultDiscoveryWorkers
+	}
+	if options.ProbeTimeout <= 0 {
+		options.ProbeTimeout = DefaultDiscoveryProbeTimeout
+	}
+
+	hosts := map[string]net.IP{}
+	for _, subnet := range options.Subnets {
+		for _, ip := range hostsIn(subnet) {
+			hosts[ip.String()] = ip
+		}
+	}
+	for _, ip := range lookupPiHoleNames(ctx, options.MDNS) {
+		hosts[ip.String()] = ip
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no local networks were found to search")
+	}
+
+	client := &http.Client{
+		Timeout: options.ProbeTimeout,
+		Transport: &http.Transport{
+			Proxy:             nil,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		// a redirect (i.e. to a login page) means that it isn't the API
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	type target struct {
+		ip   net.IP
+		port int
+	}
+	targets := make(chan target)
+	var mutex sync.Mutex
+	var found []DiscoveredPiHole
+	var wg sync.WaitGroup
+
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targets {
+				if piHole, ok := probePiHole(ctx, client, target.ip, target.port); ok {
+					mutex.Lock()
+					found = append(found, piHole)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+sending:
+	for _, ip := range hosts {
+		for _, port := range options.Ports {
+			select {
+			case targets <- target{ip: ip, port: port}:
+			case <-ctx.Done():
+				break sending
+			}
+		}
+	}
+	close(targets)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if order := bytes.Compare(found[i].IP.To16(), found[j].IP.To16()); order != 0 {
+			return order < 0
+		}
+		return found[i].URL < found[j].URL
+	})
+	return found, nil
+}
+
+/*
+	The IPv4 subnets of the machine's network interfaces that are up, excluding loopback. Large
+	subnets are narrowed down to the MaxDiscoveryPrefix around the machine's own address.
+*/
+func LocalSubnets() ([]*net.IPNet, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []*net.IPNet
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addresses, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			ipNet, ok := address.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			if ones, _ := ipNet.Mask.Size(); ones < MaxDiscoveryPrefix {
+				mask := net.CIDRMask(MaxDiscoveryPrefix, 32)
+				ipNet = &net.IPNet{IP: ipNet.IP.Mask(mask), Mask: mask}
+			}
+			subnets = append(subnets, ipNet)
+		}
+	}
+	return subnets, nil
+}
+
+/*
+	Lists the addresses of the hosts in an IPv4 subnet, leaving out its network and broadcast
+	addresses (other than in /31 and /32 subnets, which don't have them). Subnets larger than a /16
+	are too big to scan, so have no hosts listed.
+*/
+func hostsIn(subnet *net.IPNet) []net.IP {
+	base := subnet.IP.Mask(subnet.Mask).To4()
+	ones, bits := subnet.Mask.Size()
+	if base == nil || bits != 32 || ones < 16 {
+		return nil
+	}
+
+	size := uint32(1) << uint(32-ones)
+	first, last := uint32(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+
+	start := binary.BigEndian.Uint32(base)
+	hosts := make([]net.IP, 0, last-first+1)
+	for offset := first; offset <= last; offset++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+offset)
+		hosts = append(hosts, ip)
+	}
+	return hosts
+}
+
+/*
+	Checks whether a host serves the Pi-Hole's API on a port, trying the API that Pi-CLI uses
+	first and then the newer one from Pi-Hole v6
+*/
+func probePiHole(ctx context.Context, client *http.Client, ip net.IP, port int) (DiscoveredPiHole, bool) {
+	scheme := "http"
+	if port == 443 {
+		scheme = "https"
+	}
+	host := ip.String()
+	if (scheme == "http" && port != 80) || (scheme == "https" && port != 443) {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	baseURL := scheme + "://" + host
+	piHole := DiscoveredPiHole{URL: baseURL, IP: ip}
+
+	// the versions of a Pi-Hole's components are given out without an API key
+	status, body, err := probe(ctx, client, GenerateAPIAddress(baseURL)+"?versions")
+	if err != nil {
+		// nothing is listening, so there's no point trying the other API
+		return piHole, false
+	}
+	if status == http.StatusOK {
+		if version, err := jsonparser.GetString(body, "core_current"); err == nil {
+			piHole.Version = version
+			piHole.Supported = true
+			return piHole, true
+		}
+	}
+
+	// Pi-Hole v6 answers with its version, or a JSON error if it needs logging into first
+	status, body, err = probe(ctx, client, baseURL+"/api/info/version")
+	if err != nil {
+		return piHole, false
+	}
+	if version, err := jsonparser.GetString(body, "version", "core", "local", "version"); err == nil && status == http.StatusOK {
+		piHole.Version = version
+		return piHole, true
+	}
+	if _, err := jsonparser.GetString(body, "error", "key"); err == nil && status == http.StatusUnauthorized {
+		piHole.Version = "v6"
+		return piHole, true
+	}
+	return piHole, false
+}
+
+// Sends a GET request as part of discovery, returning the response's status and (the start of) its body
+func probe(ctx context.Context, client *http.Client, url string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, body, nil
+}
+
+// Finds the addresses of hosts known by the names that Pi-Holes commonly go by
+func lookupPiHoleNames(ctx context.Context, mdns bool) []net.IP {
+	var found []net.IP
+	for _, name := range piHoleHostNames {
+		lookupCtx, cancel := context.WithTimeout(ctx, time.Second)
+		addresses, _ := net.DefaultResolver.LookupIP(lookupCtx, "ip4", name)
+		cancel()
+		found = append(found, addresses...)
+	}
+	if mdns {
+		addresses, _ := QueryMDNS(ctx, piHoleMDNSNames, DefaultMDNSListenTime)
+		found = append(found, addresses...)
+	}
+	return found
+}
+
+// The multicast address and port that mDNS queries are sent to
+var mdnsAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+/*
+	Asks for the IPv4 addresses of hosts with the given .local names over mDNS, and listens for
+	answers for a while. The query is sent from an ordinary port, so responders answer it directly
+	rather than to the whole network.
+*/
+func QueryMDNS(ctx context.Context, names []string, listenFor time.Duration) ([]net.IP, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := mdnsQuery(names)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, mdnsAddress); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(listenFor)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[strings.ToLower(strings.TrimSuffix(name, "."))] = true
+	}
+
+	var found []net.IP
+	buffer := make([]byte, 9000)
+	for ctx.Err() == nil {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			// the deadline passed
+			break
+		}
+		for name, ip := range mdnsAddresses(buffer[:n]) {
+			if wanted[name] {
+				found = append(found, ip)
+			}
+		}
+	}
+	return found, nil
+}
+
+// DNS record types and classes used in mDNS queries
+const (
+	dnsTypeA   = 1
+	dnsClassIN = 1
+)
+
+// Builds an mDNS query for the IPv4 addresses of some names
+func mdnsQuery(names []string) ([]byte, error) {
+	packet := make([]byte, 12)
+	binary.BigEndian.PutUint16(packet[4:], uint16(len(names)))
+	for _, name := range names {
+		for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("'%s' is not a valid DNS name", name)
+			}
+			packet = append(packet, byte(len(label)))
+			packet = append(packet, label...)
+		}
+		packet = append(packet, 0, 0, dnsTypeA, 0, dnsClassIN)
+	}
+	return packet, nil
+}
+
+/*
+	Pulls the A records out of an mDNS response, as a map of lower case name to address. Anything
+	that can't be parsed is ignored.
+*/
+func mdnsAddresses(packet []byte) map[string]net.IP {
+	addresses := map[string]net.IP{}
+	if len(packet) < 12 {
+		return addresses
+	}
+	questions := int(binary.BigEndian.Uint16(packet[4:]))
+	records := int(binary.BigEndian.Uint16(packet[6:])) + int(binary.BigEndian.Uint16(packet[8:])) +
+		int(binary.BigEndian.Uint16(packet[10:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, ok := readDNSName(packet, offset)
+		if !ok || next+4 > len(packet) {
+			return addresses
+		}
+		offset = next + 4
+	}
+
+	for i := 0; i < records; i++ {
+		name, next, ok := readDNSName(packet, offset)
+		if !ok || next+10 > len(packet) {
+			return addresses
+		}
+		recordType := binary.BigEndian.Uint16(packet[next:])
+		length := int(binary.BigEndian.Uint16(packet[next+8:]))
+		data := next + 10
+		if data+length > len(packet) {
+			return addresses
+		}
+		if recordType == dnsTypeA && length == 4 {
+			addresses[strings.ToLower(name)] = net.IPv4(packet[data], packet[data+1], packet[data+2], packet[data+3])
+		}
+		offset = data + length
+	}
+	return addresses
+}
+
+/*
+	Reads a (possibly compressed) name from a DNS packet, returning it along with the offset of
+	whatever follows it
+*/
+func readDNSName(packet []byte, offset int) (string, int, bool) {
+	var labels []string
+	next := -1
+	// each pointer has to point backwards, so following them always ends
+	for jumps := 0; jumps < len(packet); jumps++ {
+		if offset >= len(packet) {
+			return "", 0, false
+		}
+		length := int(packet[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, true
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(packet) {
+				return "", 0, false
+			}
+			pointer := int(binary.BigEndian.Uint16(packet[offset:]) & 0x3FFF)
+			if pointer >= offset {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = pointer
+		default:
+			if offset+1+length > len(packet) {
+				return "", 0, false
+			}
+			labels = append(labels, string(packet[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Tests for network.hostsIn()
+func TestHostsIn(t *testing.T) {
+	tests := map[string][]string{
+		"192.168.1.0/30":  {"192.168.1.1", "192.168.1.2"},
+		"192.168.1.4/31":  {"192.168.1.4", "192.168.1.5"},
+		"192.168.1.10/32": {"192.168.1.10"},
+		"10.0.0.0/8":      nil,
+	}
+	for cidr, expected := range tests {
+		_, subnet, _ := net.ParseCIDR(cidr)
+		hosts := hostsIn(subnet)
+		if len(hosts) != len(expected) {
+			t.Errorf("@TestHostsIn: %s gave %v, expected %v", cidr, hosts, expected)
+			continue
+		}
+		for i := range expected {
+			if hosts[i].String() != expected[i] {
+				t.Errorf("@TestHostsIn: %s gave %v, expected %v", cidr, hosts, expected)
+			}
+		}
+	}
+
+	_, subnet, _ := net.ParseCIDR("172.16.0.0/24")
+	if hosts := hostsIn(subnet); len(hosts) != 254 {
+		t.Errorf("@TestHostsIn: a /24 gave %d hosts, expected 254", len(hosts))
+	}
+}
+
+// The port that a test server is listening on
+func serverPort(t *testing.T, server *httptest.Server) int {
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return number
+}
+
+// Tests for network.DiscoverPiHoles() telling Pi-Holes apart from other web servers
+func TestDiscoverPiHoles(t *testing.T) {
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == APIPath && r.URL.RawQuery == "versions" {
+			_, _ = w.Write([]byte(`{"core_update": false, "core_current": "v5.18.2", "FTL_current": "v5.25.1"}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer legacy.Close()
+
+	current := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/info/version" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"key": "unauthorized", "message": "Unauthorized"}}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer current.Close()
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>Not a Pi-Hole</html>"))
+	}))
+	defer other.Close()
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.1/32")
+	found, err := DiscoverPiHoles(context.Background(), DiscoveryOptions{
+		Subnets: []*net.IPNet{loopback},
+		Ports:   []int{serverPort(t, legacy), serverPort(t, current), serverPort(t, other)},
+	})
+	if err != nil {
+		t.Fatalf("@TestDiscoverPiHoles: %s", err.Error())
+	}
+
+	piHoles := map[string]DiscoveredPiHole{}
+	for _, piHole := range found {
+		piHoles[piHole.URL] = piHole
+	}
+	if len(piHoles) != 2 {
+		t.Fatalf("@TestDiscoverPiHoles: expected 2 Pi-Holes, found %v", found)
+	}
+	if piHole := piHoles[legacy.URL]; !piHole.Supported || piHole.Version != "v5.18.2" {
+		t.Errorf("@TestDiscoverPiHoles: unexpected legacy Pi-Hole %+v", piHole)
+	}
+	if piHole, ok := piHoles[current.URL]; !ok || piHole.Supported || piHole.Version != "v6" {
+		t.Errorf("@TestDiscoverPiHoles: unexpected v6 Pi-Hole %+v", piHole)
+	}
+}
+
+// Tests for network.mdnsAddresses() reading an mDNS response with a compressed name
+func TestMDNSAddresses(t *testing.T) {
+	packet, err := mdnsQuery([]string{"pihole.local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mark the packet as a response with a single answer
+	packet[2] = 0x84
+	binary.BigEndian.PutUint16(packet[6:], 1)
+
+	// the answer's name points back to the question's, at offset 12
+	answer := []byte{0xC0, 12, 0, dnsTypeA, 0x80, dnsClassIN, 0, 0, 0, 120, 0, 4, 192, 168, 1, 2}
+	packet = append(packet, answer...)
+
+	addresses := mdnsAddresses(packet)
+	if ip := addresses["pihole.local"]; ip == nil || ip.String() != "192.168.1.2" {
+		t.Errorf("@TestMDNSAddresses: unexpected addresses %v", addresses)
+	}
+
+	// truncated packets are ignored rather than read past their end
+	if addresses := mdnsAddresses(packet[:len(packet)-3]); len(addresses) != 0 {
+		t.Errorf("@TestMDNSAddresses: read addresses %v from a truncated packet", addresses)
+	}
+}
@@ -1,16 +1,52 @@
 package network
 
 import (
+	"errors"
 	"net/http"
 	"time"
 )
 
-// Construct a http.Client with a 3 second timeout for use in API requests
+// The circuit breaker shared by every request to the Pi-Hole
+var Breaker = NewCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown)
+
+// Construct a http.Client giving each attempt at a request a 3 second timeout for use in API requests
 var HttpClient = NewHTTPClient(time.Second * 3)
 
-// Create a new http.Client with a given timeout duration
+/*
+	Create a new http.Client that retries failed requests, giving each attempt a given timeout
+	duration. Requests go through the shared circuit breaker.
+*/
 func NewHTTPClient(timeout time.Duration) *http.Client {
 	return &http.Client{
-		Timeout: timeout,
+		Transport: &ResilientTransport{
+			Base:           http.DefaultTransport.(*http.Transport).Clone(),
+			AttemptTimeout: timeout,
+			Attempts:       DefaultAttempts,
+			Backoff:        DefaultBackoff,
+			MaxBackoff:     DefaultMaxBackoff,
+			Breaker:        Breaker,
+		},
+	}
+}
+
+// Returns the resilient transport used by the shared HttpClient, so that it can be configured
+func sharedTransport() (*ResilientTransport, error) {
+	transport, ok := HttpClient.Transport.(*ResilientTransport)
+	if !ok {
+		return nil, errors.New("the shared HTTP client isn't using a resilient transport")
+	}
+	return transport, nil
+}
+
+// Returns the transport that the shared HttpClient sends requests over, so that it can be configured
+func sharedBaseTransport() (*http.Transport, error) {
+	transport, err := sharedTransport()
+	if err != nil {
+		return nil, err
+	}
+	base, ok := transport.Base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("the shared HTTP client isn't sending requests over a http.Transport")
 	}
+	return base, nil
 }
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Given as a proxy URL to connect to the Pi-Hole directly, ignoring any proxy environment variables
+const NoProxy = "none"
+
+/*
+	Options controlling how Pi-CLI reaches a Pi-Hole that it can't connect to directly, i.e. one
+	at a remote site behind a bastion host. When neither option is set, the HTTP_PROXY,
+	HTTPS_PROXY and NO_PROXY environment variables are honoured.
+*/
+type ProxyOptions struct {
+	/*
+		URL of a proxy to send every request through. This can be a HTTP proxy (i.e.
+		http://proxy.lan:3128), which HTTPS requests are tunnelled through with CONNECT, or a SOCKS5
+		proxy (i.e. socks5://bastion.lan:1080). Credentials can be included in the URL. "none"
+		connects directly, even if proxy environment variables are set.
+	*/
+	URL string `json:"url,omitempty"`
+	// An SSH jump host that connections to the Pi-Hole are tunnelled through
+	SSHTunnel *SSHTunnelOptions `json:"ssh_tunnel,omitempty"`
+}
+
+// Are any of the options set?
+func (options *ProxyOptions) IsSet() bool {
+	return options != nil && (options.URL != "" || options.SSHTunnel != nil)
+}
+
+/*
+	Parses the URL of a HTTP or SOCKS5 proxy. A host on its own (i.e. proxy.lan:3128) is taken
+	to be a HTTP proxy. Returns nil if the proxy is "none".
+*/
+func ParseProxyURL(proxy string) (*url.URL, error) {
+	proxy = strings.TrimSpace(proxy)
+	if proxy == NoProxy {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid proxy URL", proxy)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s' (expected http, https or socks5)", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("the proxy URL '%s' doesn't include a host", proxy)
+	}
+	return parsed, nil
+}
+
+/*
+	Applies proxy options to the shared HttpClient. Either a proxy or an SSH tunnel can be used,
+	but not both.
+*/
+func ConfigureProxy(options *ProxyOptions) error {
+	if !options.IsSet() {
+		return nil
+	}
+	if options.URL != "" && options.SSHTunnel != nil {
+		return errors.New("a proxy and an SSH tunnel cannot be used together")
+	}
+
+	base, err := sharedBaseTransport()
+	if err != nil {
+		return err
+	}
+
+	if options.SSHTunnel != nil {
+		tunnel, err := NewSSHTunnel(options.SSHTunnel)
+		if err != nil {
+			return err
+		}
+		// connections are made by the jump host, so proxy environment variables don't apply
+		base.Proxy = nil
+		base.DialContext = tunnel.DialContext
+		return nil
+	}
+
+	proxyURL, err := ParseProxyURL(options.URL)
+	if err != nil {
+		return err
+	}
+	if proxyURL == nil {
+		base.Proxy = nil
+	} else {
+		if password, ok := proxyURL.User.Password(); ok {
+			AddSecret(password)
+		}
+		base.Proxy = http.ProxyURL(proxyURL)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package network
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Shown in place of a secret that has been redacted
+const Redacted = "REDACTED"
+
+/*
+	Should secrets be shown rather than redacted? Set by the --show-secrets flag, for when the
+	user needs to see exactly what was sent
+*/
+var ShowSecrets = false
+
+/*
+	Query string parameters whose values are secrets. The Pi-Hole's API only accepts the API key
+	as the auth parameter in the query string, so it ends up in the URL of every request (and in
+	the errors that Go's HTTP client returns, which include the URL).
+*/
+var secretParameterNames = []string{"auth", "token", "sid", "password", "pw"}
+
+// Matches secret parameters and their values in a query string
+var secretParameters = regexp.MustCompile(`(?i)([?&](?:` + strings.Join(secretParameterNames, "|") + `)=)[^&#\s"']+`)
+
+// Is a query string parameter one whose value is a secret?
+func IsSecretParameter(name string) bool {
+	for _, secret := range secretParameterNames {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets that have been seen (i.e. the API key), which are redacted wherever they appear
+var secrets = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// Registers a secret, so that it's redacted from any text that it appears in
+func AddSecret(secret string) {
+	// very short secrets would redact parts of ordinary words
+	if len(secret) < 4 {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, existing := range secrets.values {
+		if existing == secret {
+			return
+		}
+	}
+	secrets.values = append(secrets.values, secret)
+}
+
+// Redacts any secrets from a piece of text, i.e. an error message or a URL
+func Redact(text string) string {
+	if ShowSecrets {
+		return text
+	}
+	secrets.RLock()
+	for _, secret := range secrets.values {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	secrets.RUnlock()
+	return secretParameters.ReplaceAllString(text, "${1}"+Redacted)
+}
+
+// An error whose message has had secrets redacted from it
+type redactedError struct {
+	err error
+}
+
+func (err *redactedError) Error() string {
+	return Redact(err.err.Error())
+}
+
+// The original error can still be checked for with errors.Is and errors.As
+func (err *redactedError) Unwrap() error {
+	return err.err
+}
+
+// Wraps an error so that any secrets in its message are redacted
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+/*
+	Masks a secret for display, i.e. in the config view, showing only its last few characters
+	so that it can still be told apart from others
+*/
+func MaskSecret(secret string) string {
+	if ShowSecrets || secret == "" {
+		return secret
+	}
+	if len(secret) < 16 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
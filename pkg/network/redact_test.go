@@ -0,0 +1,61 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Tests for network.Redact() and network.RedactError()
+func TestRedact(t *testing.T) {
+	const key = "c808f484a4e88cc32a9a8bfcce19169c77bcd9c5eec18d859e1bb4b318bf42bf"
+	AddSecret(key)
+
+	expected := map[string]string{
+		"http://pi.hole/admin/api.php?summary&auth=" + key:     "http://pi.hole/admin/api.php?summary&auth=REDACTED",
+		"http://pi.hole/admin/api.php?auth=abcdef&topItems=10": "http://pi.hole/admin/api.php?auth=REDACTED&topItems=10",
+		"the key is " + key:   "the key is REDACTED",
+		"nothing secret here": "nothing secret here",
+	}
+	for input, redacted := range expected {
+		if result := Redact(input); result != redacted {
+			t.Errorf("@TestRedact: network.Redact(%q) returned %q, expected %q", input, result, redacted)
+		}
+	}
+
+	// errors from sending requests include the URL, and with it the key
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:1/admin/api.php?summary&auth="+key, nil)
+	_, err := http.DefaultClient.Do(req.WithContext(cancelledContext()))
+	redacted := RedactError(err)
+	if strings.Contains(redacted.Error(), key) {
+		t.Errorf("@TestRedact: network.RedactError() left the key in %q", redacted.Error())
+	}
+	if !errors.Is(redacted, context.Canceled) {
+		t.Error("@TestRedact: network.RedactError() hid the original error from errors.Is")
+	}
+
+	ShowSecrets = true
+	defer func() { ShowSecrets = false }()
+	if result := Redact("the key is " + key); result != "the key is "+key {
+		t.Errorf("@TestRedact: network.Redact() redacted %q with ShowSecrets set", result)
+	}
+}
+
+// Tests for network.MaskSecret()
+func TestMaskSecret(t *testing.T) {
+	if masked := MaskSecret("c808f484a4e88cc32a9a8bfcce19169c77bcd9c5eec18d859e1bb4b318bf42bf"); masked != "********42bf" {
+		t.Errorf("@TestMaskSecret: unexpected mask %q", masked)
+	}
+	if masked := MaskSecret("short"); masked != "********" {
+		t.Errorf("@TestMaskSecret: unexpected mask %q for a short secret", masked)
+	}
+}
+
+// Returns a context that has already been cancelled
+func cancelledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
@@ -0,0 +1,349 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for retrying requests, and for the circuit breaker
+const (
+	// How many times a request is attempted in total, including its first attempt
+	DefaultAttempts = 3
+	// How long to wait before the first retry. Each retry after that waits twice as long as the last
+	DefaultBackoff = time.Millisecond * 250
+	// The longest that a retry will wait for
+	DefaultMaxBackoff = time.Second * 2
+	// How many requests in a row have to fail for the circuit breaker to open
+	DefaultBreakerThreshold = 3
+	// How long the circuit breaker stays open for at first, before letting a request through to test the Pi-Hole
+	DefaultBreakerCooldown = time.Second * 5
+	// The longest that the circuit breaker stays open for, as its cooldown doubles each time a test request fails
+	MaxBreakerCooldown = time.Minute
+)
+
+// Returned instead of sending a request while the circuit breaker is open
+var ErrCircuitOpen = errors.New("the Pi-Hole has stopped responding, waiting before trying it again")
+
+/*
+	Options controlling how requests to the Pi-Hole are retried, and when the circuit breaker
+	stops sending them. Unset options use their defaults.
+*/
+type RetryOptions struct {
+	// How many times a request is attempted in total (1 disables retries)
+	Attempts int `json:"attempts,omitempty"`
+	// How long to wait before the first retry, in milliseconds
+	BackoffMS int `json:"backoff_ms,omitempty"`
+	// The longest that a retry will wait for, in milliseconds
+	MaxBackoffMS int `json:"max_backoff_ms,omitempty"`
+	// How many requests in a row have to fail for the circuit breaker to open
+	BreakerThreshold int `json:"breaker_threshold,omitempty"`
+	// How long the circuit breaker stays open for at first, in seconds
+	BreakerCooldownS int `json:"breaker_cooldown_s,omitempty"`
+}
+
+type contextKey int
+
+// Marks a request's context as not to be retried
+const noRetriesKey contextKey = iota
+
+/*
+	Returns a context whose requests are never retried. This is used for requests that change
+	the Pi-Hole's state (i.e. enabling or disabling it), as there's no way of knowing whether a
+	failed attempt reached the Pi-Hole before failing.
+*/
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetriesKey, true)
+}
+
+/*
+	An http.RoundTripper that retries idempotent requests that fail (or that the server answers
+	with a temporary error), waiting for an exponentially growing and jittered backoff between
+	each attempt. All requests go through a circuit breaker, which stops requests being sent to
+	a Pi-Hole that has stopped responding.
+*/
+type ResilientTransport struct {
+	// The transport that requests are sent over
+	Base http.RoundTripper
+	// How long each attempt is given before it's abandoned
+	AttemptTimeout time.Duration
+	// How many times a request is attempted in total
+	Attempts int
+	// How long to wait before the first retry, and the longest to wait for any retry
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// The circuit breaker shared by all requests
+	Breaker *CircuitBreaker
+	// Records every attempt, when debugging. nil otherwise
+	Tracer *Tracer
+}
+
+// Sends a request, retrying it if it's idempotent and fails
+func (transport *ResilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := transport.Breaker.Allow(); err != nil {
+		transport.Tracer.Logf("%s %s not sent: %s", req.Method, req.URL.String(), err.Error())
+		return nil, err
+	}
+
+	attempts := transport.Attempts
+	if !isRetryable(req) || attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := transport.attempt(req)
+		failed := err != nil || isTemporaryStatus(res.StatusCode)
+		if !failed {
+			transport.Breaker.Success()
+			return res, nil
+		}
+		if req.Context().Err() != nil {
+			// the request was cancelled, which says nothing about whether the Pi-Hole is responding
+			transport.Breaker.Abandon()
+			return res, err
+		}
+		if attempt >= attempts {
+			transport.Breaker.Failure()
+			return res, err
+		}
+
+		// the failed response is thrown away, ready for the next attempt
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+
+		backoff := transport.backoff(attempt)
+		transport.Tracer.Logf("%s %s failed, retrying in %s", req.Method, req.URL.String(), backoff.Round(time.Millisecond))
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			transport.Breaker.Abandon()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// Makes a single attempt at sending a request, giving up after the attempt timeout
+func (transport *ResilientTransport) attempt(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	if transport.AttemptTimeout <= 0 {
+		res, err := transport.Base.RoundTrip(req)
+		return transport.Tracer.record(req, res, err, started)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), transport.AttemptTimeout)
+	res, err := transport.Base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return transport.Tracer.record(req, nil, err, started)
+	}
+	// the attempt's context has to live until its response has been read
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return transport.Tracer.record(req, res, nil, started)
+}
+
+/*
+	How long to wait before retrying after a given attempt. The backoff doubles with each
+	attempt up to the maximum, and a random half of it is taken off so that many clients
+	retrying at once don't all hit the Pi-Hole at the same time.
+*/
+func (transport *ResilientTransport) backoff(attempt int) time.Duration {
+	backoff := transport.Backoff
+	for i := 1; i < attempt && backoff < transport.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > transport.MaxBackoff {
+		backoff = transport.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Can a request be safely retried? Only requests that don't change anything can be
+func isRetryable(req *http.Request) bool {
+	if noRetries, _ := req.Context().Value(noRetriesKey).(bool); noRetries {
+		return false
+	}
+	return req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+}
+
+// Is a status code one that the server could answer differently if asked again?
+func isTemporaryStatus(status int) bool {
+	return status == http.StatusTooManyRequests ||
+		status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+// A response body that cancels its request's context once it has been closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+/*
+	Stops requests being sent to a Pi-Hole that has stopped responding. Once enough requests
+	have failed in a row, the breaker opens and requests fail straight away. After a cooldown,
+	a single request is let through to test the Pi-Hole: if it succeeds the breaker closes,
+	otherwise it opens again for twice as long (up to a limit).
+*/
+type CircuitBreaker struct {
+	mutex sync.Mutex
+	// How many requests have to fail in a row for the breaker to open
+	threshold int
+	// How long the breaker stays open for at first
+	cooldown time.Duration
+	// The number of requests that have failed in a row
+	failures int
+	// How long the breaker is currently open for
+	openFor time.Duration
+	// When the breaker opened. The zero time if it's closed
+	openedAt time.Time
+	// Is a request currently testing the Pi-Hole?
+	testing bool
+	// Returns the current time, replaceable in tests
+	now func() time.Time
+}
+
+// Creates a closed circuit breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Returns an error if a request shouldn't be sent, as the breaker is open
+func (breaker *CircuitBreaker) Allow() error {
+	if breaker == nil {
+		return nil
+	}
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return nil
+	}
+	if breaker.testing || breaker.now().Sub(breaker.openedAt) < breaker.openFor {
+		return ErrCircuitOpen
+	}
+	breaker.testing = true
+	return nil
+}
+
+// Records a request succeeding, closing the breaker
+func (breaker *CircuitBreaker) Success() {
+	if breaker == nil {
+		return
+	}
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.failures = 0
+	breaker.openFor = 0
+	breaker.openedAt = time.Time{}
+	breaker.testing = false
+}
+
+// Records a request failing, opening the breaker if too many have failed in a row
+func (breaker *CircuitBreaker) Failure() {
+	if breaker == nil {
+		return
+	}
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.failures++
+	if breaker.testing {
+		// the Pi-Hole still isn't responding, so wait longer before testing it again
+		breaker.testing = false
+		breaker.openFor *= 2
+		if breaker.openFor > MaxBreakerCooldown {
+			breaker.openFor = MaxBreakerCooldown
+		}
+		breaker.openedAt = breaker.now()
+	} else if breaker.openedAt.IsZero() && breaker.failures >= breaker.threshold {
+		breaker.openFor = breaker.cooldown
+		breaker.openedAt = breaker.now()
+	}
+}
+
+/*
+	Records a request being cancelled before it finished. This doesn't count as a success or a
+	failure, but if the request was testing the Pi-Hole, another request is let through to test it.
+*/
+func (breaker *CircuitBreaker) Abandon() {
+	if breaker == nil {
+		return
+	}
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.testing = false
+}
+
+// Returns how long is left until the breaker lets a request through to test the Pi-Hole, or 0 if it's closed
+func (breaker *CircuitBreaker) RetryIn() time.Duration {
+	if breaker == nil {
+		return 0
+	}
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return 0
+	}
+	remaining := breaker.openFor - breaker.now().Sub(breaker.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+/*
+	Applies retry options to the shared HttpClient. Options that aren't set keep their defaults,
+	and the circuit breaker starts again closed.
+*/
+func ConfigureRetries(options *RetryOptions) error {
+	transport, err := sharedTransport()
+	if err != nil {
+		return err
+	}
+	if options == nil {
+		options = &RetryOptions{}
+	}
+
+	if options.Attempts < 0 || options.BackoffMS < 0 || options.MaxBackoffMS < 0 ||
+		options.BreakerThreshold < 0 || options.BreakerCooldownS < 0 {
+		return fmt.Errorf("retry options cannot be negative: %+v", *options)
+	}
+
+	transport.Attempts = valueOrDefault(options.Attempts, DefaultAttempts)
+	transport.Backoff = time.Millisecond * time.Duration(valueOrDefault(options.BackoffMS, int(DefaultBackoff.Milliseconds())))
+	transport.MaxBackoff = time.Millisecond * time.Duration(valueOrDefault(options.MaxBackoffMS, int(DefaultMaxBackoff.Milliseconds())))
+	Breaker = NewCircuitBreaker(
+		valueOrDefault(options.BreakerThreshold, DefaultBreakerThreshold),
+		time.Second*time.Duration(valueOrDefault(options.BreakerCooldownS, int(DefaultBreakerCooldown.Seconds()))))
+	transport.Breaker = Breaker
+	return nil
+}
+
+// Returns a value, or a default if the value isn't set
+func valueOrDefault(value int, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Creates a client that retries quickly, with its own circuit breaker
+func newTestClient(breaker *CircuitBreaker) *http.Client {
+	return &http.Client{
+		Transport: &ResilientTransport{
+			Base:           http.DefaultTransport.(*http.Transport).Clone(),
+			AttemptTimeout: time.Second,
+			Attempts:       3,
+			Backoff:        time.Millisecond,
+			MaxBackoff:     time.Millisecond * 5,
+			Breaker:        breaker,
+		},
+	}
+}
+
+// Tests for network.ResilientTransport.RoundTrip()
+func TestResilientTransport(t *testing.T) {
+	var requests int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first two attempts at each request fail
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "enabled"}`))
+	}))
+	defer mockServer.Close()
+
+	client := newTestClient(NewCircuitBreaker(10, time.Minute))
+
+	res, err := client.Get(mockServer.URL)
+	if err != nil {
+		t.Fatalf("@TestResilientTransport: request failed: %s", err.Error())
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || requests != 3 {
+		t.Errorf("@TestResilientTransport: expected a 200 after 3 attempts, got a %d after %d", res.StatusCode, requests)
+	}
+
+	// requests marked as not to be retried are only sent once
+	atomic.StoreInt32(&requests, 0)
+	req, _ := http.NewRequestWithContext(WithoutRetries(context.Background()), "GET", mockServer.URL, nil)
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("@TestResilientTransport: request failed: %s", err.Error())
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Errorf("@TestResilientTransport: expected a 503 after 1 attempt, got a %d after %d", res.StatusCode, requests)
+	}
+
+	// as are requests that aren't idempotent
+	atomic.StoreInt32(&requests, 0)
+	res, err = client.Post(mockServer.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("@TestResilientTransport: request failed: %s", err.Error())
+	}
+	_ = res.Body.Close()
+	if requests != 1 {
+		t.Errorf("@TestResilientTransport: a POST request was attempted %d times", requests)
+	}
+}
+
+// Tests for network.CircuitBreaker
+func TestCircuitBreaker(t *testing.T) {
+	var requests int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer mockServer.Close()
+
+	now := time.Now()
+	breaker := NewCircuitBreaker(2, time.Second*5)
+	breaker.now = func() time.Time { return now }
+	client := newTestClient(breaker)
+
+	// two failed requests open the breaker
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(mockServer.URL)
+		if err != nil {
+			t.Fatalf("@TestCircuitBreaker: request failed: %s", err.Error())
+		}
+		_ = res.Body.Close()
+	}
+	if breaker.RetryIn() != time.Second*5 {
+		t.Errorf("@TestCircuitBreaker: expected the breaker to be open for 5s, got %s", breaker.RetryIn())
+	}
+
+	// requests now fail without being sent
+	sent := atomic.LoadInt32(&requests)
+	if _, err := client.Get(mockServer.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("@TestCircuitBreaker: expected ErrCircuitOpen, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != sent {
+		t.Error("@TestCircuitBreaker: a request was sent while the breaker was open")
+	}
+
+	// after the cooldown, a failed test request opens the breaker for twice as long
+	now = now.Add(time.Second * 5)
+	res, err := client.Get(mockServer.URL)
+	if err != nil {
+		t.Fatalf("@TestCircuitBreaker: the test request failed: %s", err.Error())
+	}
+	_ = res.Body.Close()
+	if breaker.RetryIn() != time.Second*10 {
+		t.Errorf("@TestCircuitBreaker: expected the breaker to be open for 10s, got %s", breaker.RetryIn())
+	}
+
+	// and a successful one closes it
+	now = now.Add(time.Second * 10)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("@TestCircuitBreaker: the breaker didn't let a test request through: %s", err.Error())
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Error("@TestCircuitBreaker: the breaker let two test requests through at once")
+	}
+	breaker.Success()
+	if breaker.RetryIn() != 0 || breaker.Allow() != nil {
+		t.Error("@TestCircuitBreaker: the breaker didn't close after a successful request")
+	}
+}
+
+// Tests for network.ConfigureRetries()
+func TestConfigureRetries(t *testing.T) {
+	if err := ConfigureRetries(&RetryOptions{Attempts: -1}); err == nil {
+		t.Error("@TestConfigureRetries: negative options did not return an error")
+	}
+	if err := ConfigureRetries(&RetryOptions{Attempts: 5, BreakerCooldownS: 30}); err != nil {
+		t.Fatalf("@TestConfigureRetries: %s", err.Error())
+	}
+	transport, _ := sharedTransport()
+	if transport.Attempts != 5 || transport.Backoff != DefaultBackoff || transport.Breaker != Breaker || Breaker.cooldown != time.Second*30 {
+		t.Errorf("@TestConfigureRetries: options were not applied: %+v", transport)
+	}
+	_ = ConfigureRetries(nil)
+}
+
+// Tests for cancelled requests not counting against the Pi-Hole in the circuit breaker
+func TestResilientTransportCancelled(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer mockServer.Close()
+
+	breaker := NewCircuitBreaker(1, time.Minute)
+	client := newTestClient(breaker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", mockServer.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("@TestResilientTransportCancelled: expected context.Canceled, got %v", err)
+	}
+	if breaker.Allow() != nil {
+		t.Error("@TestResilientTransportCancelled: a cancelled request opened the breaker")
+	}
+}
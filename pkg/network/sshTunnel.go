@@ -0,0 +1,280 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// The port that SSH jump hosts are connected to if one isn't given
+const DefaultSSHPort = "22"
+
+// How long connecting and authenticating to a jump host can take
+const SSHHandshakeTimeout = time.Second * 10
+
+/*
+	Options for tunnelling connections to the Pi-Hole through an SSH jump host, in the same way
+	as 'ssh -J' or 'ssh -L', without needing a separate tunnel process. The jump host connects to
+	the Pi-Hole's web port on Pi-CLI's behalf, so the Pi-Hole's URL should be one that the jump
+	host can reach.
+*/
+type SSHTunnelOptions struct {
+	// The jump host, as host or host:port
+	Host string `json:"host"`
+	// The user to log into the jump host as. Defaults to the current user
+	User string `json:"user,omitempty"`
+	/*
+		Path to an unencrypted private key to authenticate with. Keys held by the SSH agent (at
+		SSH_AUTH_SOCK) are also tried, and are the way to use a key protected by a passphrase.
+	*/
+	IdentityFile string `json:"identity_file,omitempty"`
+	// Path to the known_hosts file that the jump host's key is verified against. Defaults to ~/.ssh/known_hosts
+	KnownHostsFile string `json:"known_hosts_file,omitempty"`
+}
+
+/*
+	Parses a jump host given as [user@]host[:port] (i.e. pi@bastion.example.com:2222) into
+	tunnel options
+*/
+func ParseSSHDestination(destination string) (*SSHTunnelOptions, error) {
+	destination = strings.TrimSpace(destination)
+	options := &SSHTunnelOptions{Host: destination}
+	if at := strings.LastIndex(destination, "@"); at != -1 {
+		options.User = destination[:at]
+		options.Host = destination[at+1:]
+	}
+	if options.Host == "" {
+		return nil, fmt.Errorf("'%s' doesn't include a jump host", destination)
+	}
+	if _, err := sshAddress(options.Host); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// Returns the host:port address of a jump host, adding the default SSH port if one isn't given
+func sshAddress(host string) (string, error) {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host, nil
+	}
+	// either a host on its own, or a bare IPv6 address
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.ContainsAny(trimmed, "[]") || (strings.Contains(trimmed, ":") && net.ParseIP(trimmed) == nil) {
+		return "", fmt.Errorf("'%s' is not a valid jump host", host)
+	}
+	return net.JoinHostPort(trimmed, DefaultSSHPort), nil
+}
+
+/*
+	A connection to an SSH jump host that connections to the Pi-Hole are made through. The SSH
+	connection is made when it's first needed, and made again if it drops.
+*/
+type SSHTunnel struct {
+	// The host:port address of the jump host
+	address string
+	config  *ssh.ClientConfig
+	mutex   sync.Mutex
+	// The current connection to the jump host. nil if there isn't one
+	client *ssh.Client
+}
+
+// Sets up a tunnel through a jump host, loading the keys that it authenticates with
+func NewSSHTunnel(options *SSHTunnelOptions) (*SSHTunnel, error) {
+	address, err := sshAddress(options.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	username := options.User
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, errors.New("no user was given for the jump host, and the current user is unknown")
+		}
+		username = current.Username
+	}
+
+	auth, err := sshAuthMethods(options.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsFile := options.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.New("no known_hosts file was given, and the home directory is unknown")
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts from %s (connect to the jump host with ssh once to add its key): %s", knownHostsFile, err.Error())
+	}
+
+	return &SSHTunnel{
+		address: address,
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         SSHHandshakeTimeout,
+		},
+	}, nil
+}
+
+// Gathers the ways of authenticating with a jump host: an identity file and/or the SSH agent
+func sshAuthMethods(identityFile string) ([]ssh.AuthMethod, error) {
+	var auth []ssh.AuthMethod
+
+	if identityFile != "" {
+		key, err := ioutil.ReadFile(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the SSH identity file: %s", err.Error())
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var passphraseMissing *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseMissing) {
+			return nil, fmt.Errorf("the SSH identity file %s is protected by a passphrase, add it to your SSH agent instead", identityFile)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse the SSH identity file %s: %s", identityFile, err.Error())
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("no way to authenticate with the jump host: give an identity file or run an SSH agent")
+	}
+	return auth, nil
+}
+
+/*
+	Opens a connection to an address through the jump host, for use as a http.Transport's
+	DialContext. If the connection to the jump host has dropped, it's made again.
+*/
+func (tunnel *SSHTunnel) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	client, err := tunnel.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialThrough(ctx, client, network, address)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+
+	// the jump host may have dropped the connection without it being noticed yet, so try a new one
+	tunnel.disconnect(client)
+	client, err = tunnel.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dialThrough(ctx, client, network, address)
+}
+
+// Closes the connection to the jump host, if there is one
+func (tunnel *SSHTunnel) Close() error {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.client == nil {
+		return nil
+	}
+	err := tunnel.client.Close()
+	tunnel.client = nil
+	return err
+}
+
+// Returns the connection to the jump host, connecting to it if needed
+func (tunnel *SSHTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.client != nil {
+		return tunnel.client, nil
+	}
+
+	dialer := net.Dialer{Timeout: tunnel.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", tunnel.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the jump host %s: %s", tunnel.address, err.Error())
+	}
+
+	// the handshake has to finish within the timeout too, or before the request is cancelled
+	deadline := time.Now().Add(tunnel.config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, tunnel.address, tunnel.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to log into the jump host %s: %s", tunnel.address, err.Error())
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(sshConn, channels, requests)
+	tunnel.client = client
+	go func() {
+		// forget the connection once it drops, so that the next dial makes a new one
+		_ = client.Wait()
+		tunnel.disconnect(client)
+	}()
+	return client, nil
+}
+
+// Forgets a connection to the jump host, if it's still the current one, and closes it
+func (tunnel *SSHTunnel) disconnect(client *ssh.Client) {
+	tunnel.mutex.Lock()
+	if tunnel.client == client {
+		tunnel.client = nil
+	}
+	tunnel.mutex.Unlock()
+	_ = client.Close()
+}
+
+/*
+	Asks the jump host to open a connection to an address. The SSH library can't cancel this, so
+	it's abandoned (and closed once it completes) if the context is cancelled first.
+*/
+func dialThrough(ctx context.Context, client *ssh.Client, network string, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial(network, address)
+		results <- result{conn, err}
+	}()
+
+	select {
+	case dialled := <-results:
+		if dialled.err != nil {
+			return nil, fmt.Errorf("the jump host failed to connect to %s: %s", address, dialled.err.Error())
+		}
+		return dialled.conn, nil
+	case <-ctx.Done():
+		go func() {
+			if dialled := <-results; dialled.conn != nil {
+				_ = dialled.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
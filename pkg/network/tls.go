@@ -0,0 +1,153 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+/*
+	Options controlling how Pi-CLI makes TLS connections to a Pi-Hole served over HTTPS, i.e.
+	behind a reverse proxy using an internal certificate authority or requiring client certificates
+*/
+type TLSOptions struct {
+	// Path to a PEM bundle of certificate authorities to trust, on top of the system's own
+	CAFile string `json:"ca_file,omitempty"`
+	// Paths to a PEM client certificate and its private key, presented to servers that ask for one (mTLS)
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// The name that the server's certificate is verified against, if it differs from the URL's host
+	ServerName string `json:"server_name,omitempty"`
+	/*
+		SHA-256 fingerprints of server certificates to trust, in hex with or without colons (as
+		printed by 'openssl x509 -noout -fingerprint -sha256'). When given, the server's certificate
+		must match one of them, and is trusted on its own, so self-signed certificates can be used.
+	*/
+	PinnedSHA256 []string `json:"pinned_sha256,omitempty"`
+	// Skips verifying the server's certificate altogether. This is insecure, and warned about
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// Are any of the options set?
+func (options *TLSOptions) IsSet() bool {
+	return options != nil && (options.CAFile != "" ||
+		options.CertFile != "" ||
+		options.KeyFile != "" ||
+		options.ServerName != "" ||
+		len(options.PinnedSHA256) > 0 ||
+		options.InsecureSkipVerify)
+}
+
+// Builds a TLS config from the options, loading any certificates that they refer to
+func (options *TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		bundle, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %s", err.Error())
+		}
+		config.RootCAs, err = x509.SystemCertPool()
+		if err != nil || config.RootCAs == nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+		if !config.RootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no PEM certificates found in the CA bundle %s", options.CAFile)
+		}
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(options.PinnedSHA256) > 0 {
+		pins := make([][]byte, len(options.PinnedSHA256))
+		for i, pin := range options.PinnedSHA256 {
+			decoded, err := ParseSHA256Fingerprint(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins[i] = decoded
+		}
+
+		/*
+			The pins replace verification against certificate authorities, so that self-signed
+			certificates can be used. Only the server's own certificate is compared, as the rest of
+			the chain it presents isn't verified.
+		*/
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("the server didn't present a certificate")
+			}
+			fingerprint := sha256.Sum256(rawCerts[0])
+			for _, pin := range pins {
+				if bytes.Equal(pin, fingerprint[:]) {
+					return nil
+				}
+			}
+			return fmt.Errorf("the server's certificate (SHA-256 %s) doesn't match any pinned fingerprint", hex.EncodeToString(fingerprint[:]))
+		}
+	}
+
+	return config, nil
+}
+
+// Parses a SHA-256 fingerprint written in hex, with or without colons
+func ParseSHA256Fingerprint(fingerprint string) ([]byte, error) {
+	cleaned := strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", "")
+	decoded, err := hex.DecodeString(cleaned)
+	if err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("'%s' is not a SHA-256 fingerprint (expected 64 hex characters)", fingerprint)
+	}
+	return decoded, nil
+}
+
+/*
+	Applies TLS options to the shared HttpClient used for every request to the Pi-Hole. Skipping
+	certificate verification is warned about loudly every time, as it leaves the connection (and
+	the API key sent over it) open to interception.
+*/
+func ConfigureTLS(options *TLSOptions) error {
+	if !options.IsSet() {
+		return nil
+	}
+
+	config, err := options.Config()
+	if err != nil {
+		return err
+	}
+
+	if options.InsecureSkipVerify {
+		_, _ = color.New(color.FgRed, color.Bold).Fprintln(
+			os.Stderr,
+			"WARNING: TLS certificate verification is disabled (insecure_skip_verify). "+
+				"Connections to the Pi-Hole, and your API key, can be intercepted!")
+	}
+
+	base, err := sharedBaseTransport()
+	if err != nil {
+		return err
+	}
+	base.TLSClientConfig = config
+	return nil
+}
@@ -0,0 +1,131 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Creates a self-signed certificate for 127.0.0.1, writing it and its key out as PEM files
+func newTestCertificate(t *testing.T, name string) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{name},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(t.TempDir(), name+".crt")
+	keyFile := filepath.Join(t.TempDir(), name+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, certFile, keyFile
+}
+
+// Sends a request to a server using a client configured with TLS options
+func requestWithTLSOptions(t *testing.T, server *httptest.Server, options *TLSOptions) error {
+	config, err := options.Config()
+	if err != nil {
+		t.Fatalf("@TestTLSOptions: network.TLSOptions.Config() failed: %s", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: time.Second * 3}
+	res, err := client.Get(server.URL)
+	if err == nil {
+		_ = res.Body.Close()
+	}
+	return err
+}
+
+// Tests for network.TLSOptions.Config() against a server using an internal CA and requiring client certificates
+func TestTLSOptions(t *testing.T) {
+	serverCertificate, caFile, _ := newTestCertificate(t, "pihole.internal")
+	clientCertificate, certFile, keyFile := newTestCertificate(t, "picli")
+
+	clientCA, err := x509.ParseCertificate(clientCertificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	trusted := &TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "pihole.internal"}
+	if err := requestWithTLSOptions(t, server, trusted); err != nil {
+		t.Errorf("@TestTLSOptions: expected the internal CA and client certificate to be accepted, got %s", err)
+	}
+
+	if err := requestWithTLSOptions(t, server, &TLSOptions{CAFile: caFile, ServerName: "pihole.internal"}); err == nil {
+		t.Error("@TestTLSOptions: expected the server to reject a client without a certificate")
+	}
+	if err := requestWithTLSOptions(t, server, &TLSOptions{CertFile: certFile, KeyFile: keyFile}); err == nil {
+		t.Error("@TestTLSOptions: expected a certificate from an unknown CA to be rejected")
+	}
+
+	fingerprint := sha256.Sum256(serverCertificate.Certificate[0])
+	pinned := &TLSOptions{CertFile: certFile, KeyFile: keyFile, PinnedSHA256: []string{hex.EncodeToString(fingerprint[:])}}
+	if err := requestWithTLSOptions(t, server, pinned); err != nil {
+		t.Errorf("@TestTLSOptions: expected the pinned certificate to be trusted, got %s", err)
+	}
+	pinned.PinnedSHA256 = []string{hex.EncodeToString(make([]byte, sha256.Size))}
+	if err := requestWithTLSOptions(t, server, pinned); err == nil {
+		t.Error("@TestTLSOptions: expected a certificate not matching the pin to be rejected")
+	}
+
+	if _, err := (&TLSOptions{CertFile: certFile}).Config(); err == nil {
+		t.Error("@TestTLSOptions: expected a client certificate without a key to be rejected")
+	}
+}
+
+// Tests for network.ParseSHA256Fingerprint()
+func TestParseSHA256Fingerprint(t *testing.T) {
+	withColons := "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89"
+	if fingerprint, err := ParseSHA256Fingerprint(withColons); err != nil || fingerprint[0] != 0xab {
+		t.Errorf("@TestParseSHA256Fingerprint: failed to parse a fingerprint with colons (%v)", err)
+	}
+	if _, err := ParseSHA256Fingerprint("abcdef"); err == nil {
+		t.Error("@TestParseSHA256Fingerprint: expected a short fingerprint to be rejected")
+	}
+}
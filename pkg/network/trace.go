@@ -0,0 +1,309 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// How much of each response body is written to the debug log. HAR files hold the whole body
+const MaxLoggedBodyBytes = 512
+
+/*
+	Records every attempt at a request to the Pi-Hole, for working out why a command isn't
+	showing what's expected. Each attempt can be logged (method, URL, status, latency and the
+	start of the response body) and/or kept to be written out as a HAR file, which can be
+	attached to a bug report or opened in a browser's developer tools. Secrets are redacted from
+	both, unless ShowSecrets is set.
+*/
+type Tracer struct {
+	mutex sync.Mutex
+	// Where attempts are logged to. nil if they aren't being logged
+	logger *log.Logger
+	// Where the HAR file is written to when the tracer is closed. Empty if one isn't being kept
+	harFile string
+	// The attempts recorded for the HAR file
+	entries []harEntry
+}
+
+// The tracer used by the shared HttpClient. nil unless debugging has been turned on
+var ActiveTracer *Tracer
+
+// Creates a tracer that logs to a writer (if it isn't nil) and/or keeps a HAR file (if a path is given)
+func NewTracer(logTo io.Writer, harFile string) *Tracer {
+	tracer := &Tracer{harFile: harFile}
+	if logTo != nil {
+		tracer.logger = log.New(logTo, "picli debug: ", log.LstdFlags|log.Lmicroseconds)
+	}
+	return tracer
+}
+
+// Turns on tracing for every request sent by the shared HttpClient
+func ConfigureTracing(tracer *Tracer) error {
+	transport, err := sharedTransport()
+	if err != nil {
+		return err
+	}
+	ActiveTracer = tracer
+	transport.Tracer = tracer
+	return nil
+}
+
+// Sends everything logged from now on to a different writer (i.e. away from the terminal)
+func (tracer *Tracer) LogTo(logTo io.Writer) {
+	if tracer == nil || tracer.logger == nil {
+		return
+	}
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	tracer.logger.SetOutput(logTo)
+}
+
+/*
+	Logs a message that isn't about a specific request (i.e. a request being turned away by the
+	circuit breaker)
+*/
+func (tracer *Tracer) Logf(format string, args ...interface{}) {
+	if tracer == nil || tracer.logger == nil {
+		return
+	}
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	tracer.logger.Print(Redact(fmt.Sprintf(format, args...)))
+}
+
+/*
+	Records an attempt at a request. If a response was received, its body is read in full so that
+	it can be recorded, and replaced with a copy for the caller to read. Returns the response to
+	pass on, or the error if the attempt failed (including failing to read the body).
+*/
+func (tracer *Tracer) record(req *http.Request, res *http.Response, err error, started time.Time) (*http.Response, error) {
+	if tracer == nil {
+		return res, err
+	}
+
+	var body []byte
+	if err == nil {
+		body, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			_ = res.Body.Close()
+			res = nil
+		} else {
+			// the original body is still closed by the caller, as closing it can release resources
+			res.Body = &replayedBody{Reader: bytes.NewReader(body), Closer: res.Body}
+		}
+	}
+	elapsed := time.Since(started)
+
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+
+	if tracer.logger != nil {
+		target := fmt.Sprintf("%s %s", req.Method, Redact(req.URL.String()))
+		if err != nil {
+			tracer.logger.Printf("%s failed after %s: %s", target, elapsed.Round(time.Millisecond), Redact(WithoutURL(err).Error()))
+		} else {
+			tracer.logger.Printf("%s -> %s (%s, %d bytes)", target, res.Status, elapsed.Round(time.Millisecond), len(body))
+			tracer.logger.Printf("  body: %s", Redact(truncate(body, MaxLoggedBodyBytes)))
+		}
+	}
+
+	if tracer.harFile != "" {
+		tracer.entries = append(tracer.entries, newHAREntry(req, res, body, err, started, elapsed))
+	}
+	return res, err
+}
+
+// Writes out the HAR file, if one is being kept
+func (tracer *Tracer) Close() error {
+	if tracer == nil || tracer.harFile == "" {
+		return nil
+	}
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "Pi-CLI", Version: buildVersion()},
+		Entries: tracer.entries,
+	}}
+	if har.Log.Entries == nil {
+		har.Log.Entries = []harEntry{}
+	}
+	encoded, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(tracer.harFile, encoded, 0600); err != nil {
+		return fmt.Errorf("failed to write the HAR file: %s", err.Error())
+	}
+	return nil
+}
+
+// The version of Pi-CLI that's running, as recorded when it was built
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// Shortens a response body to a given length, noting how much was cut off
+func truncate(body []byte, length int) string {
+	if len(body) <= length {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:length], len(body)-length)
+}
+
+// A response body that has already been read, replayed from a copy
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+/*
+	The parts of the HAR 1.2 format (http://www.softwareishard.com/blog/har-12-spec/) that Pi-CLI
+	records. Sizes that aren't known are -1, as the format asks for.
+*/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Why the request failed, if it did. Custom fields are prefixed with an underscore
+	Error string `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Builds a HAR entry for an attempt at a request, with any secrets redacted
+func newHAREntry(req *http.Request, res *http.Response, body []byte, err error, started time.Time, elapsed time.Duration) harEntry {
+	milliseconds := float64(elapsed.Microseconds()) / 1000
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            milliseconds,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         Redact(req.URL.String()),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Send: 0, Wait: milliseconds, Receive: 0},
+	}
+
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			if IsSecretParameter(name) && !ShowSecrets {
+				value = Redacted
+			}
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: Redact(value)})
+		}
+	}
+
+	if err != nil {
+		entry.Error = Redact(WithoutURL(err).Error())
+		return entry
+	}
+
+	entry.Response.Status = res.StatusCode
+	entry.Response.StatusText = http.StatusText(res.StatusCode)
+	entry.Response.HTTPVersion = res.Proto
+	entry.Response.Headers = harHeaders(res.Header)
+	entry.Response.BodySize = len(body)
+	entry.Response.Content = harContent{
+		Size:     len(body),
+		MimeType: res.Header.Get("Content-Type"),
+		Text:     Redact(string(body)),
+	}
+	return entry
+}
+
+// Converts headers to HAR's name/value pairs, redacting any that may hold credentials
+func harHeaders(headers http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for name, values := range headers {
+		for _, value := range values {
+			switch http.CanonicalHeaderKey(name) {
+			case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+				if !ShowSecrets {
+					value = Redacted
+				}
+			}
+			pairs = append(pairs, harNameValue{Name: name, Value: Redact(value)})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,74 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for network.Tracer logging requests and recording them in a HAR file
+func TestTracer(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+	longBody := `{"status": "enabled", "padding": "` + strings.Repeat("x", MaxLoggedBodyBytes) + `"}`
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(longBody))
+	}))
+	defer mockServer.Close()
+
+	var logged bytes.Buffer
+	harPath := filepath.Join(t.TempDir(), "session.har")
+	tracer := NewTracer(&logged, harPath)
+
+	client := newTestClient(NewCircuitBreaker(10, time.Minute))
+	client.Transport.(*ResilientTransport).Tracer = tracer
+
+	res, err := client.Get(mockServer.URL + "/admin/api.php?summary&auth=" + key)
+	if err != nil {
+		t.Fatalf("@TestTracer: request failed: %s", err.Error())
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != longBody {
+		t.Error("@TestTracer: the response body wasn't passed on in full after being traced")
+	}
+
+	// a request that fails is recorded too
+	_, _ = client.Get("http://127.0.0.1:1/admin/api.php?summary&auth=" + key)
+
+	log := logged.String()
+	if strings.Contains(log, key) || !strings.Contains(log, "auth=REDACTED") {
+		t.Errorf("@TestTracer: the API key wasn't redacted from the log: %s", log)
+	}
+	if !strings.Contains(log, "-> 200 OK") || !strings.Contains(log, "more bytes)") || !strings.Contains(log, "failed after") {
+		t.Errorf("@TestTracer: unexpected log: %s", log)
+	}
+
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("@TestTracer: failed to write the HAR file: %s", err.Error())
+	}
+	encoded, _ := ioutil.ReadFile(harPath)
+	if bytes.Contains(encoded, []byte(key)) {
+		t.Error("@TestTracer: the API key wasn't redacted from the HAR file")
+	}
+	var har harFile
+	if err := json.Unmarshal(encoded, &har); err != nil {
+		t.Fatalf("@TestTracer: the HAR file isn't valid JSON: %s", err.Error())
+	}
+	// the failing request is attempted 3 times
+	if len(har.Log.Entries) != 4 {
+		t.Fatalf("@TestTracer: expected 4 HAR entries, got %d", len(har.Log.Entries))
+	}
+	if entry := har.Log.Entries[0]; entry.Response.Status != 200 || entry.Response.Content.Text != longBody || entry.Response.Content.MimeType != "application/json" {
+		t.Errorf("@TestTracer: unexpected HAR entry for a successful request: %+v", entry.Response)
+	}
+	if entry := har.Log.Entries[1]; entry.Response.Status != 0 || entry.Error == "" {
+		t.Errorf("@TestTracer: unexpected HAR entry for a failed request: %+v", entry)
+	}
+}
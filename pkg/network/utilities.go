@@ -1,21 +1,87 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
-// Plug the Pi-Hole address and port together to get a full URL
-func GenerateAPIAddress(address string, port int) string {
-	return fmt.Sprintf("http://%s:%d/admin/api.php", address, port)
+// The path of the Pi-Hole's API, relative to its base URL
+const APIPath = "/admin/api.php"
+
+// Append the path of the API to the Pi-Hole's base URL to get a full URL
+func GenerateAPIAddress(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + APIPath
+}
+
+/*
+	Parses the base URL of a Pi-Hole's web interface, as given by the user. This is where the
+	Pi-Hole is served from, without the /admin/ part (i.e. https://pihole.lan/pihole for a Pi-Hole
+	behind a reverse proxy at /pihole/). It can be:
+		- an IP address or host name on its own (i.e. 192.168.1.2, pihole.lan, fe80::1), which
+		  is assumed to be served over HTTP
+		- a full URL, with a scheme of http or https, and an optional port and path prefix.
+		  IPv6 addresses must be enclosed in square brackets (i.e. http://[fe80::1]:8080)
+
+	The URL is returned in a normalised form, without a trailing slash. A trailing /admin or
+	/admin/api.php (i.e. from a URL copied out of the browser) is removed.
+*/
+func ParseBaseURL(baseURL string) (string, error) {
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL == "" {
+		return "", errors.New("the Pi-Hole's URL cannot be empty")
+	}
+
+	// bare IPv6 addresses need brackets before they can be parsed as part of a URL
+	if ip := net.ParseIP(baseURL); ip != nil && ip.To4() == nil {
+		baseURL = "[" + ip.String() + "]"
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a valid URL", baseURL)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme '%s' (expected http or https)", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return "", fmt.Errorf("'%s' doesn't include a host", baseURL)
+	}
+	if parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("'%s' should only include a scheme, host, port and path", baseURL)
+	}
+	if port := parsed.Port(); port != "" {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return "", fmt.Errorf("port must be between 1 and 65535, got '%s'", port)
+		}
+	}
+
+	path := strings.TrimSuffix(parsed.Path, "/")
+	path = strings.TrimSuffix(path, APIPath)
+	path = strings.TrimSuffix(path, "/admin")
+
+	return (&url.URL{Scheme: parsed.Scheme, Host: strings.ToLower(parsed.Host), Path: path}).String(), nil
+}
+
+// Builds a base URL from an address and port, as stored in config files before base URLs were supported
+func LegacyBaseURL(address string, port int) string {
+	return "http://" + net.JoinHostPort(address, strconv.Itoa(port))
 }
 
 // IsAlive will, given an IP and port, return true or false denoting if the address is alive
-func IsAlive(address string) bool {
+func IsAlive(ctx context.Context, address string) bool {
 	color.Yellow("Validating " + address)
-	req, err := http.NewRequest("GET", address, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", address, nil)
 
 	if err != nil {
 		color.Red("Failed to generate HTTP GET in IsAlive()")
@@ -37,3 +103,15 @@ func IsAlive(address string) bool {
 func ValidatePiHoleDetails(res *http.Response) bool {
 	return res.StatusCode == http.StatusOK
 }
+
+/*
+	Strips the URL out of an error from sending a request. The URLs of API requests include the
+	API key, which shouldn't be shown to the user
+*/
+func WithoutURL(err error) error {
+	var urlError *url.Error
+	if errors.As(err, &urlError) {
+		return urlError.Err
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/api"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/database"
+)
+
+// How often a replay updates the UI's data, no matter how fast it's being played back
+const ReplayRefreshInterval = time.Second
+
+/*
+A Pi-Hole's history replayed from its FTL database. A replay keeps a clock that starts at a
+point in the database's history and moves forwards at a multiple of real time, and each update
+rebuilds the UI's data as it would have been at the clock's current time.
+*/
+type ReplaySource struct {
+	// The FTL database being replayed
+	db *sql.DB
+	// The database's schema, detected once when the replay is created
+	schema *database.Schema
+	// Where the database came from, for display
+	path string
+	// How many times faster than real time the replay plays back
+	speed float64
+	// The time of the last query in the database, where the replay finishes
+	end time.Time
+	// Where the replay's clock was up to when it was last moved forwards
+	position time.Time
+	// The real time at which the replay's clock was last moved forwards
+	lastAdvanced time.Time
+	// Is the replay paused?
+	paused bool
+}
+
+/*
+Creates a replay of an FTL database, starting at from (or the first query in the database if
+from is the zero time) and playing back at speed times real time
+*/
+func NewReplaySource(db *sql.DB, path string, from time.Time, speed float64) (*ReplaySource, error) {
+	if speed <= 0 {
+		return nil, errors.New("the replay speed must be greater than zero")
+	}
+
+	schema, err := database.DetectSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.RequireQueries(); err != nil {
+		return nil, err
+	}
+
+	first, last, err := database.QueryTimeRange(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// label clients in the query log with the names that the database (and user) knows them by
+	clientNames, err := database.ClientNames(db)
+	if err != nil {
+		return nil, err
+	}
+	data.LivePiCLIData.Clients = clientNames
+
+	source := &ReplaySource{
+		db:           db,
+		schema:       schema,
+		path:         path,
+		speed:        speed,
+		end:          time.Unix(last, 0),
+		position:     time.Unix(first, 0),
+		lastAdvanced: time.Now(),
+	}
+	if !from.IsZero() {
+		if from.After(source.end) {
+			return nil, fmt.Errorf(
+				"the database's last query was at %s, so there is nothing to replay from %s",
+				source.end.In(database.OutputLocation).Format(time.RFC822),
+				from.In(database.OutputLocation).Format(time.RFC822))
+		}
+		source.position = from
+	}
+	return source, nil
+}
+
+/*
+Parses a replay speed given by the user, as a multiple of real time with an optional trailing
+x (i.e. 10x, 0.5x or 60)
+*/
+func ParseReplaySpeed(speed string) (float64, error) {
+	trimmed := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(speed)), "x")
+	parsed, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || parsed <= 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+		return 0, fmt.Errorf("invalid replay speed '%s' (expected a positive multiple of real time, i.e. 10x)", speed)
+	}
+	return parsed, nil
+}
+
+// Moves the replay's clock forwards by the real time that has passed, scaled by its speed
+func (source *ReplaySource) advance() {
+	now := time.Now()
+	if !source.paused {
+		elapsed := time.Duration(float64(now.Sub(source.lastAdvanced)) * source.speed)
+		source.position = source.position.Add(elapsed)
+		if source.position.After(source.end) {
+			source.position = source.end
+		}
+	}
+	source.lastAdvanced = now
+}
+
+// Has the replay reached the last query in the database?
+func (source *ReplaySource) finished() bool {
+	return !source.position.Before(source.end)
+}
+
+// Rebuilds the UI's data as it was at the replay's current time
+func (source *ReplaySource) Update(context.Context) error {
+	source.advance()
+
+	snapshot, err := database.Dashboard(
+		source.db,
+		source.schema,
+		source.position,
+		api.LiveTopItems.Amount(),
+		api.LiveAllQueries.AmountOfQueriesInLog)
+	if err != nil {
+		return err
+	}
+
+	api.LiveSummary.QueriesToday = strconv.Itoa(snapshot.Queries)
+	api.LiveSummary.BlockedToday = strconv.Itoa(snapshot.Blocked)
+	api.LiveSummary.PercentBlockedToday = "0.0"
+	if snapshot.Queries > 0 {
+		api.LiveSummary.PercentBlockedToday = strconv.FormatFloat(
+			float64(snapshot.Blocked)/float64(snapshot.Queries)*100, 'f', 1, 64)
+	}
+	// the size of the blocklist isn't recorded in the FTL database
+	api.LiveSummary.DomainsOnBlocklist = "N/A"
+	api.LiveSummary.TotalClientsSeen = strconv.Itoa(snapshot.Clients)
+
+	topQueries := make(map[string]int)
+	for _, count := range snapshot.TopPermitted {
+		topQueries[count.Domain] = count.Count
+	}
+	topAds := make(map[string]int)
+	for _, count := range snapshot.TopBlocked {
+		topAds[count.Domain] = count.Count
+	}
+	api.LiveTopItems.Set(topQueries, topAds)
+
+	/*
+		The query log expects its queries oldest first, and as many as there are slots in the log.
+		If there aren't enough queries to fill the log, the oldest slots are left empty.
+	*/
+	queries := make([]api.Query, api.LiveAllQueries.AmountOfQueriesInLog)
+	offset := len(queries) - len(snapshot.Latest)
+	for i, query := range snapshot.Latest {
+		queries[offset+i] = api.Query{
+			UnixTime:     strconv.FormatInt(query.Timestamp, 10),
+			QueryType:    query.Type,
+			Domain:       query.Domain,
+			OriginClient: query.Client,
+			ForwardedTo:  query.Forward,
+		}
+	}
+	api.LiveAllQueries.Queries = queries
+	api.LiveAllQueries.ConvertToTable()
+	return nil
+}
+
+// Replays update at a fixed rate, and play back faster or slower by moving their clock further
+func (source *ReplaySource) RefreshInterval() time.Duration {
+	return ReplayRefreshInterval
+}
+
+// Describes the replay, where it's up to and whether it's playing
+func (source *ReplaySource) Info() []string {
+	state := "Playing"
+	if source.finished() {
+		state = "Finished"
+	} else if source.paused {
+		state = "Paused"
+	}
+
+	return []string{
+		fmt.Sprintf("Replaying: %s (%s at %sx)", source.path, state, strconv.FormatFloat(source.speed, 'f', -1, 64)),
+		fmt.Sprintf("Replay time: %s", source.position.In(database.OutputLocation).Format("Mon 02 Jan 2006 15:04:05 MST")),
+		fmt.Sprintf("Ends at: %s", source.end.In(database.OutputLocation).Format("Mon 02 Jan 2006 15:04:05 MST")),
+		fmt.Sprintf("Clients Seen /24hr: %s", api.LiveSummary.TotalClientsSeen),
+	}
+}
+
+// Pauses or resumes the replay
+func (source *ReplaySource) Toggle(context.Context) {
+	source.advance()
+	source.paused = !source.paused
+}
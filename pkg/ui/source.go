@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Reeceeboii/Pi-CLI/pkg/api"
+	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/network"
+)
+
+/*
+Somewhere that the data shown in the UI comes from. A source keeps api.LiveSummary,
+api.LiveTopItems and api.LiveAllQueries up to date, and the UI draws whatever they hold.
+*/
+type DataSource interface {
+	// Brings the UI's data up to date, giving up if the context is cancelled (i.e. the user quits)
+	Update(ctx context.Context) error
+	// How long to wait between each update
+	RefreshInterval() time.Duration
+	// Lines describing the source and its state, shown at the top right of the UI
+	Info() []string
+	// Responds to the P keybind, i.e. enabling/disabling the Pi-Hole or pausing/resuming a replay
+	Toggle(ctx context.Context)
+}
+
+// The live Pi-Hole, with data pulled from its API
+type LiveSource struct {
+	// The error from the last update or toggle, if it failed
+	lastError error
+	// Data that the last update found hidden by the Pi-Hole's privacy level, i.e. the query log
+	hidden []string
+	// Have the names that the Pi-Hole knows its clients by been loaded yet?
+	loadedClientNames bool
+}
+
+// Creates a source that pulls data from the configured Pi-Hole's API
+func NewLiveSource() *LiveSource {
+	return &LiveSource{}
+}
+
+/*
+Updates the data via the Pi-Hole's API. A Pi-Hole that can't be reached isn't treated as an
+error, as the network layer's circuit breaker backs off from it until it comes back. Instead,
+the data is left as it was and the failure is shown in the source's info.
+*/
+func (source *LiveSource) Update(ctx context.Context) error {
+	// the query log is labelled with the names, so they're loaded before it's updated
+	if !source.loadedClientNames {
+		source.loadedClientNames = api.UpdateClientNames(ctx, data.LivePiCLIData.Clients) == nil
+	}
+
+	updates := []func() error{
+		func() error {
+			return api.LiveSummary.Update(ctx, data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, nil)
+		},
+		func() error { return api.LiveTopItems.Update(ctx, nil) },
+		func() error { return api.LiveAllQueries.Update(ctx, nil) },
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(updates))
+	for i, update := range updates {
+		wg.Add(1)
+		go func(i int, update func() error) {
+			defer wg.Done()
+			errs[i] = update()
+		}(i, update)
+	}
+	wg.Wait()
+
+	// an update that was cancelled part way through says nothing about whether the Pi-Hole is reachable
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	source.lastError = nil
+	source.hidden = nil
+	for _, err := range errs {
+		// data hidden by the privacy level is left empty, and noted in the source's info
+		var privacyErr *api.PrivacyLevelError
+		if errors.As(err, &privacyErr) {
+			source.hidden = append(source.hidden, privacyErr.Error())
+			continue
+		}
+		// the breaker turning requests away is less useful to show than why it opened in the first place
+		if err != nil && (source.lastError == nil || errors.Is(source.lastError, network.ErrCircuitOpen)) {
+			source.lastError = err
+		}
+	}
+	// at lower privacy levels the query log is still shown, but with placeholders in it
+	if api.LiveAllQueries.Hidden != nil {
+		source.hidden = append(source.hidden, api.LiveAllQueries.Hidden.Error())
+	}
+	if source.lastError == nil {
+		data.LivePiCLIData.LastUpdated = time.Now()
+	}
+	return nil
+}
+
+// The refresh rate set by the user
+func (source *LiveSource) RefreshInterval() time.Duration {
+	return time.Second * time.Duration(data.LivePiCLIData.Settings.RefreshS)
+}
+
+// Describes the Pi-Hole's state, and when its data was last updated
+func (source *LiveSource) Info() []string {
+	// timestamp of the last data grab
+	formattedTime := data.LivePiCLIData.LastUpdated.Format("15:04:05")
+
+	status := fmt.Sprintf("Pi-Hole Status: %s", strings.Title(api.LiveSummary.Status))
+	if source.lastError != nil {
+		status = fmt.Sprintf("[Pi-Hole Status: %s](fg:red)", errorStatus(source.lastError))
+	}
+
+	info := []string{
+		status,
+		fmt.Sprintf(
+			"Data last updated: %s (update every %ds)",
+			formattedTime,
+			data.LivePiCLIData.Settings.RefreshS),
+		fmt.Sprintf("Privacy Level: %s", getPrivacyLevel(&api.LiveSummary.PrivacyLevel)),
+		fmt.Sprintf("Total Clients Seen: %s", api.LiveSummary.TotalClientsSeen),
+	}
+	for _, hidden := range source.hidden {
+		info = append(info, fmt.Sprintf("[%s](fg:yellow)", strings.ToUpper(hidden[:1])+hidden[1:]))
+	}
+	return info
+}
+
+// Enables or disables the Pi-Hole
+func (source *LiveSource) Toggle(ctx context.Context) {
+	if api.LiveSummary.Status == "enabled" {
+		source.lastError = api.DisablePiHole(ctx, false, 0)
+	} else {
+		source.lastError = api.EnablePiHole(ctx)
+	}
+}
+
+/*
+Describes why the last update or toggle failed, briefly enough to fit in the info panel. The
+Pi-Hole either couldn't be reached, or its response couldn't be used.
+*/
+func errorStatus(err error) string {
+	var responseErr *api.ResponseError
+	switch {
+	case errors.Is(err, api.ErrAPIKeyRejected):
+		return err.Error()
+	case errors.As(err, &responseErr):
+		return fmt.Sprintf("Unexpected response (%s)", responseErr.Reason)
+	}
+	return fmt.Sprintf("Unreachable (%s)", unreachableReason(err))
+}
+
+// Describes why the Pi-Hole couldn't be reached
+func unreachableReason(err error) string {
+	if retryIn := network.Breaker.RetryIn(); errors.Is(err, network.ErrCircuitOpen) && retryIn > 0 {
+		return fmt.Sprintf("retrying in %ds", int(retryIn.Round(time.Second).Seconds()))
+	}
+	if errors.Is(err, network.ErrCircuitOpen) {
+		return "retrying"
+	}
+	return network.Redact(network.WithoutURL(err).Error())
+}
@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"github.com/Reeceeboii/Pi-CLI/pkg/api"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
+)
+
+// Prefixes marking groups in the top lists that can be expanded, or that have been expanded
+const (
+	collapsedGroupPrefix = "+ "
+	expandedGroupPrefix  = "- "
+	// Indentation of the members listed beneath an expanded group
+	groupMemberPrefix = "    "
+)
+
+/*
+	Builds the rows of a top domains list, with the members of expanded groups listed beneath
+	them. Alongside the rows, the group that each row belongs to is returned so that the
+	selected row can be mapped back to its group.
+*/
+func topListRows(groups []domains.DomainGroup, expanded map[string]bool) ([]string, []string) {
+	rows := []string{}
+	rowGroups := []string{}
+
+	for _, group := range groups {
+		// groups of a single domain (including every group when grouping is off) can't be expanded
+		if len(group.Members) == 1 {
+			rows = append(rows, api.PrettyDomainGroup(group))
+			rowGroups = append(rowGroups, group.Domain)
+			continue
+		}
+
+		if !expanded[group.Domain] {
+			rows = append(rows, collapsedGroupPrefix+api.PrettyDomainGroup(group))
+			rowGroups = append(rowGroups, group.Domain)
+			continue
+		}
+
+		rows = append(rows, expandedGroupPrefix+api.PrettyDomainGroup(group))
+		rowGroups = append(rowGroups, group.Domain)
+		for _, member := range group.Members {
+			rows = append(rows, groupMemberPrefix+api.PrettyDomainCount(member))
+			rowGroups = append(rowGroups, group.Domain)
+		}
+	}
+
+	return rows, rowGroups
+}
+
+// Returns the index of the row that a group starts at, or 0 if the group isn't in the list
+func groupRow(rowGroups []string, group string) int {
+	for row, rowGroup := range rowGroups {
+		if rowGroup == group {
+			return row
+		}
+	}
+	return 0
+}
@@ -1,31 +1,17 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"github.com/Reeceeboii/Pi-CLI/pkg/api"
 	"github.com/Reeceeboii/Pi-CLI/pkg/data"
+	"github.com/Reeceeboii/Pi-CLI/pkg/domains"
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 	"log"
-	"strings"
-	"sync"
 	"time"
 )
 
-var wg sync.WaitGroup
-
-/*
-Update data so it can be displayed.
-This function makes calls to the Pi-Hole's API
-*/
-func updateData() {
-	go api.LiveSummary.Update(data.LivePiCLIData.FormattedAPIAddress, data.LivePiCLIData.APIKey, &wg)
-	go api.LiveTopItems.Update(&wg)
-	go api.LiveAllQueries.Update(&wg)
-	wg.Wait()
-	data.LivePiCLIData.LastUpdated = time.Now()
-}
-
 /*
 Given a value representing the current privacy level, return the level name.
 https://docs.pi-hole.net/ftldns/privacylevels/
@@ -43,8 +29,11 @@ func uiCanDraw() bool {
 	return !data.LivePiCLIData.ShowKeybindsScreen
 }
 
-// Create the UI and start rendering
-func StartUI() {
+/*
+Create the UI and start rendering, with its data coming from a given source (i.e. the live
+Pi-Hole, or a replay of its database). Returns when the user quits, or if the source fails.
+*/
+func StartUI(ctx context.Context, source DataSource) error {
 	if err := ui.Init(); err != nil {
 		log.Fatalf("failed to initialize termui: %v", err)
 	}
@@ -81,10 +70,39 @@ func StartUI() {
 	topAds.Title = "Top 10 Blocked Domains"
 	topAds.Rows = api.LiveTopItems.PrettyTopAds
 
+	// groups in each top list that have been expanded to show their members
+	expandedTopQueries := map[string]bool{}
+	expandedTopAds := map[string]bool{}
+	// the group that each row of each top list belongs to
+	var topQueriesRowGroups, topAdsRowGroups []string
+
 	queryLog := widgets.NewList()
 	queryLog.Title = fmt.Sprintf("Latest %d queries", api.LiveAllQueries.AmountOfQueriesInLog)
 	queryLog.Rows = api.LiveAllQueries.Table
 
+	/*
+		The lists that can be scrolled through using the arrow keys. Tab moves between them, and
+		the focused list's title is highlighted
+	*/
+	scrollableLists := []*widgets.List{queryLog, topQueries, topAds}
+	focusedList := 0
+	focus := func(index int) {
+		focusedList = index
+		for i, list := range scrollableLists {
+			list.TitleStyle = ui.NewStyle(ui.ColorWhite)
+			if list != queryLog {
+				list.SelectedRowStyle = list.TextStyle
+			}
+			if i == focusedList {
+				list.TitleStyle = ui.NewStyle(ui.ColorYellow, ui.ColorClear, ui.ModifierBold)
+				if list != queryLog {
+					list.SelectedRowStyle = ui.NewStyle(ui.ColorYellow, ui.ColorClear, ui.ModifierBold)
+				}
+			}
+		}
+	}
+	focus(0)
+
 	keybindsPrompt := widgets.NewParagraph()
 	keybindsPrompt.Text = "Press F1 at any time to view keybinds..."
 	keybindsPrompt.Border = false
@@ -148,25 +166,24 @@ func StartUI() {
 			domainsOnBlocklist.Text = api.LiveSummary.DomainsOnBlocklist
 
 			// domain lists
-			topQueries.Rows = api.LiveTopItems.PrettyTopQueries
-			topAds.Rows = api.LiveTopItems.PrettyTopAds
+			topQueries.Rows, topQueriesRowGroups = topListRows(api.LiveTopItems.TopQueryGroups, expandedTopQueries)
+			topAds.Rows, topAdsRowGroups = topListRows(api.LiveTopItems.TopAdGroups, expandedTopAds)
+			topQueries.Title, topAds.Title = "Top 10 Permitted Domains", "Top 10 Blocked Domains"
+			if api.LiveTopItems.Grouping == domains.RegistrableDomainGrouping {
+				topQueries.Title += " (grouped)"
+				topAds.Title += " (grouped)"
+			}
+			for _, list := range []*widgets.List{topQueries, topAds} {
+				if list.SelectedRow >= len(list.Rows) {
+					list.SelectedRow = 0
+				}
+			}
 
 			// query log
 			queryLog.Rows = api.LiveAllQueries.Table
 			queryLog.Title = fmt.Sprintf("Latest %d queries", api.LiveAllQueries.AmountOfQueriesInLog)
 
-			// timestamp of the last data grab
-			formattedTime := data.LivePiCLIData.LastUpdated.Format("15:04:05")
-
-			piHoleInfo.Rows = []string{
-				fmt.Sprintf("Pi-Hole Status: %s", strings.Title(api.LiveSummary.Status)),
-				fmt.Sprintf(
-					"Data last updated: %s (update every %ds)",
-					formattedTime,
-					data.LivePiCLIData.Settings.RefreshS),
-				fmt.Sprintf("Privacy Level: %s", getPrivacyLevel(&api.LiveSummary.PrivacyLevel)),
-				fmt.Sprintf("Total Clients Seen: %s", api.LiveSummary.TotalClientsSeen),
-			}
+			piHoleInfo.Rows = source.Info()
 
 			// render the grid
 			ui.Render(grid)
@@ -178,119 +195,220 @@ func StartUI() {
 	uiEvents := ui.PollEvents()
 
 	// channel used to capture ticker events to time data update events
-	tickerDuration := time.Duration(data.LivePiCLIData.Settings.RefreshS)
-	dataUpdateTicker := time.NewTicker(time.Second * tickerDuration).C
+	dataUpdateTicker := time.NewTicker(source.RefreshInterval()).C
 
 	// channel used to capture ticker events to time redraws (30fps)
 	drawTicker := time.NewTicker(time.Second / 30).C
 
-	updateData()
-	draw()
-	for {
-		select {
-		case e := <-uiEvents:
-			switch e.ID {
-
-			// quit
-			case "q", "<C-c>":
-				return
-
-			// respond to terminal resize events
-			case "<Resize>":
-				payload := e.Payload.(ui.Resize)
-				if uiCanDraw() {
-					grid.SetRect(0, 0, payload.Width, payload.Height)
-					ui.Render(grid)
-					break
+	// cancelled when the UI closes, abandoning anything still in flight (i.e. a slow poll)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// events that arrived while waiting on the source, handled once it has finished
+	var deferredEvents []ui.Event
+
+	/*
+		Runs something against the source (i.e. an update) in the background, while still
+		responding to the user quitting. Quitting cancels it straight away rather than waiting for
+		it to finish or time out. Any other events are held onto until it has finished.
+	*/
+	waitFor := func(task func(ctx context.Context) error) (quit bool, err error) {
+		done := make(chan error, 1)
+		go func() {
+			done <- task(ctx)
+		}()
+		for {
+			select {
+			case err := <-done:
+				return false, err
+			case e := <-uiEvents:
+				if e.ID == "q" || e.ID == "<C-c>" {
+					cancel()
+					return true, nil
 				}
-				keybindsGrid.SetRect(0, 0, payload.Width, payload.Height)
-				ui.Clear()
-				ui.Render(keybindsGrid)
-				break
+				deferredEvents = append(deferredEvents, e)
+			}
+		}
+	}
 
-			// increase (by 1) the number of queries in the query log
-			case "e":
-				if uiCanDraw() {
-					api.LiveAllQueries.AmountOfQueriesInLog++
-					api.LiveAllQueries.Queries = append(api.LiveAllQueries.Queries, api.Query{})
-				}
-				break
+	// responds to a keypress or resize, returning true if the user has quit
+	handleEvent := func(e ui.Event) (quit bool, err error) {
+		switch e.ID {
 
-			// increase (by 10) the number of queries in the query log
-			case "r":
-				if uiCanDraw() {
-					api.LiveAllQueries.AmountOfQueriesInLog += 10
-					api.LiveAllQueries.Queries = append(api.LiveAllQueries.Queries, make([]api.Query, 10)...)
-				}
-				break
+		// quit
+		case "q", "<C-c>":
+			return true, nil
 
-			// decrease (by 1) the number of queries in the query log
-			case "d":
-				if uiCanDraw() && api.LiveAllQueries.AmountOfQueriesInLog > 1 {
-					api.LiveAllQueries.AmountOfQueriesInLog--
-					api.LiveAllQueries.Queries = api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-1]
-				}
+		// respond to terminal resize events
+		case "<Resize>":
+			payload := e.Payload.(ui.Resize)
+			if uiCanDraw() {
+				grid.SetRect(0, 0, payload.Width, payload.Height)
+				ui.Render(grid)
 				break
+			}
+			keybindsGrid.SetRect(0, 0, payload.Width, payload.Height)
+			ui.Clear()
+			ui.Render(keybindsGrid)
+			break
 
-			// decrease (by 10) the number of queries in the query log
-			case "f":
-				if uiCanDraw() {
-					if api.LiveAllQueries.AmountOfQueriesInLog-10 <= 0 {
-						api.LiveAllQueries.AmountOfQueriesInLog = 1
-						api.LiveAllQueries.Queries =
-							api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-(len(api.LiveAllQueries.Queries)-1)]
-					} else {
-						api.LiveAllQueries.AmountOfQueriesInLog -= 10
-						api.LiveAllQueries.Queries = api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-10]
-					}
-				}
-				break
+		// increase (by 1) the number of queries in the query log
+		case "e":
+			if uiCanDraw() {
+				api.LiveAllQueries.AmountOfQueriesInLog++
+				api.LiveAllQueries.Queries = append(api.LiveAllQueries.Queries, api.Query{})
+			}
+			break
 
-			// scroll down (by 1) in the query log list
-			case "<Down>":
-				if uiCanDraw() {
-					queryLog.ScrollDown()
-				}
-				break
+		// increase (by 10) the number of queries in the query log
+		case "r":
+			if uiCanDraw() {
+				api.LiveAllQueries.AmountOfQueriesInLog += 10
+				api.LiveAllQueries.Queries = append(api.LiveAllQueries.Queries, make([]api.Query, 10)...)
+			}
+			break
 
-			// scroll down (by 10) in the query log list
-			case "<PageDown>":
-				if uiCanDraw() {
-					queryLog.ScrollAmount(10)
+		// decrease (by 1) the number of queries in the query log
+		case "d":
+			if uiCanDraw() && api.LiveAllQueries.AmountOfQueriesInLog > 1 {
+				api.LiveAllQueries.AmountOfQueriesInLog--
+				api.LiveAllQueries.Queries = api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-1]
+			}
+			break
+
+		// decrease (by 10) the number of queries in the query log
+		case "f":
+			if uiCanDraw() {
+				if api.LiveAllQueries.AmountOfQueriesInLog-10 <= 0 {
+					api.LiveAllQueries.AmountOfQueriesInLog = 1
+					api.LiveAllQueries.Queries =
+						api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-(len(api.LiveAllQueries.Queries)-1)]
+				} else {
+					api.LiveAllQueries.AmountOfQueriesInLog -= 10
+					api.LiveAllQueries.Queries = api.LiveAllQueries.Queries[:len(api.LiveAllQueries.Queries)-10]
 				}
-				break
+			}
+			break
 
-			// scroll up (by 1) in the query log list
-			case "<Up>":
-				if uiCanDraw() {
-					queryLog.ScrollUp()
+		// scroll down (by 1) in the focused list
+		case "<Down>":
+			if uiCanDraw() {
+				scrollableLists[focusedList].ScrollDown()
+			}
+			break
+
+		// scroll down (by 10) in the focused list
+		case "<PageDown>":
+			if uiCanDraw() {
+				scrollableLists[focusedList].ScrollAmount(10)
+			}
+			break
+
+		// scroll up (by 1) in the focused list
+		case "<Up>":
+			if uiCanDraw() {
+				scrollableLists[focusedList].ScrollUp()
+			}
+			break
+
+		// scroll up (by 10) in the focused list
+		case "<PageUp>":
+			if uiCanDraw() {
+				scrollableLists[focusedList].ScrollAmount(-10)
+			}
+			break
+
+		// move the focus to the next scrollable list
+		case "<Tab>":
+			if uiCanDraw() {
+				focus((focusedList + 1) % len(scrollableLists))
+			}
+			break
+
+		// group (or stop grouping) the top lists' domains by their registrable domain
+		case "g":
+			if uiCanDraw() {
+				if api.LiveTopItems.Grouping == domains.RegistrableDomainGrouping {
+					api.LiveTopItems.Grouping = domains.NoGrouping
+				} else {
+					api.LiveTopItems.Grouping = domains.RegistrableDomainGrouping
 				}
-				break
+				if quit, err := waitFor(source.Update); quit || err != nil {
+					return quit, err
+				}
+			}
+			break
 
-			// scroll up (by 10) in the query log list
-			case "<PageUp>":
-				if uiCanDraw() {
-					queryLog.ScrollAmount(-10)
+		// expand (or collapse) the selected group in the focused top list
+		case "<Enter>":
+			if uiCanDraw() {
+				list, groups, rowGroups, expanded :=
+					topQueries, api.LiveTopItems.TopQueryGroups, topQueriesRowGroups, expandedTopQueries
+				if scrollableLists[focusedList] == topAds {
+					list, groups, rowGroups, expanded =
+						topAds, api.LiveTopItems.TopAdGroups, topAdsRowGroups, expandedTopAds
+				} else if scrollableLists[focusedList] != topQueries {
+					break
 				}
-				break
+				if list.SelectedRow < len(rowGroups) {
+					group := rowGroups[list.SelectedRow]
+					expanded[group] = !expanded[group]
+					// keep the group itself selected, rather than whichever row takes its place
+					list.Rows, rowGroups = topListRows(groups, expanded)
+					list.SelectedRow = groupRow(rowGroups, group)
+				}
+			}
+			break
+
+		// highlight (or stop highlighting) suspicious looking domains in the query log
+		case "h":
+			if uiCanDraw() {
+				data.LivePiCLIData.HighlightSuspiciousDomains = !data.LivePiCLIData.HighlightSuspiciousDomains
+				api.LiveAllQueries.ConvertToTable()
+			}
+			break
 
-			// enable or disable the Pi-Hole
-			case "p":
-				if uiCanDraw() {
-					if api.LiveSummary.Status == "enabled" {
-						api.DisablePiHole(false, 0)
-					} else {
-						api.EnablePiHole()
-					}
+		// enable or disable the Pi-Hole (or pause or resume a replay)
+		case "p":
+			if uiCanDraw() {
+				if quit, err := waitFor(func(ctx context.Context) error {
+					source.Toggle(ctx)
+					return nil
+				}); quit || err != nil {
+					return quit, err
 				}
-				break
+			}
+			break
 
-			// switch grids between the keybinds view and the main screen
-			case "<F1>":
-				ui.Clear()
-				data.LivePiCLIData.ShowKeybindsScreen = !data.LivePiCLIData.ShowKeybindsScreen
-				break
+		// switch grids between the keybinds view and the main screen
+		case "<F1>":
+			ui.Clear()
+			data.LivePiCLIData.ShowKeybindsScreen = !data.LivePiCLIData.ShowKeybindsScreen
+			break
+		}
+		return false, nil
+	}
+
+	if quit, err := waitFor(source.Update); quit || err != nil {
+		return err
+	}
+	draw()
+	for {
+		// catch up on anything that happened while waiting on the source
+		for len(deferredEvents) > 0 {
+			e := deferredEvents[0]
+			deferredEvents = deferredEvents[1:]
+			if quit, err := handleEvent(e); quit || err != nil {
+				return err
 			}
+		}
+
+		select {
+		case e := <-uiEvents:
+			if quit, err := handleEvent(e); quit || err != nil {
+				return err
+			}
+			break
 
 		/*
 			Capturing 2 separate ticker channels like this allows the update of the data and the update of the
@@ -302,7 +420,9 @@ func StartUI() {
 		case <-dataUpdateTicker:
 			// there's only a need to make API calls when the keybinds screen isn't being shown
 			if uiCanDraw() {
-				updateData()
+				if quit, err := waitFor(source.Update); quit || err != nil {
+					return err
+				}
 			}
 			break
 